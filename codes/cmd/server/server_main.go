@@ -11,6 +11,7 @@
 - setupLogger: 设置日志记录器
 - createSyncService: 创建同步服务
 - handlePanic: 处理全局异常
+- runExport: 将同步文件夹导出为静态目录
 */
 
 package main
@@ -32,6 +33,7 @@ import (
 var (
 	baseDir     string
 	configFile  string
+	exportDir   string
 	defaultPort = 8080
 )
 
@@ -45,6 +47,7 @@ func init() {
 
 	// 解析命令行参数
 	flag.StringVar(&configFile, "config", "", "配置文件路径")
+	flag.StringVar(&exportDir, "export", "", "将同步文件夹导出到指定目录后退出, 需要同时指定配置文件")
 	flag.Parse()
 }
 
@@ -62,6 +65,11 @@ func main() {
 		"baseDir": baseDir,
 	})
 
+	if exportDir != "" && configFile == "" {
+		fmt.Println("导出需要使用 -config 指定配置文件")
+		os.Exit(2)
+	}
+
 	// 加载配置
 	cfg, err := loadOrCreateConfig(c, configFile)
 	if err != nil {
@@ -86,6 +94,18 @@ func main() {
 		os.Exit(1)
 	}
 
+	// 导出模式不启动界面
+	if exportDir != "" {
+		if err := runExport(syncService, exportDir); err != nil {
+			logger.Error("静态导出失败", interfaces.Fields{
+				"error": err.Error(),
+			})
+			fmt.Printf("导出失败: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	// 创建视图模型
 	viewModel := viewmodels.NewConfigViewModel(syncService, logger)
 
@@ -102,7 +122,16 @@ func main() {
 	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
-		<-sigChan
+		sig := <-sigChan
+		logger.Info("收到退出信号, 等待传输完成", interfaces.Fields{
+			"signal": sig.String(),
+		})
+		// 先优雅关闭服务器, 让进行中的传输在超时前完成
+		if err := c.Shutdown(); err != nil {
+			logger.Error("关闭服务失败", interfaces.Fields{
+				"error": err.Error(),
+			})
+		}
 		viewModel.HandleWindowClosing()
 		os.Exit(0)
 	}()
@@ -140,3 +169,21 @@ func loadOrCreateConfig(c *container.Container, configFile string) (*interfaces.
 	})
 	return nil, nil
 }
+
+// runExport 将同步文件夹导出为静态目录并输出结果
+func runExport(syncService interfaces.SyncService, dir string) error {
+	serverService, ok := syncService.(interfaces.ServerSyncService)
+	if !ok {
+		return fmt.Errorf("配置文件不是服务器配置")
+	}
+
+	result, err := serverService.ExportStatic(dir)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("导出完成: %s\n", dir)
+	fmt.Printf("文件: %d, 忽略: %d, 新写入: %d (%d 字节)\n", result.Files, result.Ignored, result.Written, result.Bytes)
+	fmt.Printf("清单签名公钥: %s\n", result.PublicKey)
+	return nil
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"path/filepath"
 	"sync"
+	"time"
 
 	"synctools/codes/internal/interfaces"
 	"synctools/codes/pkg/config"
@@ -13,6 +14,9 @@ import (
 	"synctools/codes/pkg/storage"
 )
 
+// defaultShutdownTimeout 未配置时关闭服务器等待传输完成的时间
+const defaultShutdownTimeout = 30 * time.Second
+
 // Container 依赖注入容器
 type Container struct {
 	services map[string]interface{}
@@ -140,6 +144,7 @@ func (c *Container) GetStorage() interfaces.Storage {
 }
 
 // Shutdown 关闭所有服务
+// 服务器会等待进行中的传输完成, 最长等待配置的关闭超时时间
 func (c *Container) Shutdown() error {
 	var errs []error
 
@@ -147,7 +152,8 @@ func (c *Container) Shutdown() error {
 	if svc := c.GetSyncService(); svc != nil {
 		if serverService, ok := svc.(interfaces.ServerSyncService); ok {
 			// 如果是服务器类型，需要先停止网络服务器
-			if err := serverService.StopServer(); err != nil {
+			timeout := shutdownTimeout(serverService.GetCurrentConfig())
+			if err := serverService.ShutdownServer(timeout); err != nil {
 				errs = append(errs, fmt.Errorf("停止网络服务器失败: %v", err))
 			}
 		}
@@ -158,3 +164,11 @@ func (c *Container) Shutdown() error {
 	}
 	return nil
 }
+
+// shutdownTimeout 获取关闭服务器时等待传输完成的时间
+func shutdownTimeout(cfg *interfaces.Config) time.Duration {
+	if cfg == nil || cfg.ShutdownTimeout <= 0 {
+		return defaultShutdownTimeout
+	}
+	return time.Duration(cfg.ShutdownTimeout) * time.Second
+}
@@ -1,6 +1,7 @@
 package interfaces
 
 import (
+	"context"
 	"io"
 	"net"
 	"time"
@@ -54,12 +55,18 @@ type NetworkServer interface {
 	// Stop 停止服务器
 	Stop() error
 
+	// Shutdown 优雅关闭服务器, 在timeout内等待进行中的传输完成
+	Shutdown(timeout time.Duration) error
+
 	// HandleClient 处理客户端连接
 	HandleClient(conn net.Conn)
 
-	// GetStatus 获取服务器状态
+	// GetStatus 获取服务器状态, 包含每个监听地址的状态
 	GetStatus() string
 
+	// GetListeners 获取所有监听地址的状态
+	GetListeners() []ListenerStatus
+
 	// IsRunning 检查服务器是否运行中
 	IsRunning() bool
 }
@@ -81,14 +88,14 @@ type NetworkClient interface {
 	// ReceiveData 接收数据
 	ReceiveData(v interface{}) error
 
-	// SendFile 发送文件
-	SendFile(path string, progress chan<- Progress) error
+	// SendFile 发送文件, 上下文取消时停止发送
+	SendFile(ctx context.Context, path string, progress chan<- Progress) error
 
-	// ReceiveFile 接收文件
-	ReceiveFile(destDir string, progress chan<- Progress) error
+	// ReceiveFile 接收文件, 上下文取消时停止接收并删除临时文件
+	ReceiveFile(ctx context.Context, destDir string, progress chan<- Progress) error
 
-	// SetConnectionLostCallback 设置连接丢失回调
-	SetConnectionLostCallback(callback func())
+	// SetConnectionLostCallback 设置连接丢失回调, 回调参数为断开原因
+	SetConnectionLostCallback(callback func(err error))
 }
 
 // FileTransfer 定义文件传输操作接口
@@ -162,14 +169,21 @@ type ServerSyncService interface {
 	// 服务器操作
 	StartServer() error
 	StopServer() error
+	ShutdownServer(timeout time.Duration) error
 	SetServer(server NetworkServer)
 	GetNetworkServer() NetworkServer
 
 	// 同步操作
 	HandleSyncRequest(request interface{}) error
 
+	// 访问令牌操作
+	RevokeToken(name string) error
+
+	// 静态导出
+	ExportStatic(outDir string) (*ExportResult, error)
+
 	// MD5操作
-	GetLocalFilesWithMD5(dir string) (map[string]string, error)
+	GetLocalFilesWithMD5(ctx context.Context, dir string) (map[string]string, error)
 }
 
 // ClientSyncService 客户端同步服务接口
@@ -180,17 +194,20 @@ type ClientSyncService interface {
 	Connect(addr, port string) error
 	Disconnect() error
 	IsConnected() bool
-	SetConnectionLostCallback(callback func())
+	SetConnectionLostCallback(callback func(err error))
 
-	// 同步操作
-	SyncFiles(path string) error
+	// 局域网发现
+	DiscoverServers(timeout time.Duration) ([]*ServerBeacon, error)
+
+	// 同步操作, 上下文取消时中止进行中的传输, 每个本地文件保持原样或已完整更新
+	SyncFiles(ctx context.Context, path string) error
 
 	// 服务器配置操作
 	SaveServerConfig(config *Config) error
 	LoadServerConfig() (*Config, error)
 
 	// MD5操作
-	GetLocalFilesWithMD5(dir string) (map[string]string, error)
+	GetLocalFilesWithMD5(ctx context.Context, dir string) (map[string]string, error)
 	CompareMD5(localFiles map[string]string, serverFiles map[string]string) ([]string, map[string]struct{}, int, error)
 }
 
@@ -58,28 +58,79 @@ const (
 
 // Config represents configuration information
 type Config struct {
-	UUID            string           `json:"uuid"`             // 配置文件唯一标识
-	Type            ConfigType       `json:"type"`             // 配置类型
-	Name            string           `json:"name"`             // 整合包名称
-	Version         string           `json:"version"`          // 整合包版本
-	Host            string           `json:"host"`             // 服务器主机地址
-	Port            int              `json:"port"`             // 服务器端口
-	ConnTimeout     int              `json:"conn_timeout"`     // 连接超时时间(秒)
-	SyncDir         string           `json:"sync_dir"`         // 同步目录
-	SyncFolders     []SyncFolder     `json:"sync_folders"`     // 同步文件夹列表
-	IgnoreList      []string         `json:"ignore_list"`      // 忽略文件列表
-	FolderRedirects []FolderRedirect `json:"folder_redirects"` // 文件夹重定向配置
-	ServerConfig    *Config          `json:"server_config"`    // 服务器配置
-	LastModified    time.Time        `json:"last_modified"`    // 最后修改时间
-	CreateTime      time.Time        `json:"create_time"`      // 创建时间
+	UUID                 string           `json:"uuid"`                    // 配置文件唯一标识
+	Type                 ConfigType       `json:"type"`                    // 配置类型
+	Name                 string           `json:"name"`                    // 整合包名称
+	Version              string           `json:"version"`                 // 整合包版本
+	Host                 string           `json:"host"`                    // 服务器主机地址
+	Port                 int              `json:"port"`                    // 服务器端口
+	HTTPPort             int              `json:"http_port"`               // 服务端HTTP传输端口, 为0时不启用, TLS与主监听地址相同
+	Listeners            []ListenerConfig `json:"listeners"`               // 服务端额外的监听地址, Host和Port为主监听地址
+	Discovery            bool             `json:"discovery"`               // 服务端是否在局域网广播服务器信息
+	ConnTimeout          int              `json:"conn_timeout"`            // 连接超时时间(秒)
+	HeartbeatInterval    int              `json:"heartbeat_interval"`      // 心跳间隔(秒), 为0时使用默认值
+	HeartbeatMisses      int              `json:"heartbeat_misses"`        // 连续未收到心跳的次数达到该值时判定连接断开, 为0时使用默认值
+	UploadLimit          int              `json:"upload_limit"`            // 服务端总上传速率上限(KB/s), 0表示不限速
+	ClientUploadLimit    int              `json:"client_upload_limit"`     // 服务端对单个客户端的上传速率上限(KB/s), 0表示不限速
+	DownloadLimit        int              `json:"download_limit"`          // 客户端下载速率上限(KB/s), 0表示不限速
+	DownloadWorkers      int              `json:"download_workers"`        // 客户端并行下载的文件数, 为0时使用默认值
+	MaxConnections       int              `json:"max_connections"`         // 服务端最大并发连接数, 为0时使用默认值
+	MaxConnectionsPerIP  int              `json:"max_connections_per_ip"`  // 服务端单个IP的最大连接数, 为0时使用默认值
+	MaxRequestsPerClient int              `json:"max_requests_per_client"` // 服务端单个客户端同时处理的请求数, 为0时使用默认值
+	RequestQueueSize     int              `json:"request_queue_size"`      // 服务端单个客户端排队等待的请求数, 为0时使用默认值
+	ShutdownTimeout      int              `json:"shutdown_timeout"`        // 服务端关闭时等待传输完成的时间(秒), 为0时使用默认值
+	WatchInterval        int              `json:"watch_interval"`          // 服务端检查同步目录文件变化的间隔(秒), 为0时使用默认值
+	SyncDir              string           `json:"sync_dir"`                // 同步目录
+	SyncFolders          []SyncFolder     `json:"sync_folders"`            // 同步文件夹列表
+	IgnoreList           []string         `json:"ignore_list"`             // 忽略文件列表
+	FolderRedirects      []FolderRedirect `json:"folder_redirects"`        // 文件夹重定向配置
+	ServerConfig         *Config          `json:"server_config"`           // 服务器配置
+	TLS                  TLSConfig        `json:"tls"`                     // TLS加密配置
+	Proxy                ProxyConfig      `json:"proxy"`                   // 客户端连接服务器使用的代理
+	ManifestKey          string           `json:"manifest_key"`            // 客户端固定的静态清单签名公钥, 为空时首次同步自动记录
+	AuthSecret           string           `json:"auth_secret"`             // 认证密钥, 服务端使用该密钥认证的客户端拥有全部权限
+	AuthToken            string           `json:"auth_token"`              // 客户端使用的访问令牌名称, 为空时使用认证密钥
+	AccessTokens         []AccessToken    `json:"access_tokens"`           // 服务端定义的访问令牌
+	LastModified         time.Time        `json:"last_modified"`           // 最后修改时间
+	CreateTime           time.Time        `json:"create_time"`             // 创建时间
+}
+
+// UnmarshalJSON 解析配置
+// 旧版本不使用 is_enabled 字段, 保存的同步文件夹全部为未启用, 同步文件夹全部未启用的配置视为旧配置, 全部启用
+func (c *Config) UnmarshalJSON(data []byte) error {
+	type config Config
+	if err := json.Unmarshal(data, (*config)(c)); err != nil {
+		return err
+	}
+	for _, folder := range c.SyncFolders {
+		if folder.IsEnabled {
+			return nil
+		}
+	}
+	for i := range c.SyncFolders {
+		c.SyncFolders[i].IsEnabled = true
+	}
+	return nil
 }
 
 // SyncFolder represents synchronization folder configuration
 type SyncFolder struct {
-	Path      string   `json:"path"`       // 文件夹路径
-	SyncMode  SyncMode `json:"sync_mode"`  // 同步模式
-	PackMD5   string   `json:"pack_md5"`   // pack模式下的压缩包MD5
-	IsEnabled bool     `json:"is_enabled"` // 是否启用
+	Path        string   `json:"path"`                   // 文件夹路径
+	SyncMode    SyncMode `json:"sync_mode"`              // 同步模式
+	PackMD5     string   `json:"pack_md5"`               // pack模式下的压缩包MD5
+	IsEnabled   bool     `json:"is_enabled"`             // 是否启用
+	AllowDelete bool     `json:"allow_delete,omitempty"` // 是否允许客户端删除服务器上的文件
+}
+
+// UnmarshalJSON 解析同步文件夹配置, 没有 is_enabled 字段的旧配置视为启用
+func (f *SyncFolder) UnmarshalJSON(data []byte) error {
+	type syncFolder SyncFolder
+	folder := syncFolder{IsEnabled: true}
+	if err := json.Unmarshal(data, &folder); err != nil {
+		return err
+	}
+	*f = SyncFolder(folder)
+	return nil
 }
 
 // FolderRedirect represents folder redirection configuration
@@ -88,6 +139,73 @@ type FolderRedirect struct {
 	ClientPath string `json:"client_path"` // 客户端的文件夹名
 }
 
+// TLSConfig represents TLS configuration
+type TLSConfig struct {
+	Enabled     bool   `json:"enabled"`     // 是否启用TLS
+	CertFile    string `json:"cert_file"`   // 服务端证书文件, 为空时使用自动生成的自签名证书
+	KeyFile     string `json:"key_file"`    // 服务端私钥文件
+	Fingerprint string `json:"fingerprint"` // 客户端固定的服务器证书SHA256指纹, 为空时首次连接自动记录
+}
+
+// ListenerAuth 监听地址的认证策略
+type ListenerAuth string
+
+const (
+	ListenerAuthDefault ListenerAuth = ""       // 与主监听地址相同, 按认证密钥和访问令牌认证
+	ListenerAuthNone    ListenerAuth = "none"   // 不要求认证, 连接拥有全部权限, 只应用于本机地址或Unix套接字
+	ListenerAuthSecret  ListenerAuth = "secret" // 只接受认证密钥, 不接受访问令牌
+)
+
+// ListenerConfig represents an additional server listener
+type ListenerConfig struct {
+	Name      string       `json:"name"`       // 名称, 用于日志和状态显示
+	Network   string       `json:"network"`    // tcp、tcp4、tcp6 或 unix, 为空时为tcp
+	Address   string       `json:"address"`    // 监听地址, Unix套接字为文件路径
+	TLS       bool         `json:"tls"`        // 是否启用TLS, 使用与主监听地址相同的证书
+	Auth      ListenerAuth `json:"auth"`       // 认证策略
+	LocalOnly bool         `json:"local_only"` // 只接受本机连接
+	HTTP      bool         `json:"http"`       // 提供HTTP传输而不是TCP协议
+}
+
+// ListenerStatus represents server listener state
+type ListenerStatus struct {
+	Name    string       `json:"name"`    // 名称
+	Network string       `json:"network"` // 网络类型
+	Address string       `json:"address"` // 实际监听的地址
+	TLS     bool         `json:"tls"`     // 是否启用TLS
+	Auth    ListenerAuth `json:"auth"`    // 认证策略
+	HTTP    bool         `json:"http"`    // 是否为HTTP传输
+	Running bool         `json:"running"` // 是否正在监听
+	Status  string       `json:"status"`  // 状态描述
+}
+
+// ProxyType 代理类型
+type ProxyType string
+
+const (
+	ProxyEnv    ProxyType = ""       // 按 ALL_PROXY、HTTPS_PROXY、HTTP_PROXY 和 NO_PROXY 环境变量
+	ProxyNone   ProxyType = "none"   // 不使用代理
+	ProxySOCKS5 ProxyType = "socks5" // SOCKS5代理
+	ProxyHTTP   ProxyType = "http"   // HTTP CONNECT代理
+)
+
+// ProxyConfig represents client proxy configuration
+type ProxyConfig struct {
+	Type     ProxyType `json:"type"`     // 代理类型
+	Address  string    `json:"address"`  // 代理地址, 格式为 主机:端口
+	Username string    `json:"username"` // 代理用户名, 为空时不认证
+	Password string    `json:"password"` // 代理密码
+}
+
+// AccessToken represents a named client access token
+type AccessToken struct {
+	Name     string   `json:"name"`      // 令牌名称
+	Secret   string   `json:"secret"`    // 令牌密钥, 客户端以此计算认证应答
+	Folders  []string `json:"folders"`   // 允许列出和下载的同步文件夹, 为空表示全部
+	CanWrite bool     `json:"can_write"` // 是否允许删除等修改操作
+	Revoked  bool     `json:"revoked"`   // 是否已吊销
+}
+
 // FileInfo represents file information
 type FileInfo struct {
 	Path         string    `json:"path"`          // 文件路径
@@ -151,9 +269,115 @@ type CompressProgress struct {
 
 // Message represents base message structure
 type Message struct {
-	Type    string          `json:"type"`    // 消息类型
-	UUID    string          `json:"uuid"`    // 客户端UUID
-	Payload json.RawMessage `json:"payload"` // 消息内容
+	ID      uint32          `json:"id,omitempty"` // 请求ID, 响应携带与请求相同的ID
+	Type    string          `json:"type"`         // 消息类型
+	UUID    string          `json:"uuid"`         // 客户端UUID
+	Payload json.RawMessage `json:"payload"`      // 消息内容
+}
+
+// InitRequest represents handshake request
+type InitRequest struct {
+	UUID            string                       `json:"uuid"`             // 客户端配置UUID
+	MD5Map          map[string]map[string]string `json:"md5_map"`          // 客户端文件MD5列表
+	ProtocolVersion int                          `json:"protocol_version"` // 客户端协议版本
+	Capabilities    []string                     `json:"capabilities"`     // 客户端支持的功能
+}
+
+// InitResponse represents handshake response
+type InitResponse struct {
+	Success         bool                         `json:"success"`          // 是否成功
+	Message         string                       `json:"message"`          // 消息
+	Config          *Config                      `json:"config"`           // 服务器配置
+	MD5Map          map[string]map[string]string `json:"md5_map"`          // 服务器文件MD5列表
+	ProtocolVersion int                          `json:"protocol_version"` // 服务器协议版本
+	Capabilities    []string                     `json:"capabilities"`     // 双方共同支持的功能
+	Reject          *HandshakeReject             `json:"reject,omitempty"` // 拒绝原因
+}
+
+// ManifestChanged represents server file manifest change notification
+type ManifestChanged struct {
+	Version uint64 `json:"version"` // 清单版本, 每次变化加一
+	Reason  string `json:"reason"`  // 变化原因
+}
+
+// ManifestResponse represents server file manifest response
+type ManifestResponse struct {
+	Success bool                         `json:"success"` // 是否成功
+	Message string                       `json:"message"` // 消息
+	Config  *Config                      `json:"config"`  // 服务器配置
+	MD5Map  map[string]map[string]string `json:"md5_map"` // 服务器文件MD5列表
+	Version uint64                       `json:"version"` // 清单版本
+}
+
+// ServerBeacon represents LAN discovery beacon
+type ServerBeacon struct {
+	UUID            string `json:"uuid"`                  // 服务器配置唯一标识
+	ServerName      string `json:"server_name"`           // 服务器主机名
+	Name            string `json:"name"`                  // 整合包名称
+	Version         string `json:"version"`               // 整合包版本
+	Port            int    `json:"port"`                  // TCP传输端口
+	HTTPPort        int    `json:"http_port"`             // HTTP传输端口, 为0时未启用
+	TLS             bool   `json:"tls"`                   // 是否启用TLS
+	Fingerprint     string `json:"fingerprint,omitempty"` // 服务器证书指纹
+	ProtocolVersion int    `json:"protocol_version"`      // 服务器协议版本
+	Address         string `json:"-"`                     // 发送信标的地址, 由客户端填写
+}
+
+// StaticManifest represents statically exported file manifest
+type StaticManifest struct {
+	FormatVersion int                          `json:"format_version"` // 清单格式版本
+	CreateTime    time.Time                    `json:"create_time"`    // 导出时间
+	Config        *Config                      `json:"config"`         // 客户端可见的服务器配置
+	MD5Map        map[string]map[string]string `json:"md5_map"`        // 服务器文件MD5列表, 与在线服务器返回的相同
+	Files         map[string]StaticFile        `json:"files"`          // 相对于同步目录的文件路径到文件内容的映射
+}
+
+// StaticFile represents exported file content
+type StaticFile struct {
+	MD5  string `json:"md5"`  // 文件MD5, 同时是内容文件的名称
+	Size int64  `json:"size"` // 文件大小
+}
+
+// ExportResult represents static export result
+type ExportResult struct {
+	Files     int    `json:"files"`      // 导出的文件数
+	Ignored   int    `json:"ignored"`    // 按忽略规则跳过的文件数
+	Written   int    `json:"written"`    // 本次新写入的内容文件数, 内容未变化的文件不重复写入
+	Bytes     int64  `json:"bytes"`      // 本次新写入的字节数
+	PublicKey string `json:"public_key"` // 清单签名公钥
+}
+
+// SignedManifest represents signed static manifest
+type SignedManifest struct {
+	Manifest  json.RawMessage `json:"manifest"`   // 清单内容, 签名针对其原始字节
+	PublicKey string          `json:"public_key"` // 签名公钥
+	Signature string          `json:"signature"`  // 签名
+}
+
+// HandshakeReject represents handshake rejection reason
+type HandshakeReject struct {
+	Reason     string   `json:"reason"`            // 拒绝原因代码
+	MinVersion int      `json:"min_version"`       // 服务器兼容的最低协议版本
+	MaxVersion int      `json:"max_version"`       // 服务器兼容的最高协议版本
+	Missing    []string `json:"missing,omitempty"` // 缺少的必需功能
+}
+
+// AuthChallenge represents authentication challenge
+type AuthChallenge struct {
+	Nonce    string `json:"nonce"`    // 服务器生成的随机数
+	Required bool   `json:"required"` // 服务器是否要求认证
+}
+
+// AuthResponse represents authentication response
+type AuthResponse struct {
+	Token string `json:"token,omitempty"` // 访问令牌名称, 为空时使用认证密钥
+	MAC   string `json:"mac"`             // 使用认证密钥对随机数计算的HMAC
+}
+
+// AuthResult represents authentication result
+type AuthResult struct {
+	Success bool   `json:"success"` // 是否认证成功
+	Message string `json:"message"` // 消息
 }
 
 // SyncRequest represents synchronization request
@@ -174,9 +398,10 @@ type SyncResponse struct {
 
 // FileTransferRequest represents file transfer request
 type FileTransferRequest struct {
-	FilePath  string `json:"file_path"`  // 文件路径
-	ChunkSize int    `json:"chunk_size"` // 分块大小
-	Offset    int64  `json:"offset"`     // 传输偏移量
+	FilePath  string `json:"file_path"`     // 文件路径
+	ChunkSize int    `json:"chunk_size"`    // 分块大小
+	Offset    int64  `json:"offset"`        // 传输偏移量
+	MD5       string `json:"md5,omitempty"` // 续传时已接收部分对应的文件MD5, 不一致时从头传输
 }
 
 // FileTransferResponse represents file transfer response
@@ -190,16 +415,22 @@ type FileTransferResponse struct {
 }
 
 // ErrorResponse represents error response
+// 也用于服务器繁忙响应和关闭通知, success和message与成功响应的字段相同, 旧版客户端也能识别为失败
 type ErrorResponse struct {
-	Code    string `json:"code"`    // 错误代码
-	Message string `json:"message"` // 错误消息
+	Success    bool   `json:"success"`               // 始终为false
+	Code       string `json:"code"`                  // 错误代码, 取值见pkg/errors
+	Message    string `json:"message"`               // 错误消息
+	Retryable  bool   `json:"retryable"`             // 是否可以稍后重试
+	RetryAfter int    `json:"retry_after,omitempty"` // 建议的重试等待时间(秒)
 }
 
 // FileMessageInfo represents file message information
 type FileMessageInfo struct {
-	Name string `json:"name"` // 文件名
-	Size int64  `json:"size"` // 文件大小
-	MD5  string `json:"md5"`  // 文件MD5值
+	Name   string `json:"name"`   // 文件名
+	Size   int64  `json:"size"`   // 文件大小
+	MD5    string `json:"md5"`    // 文件MD5值
+	Path   string `json:"path"`   // 文件相对路径
+	Offset int64  `json:"offset"` // 本次传输的起始偏移量
 }
 
 // FileDataChunk represents file data chunk
@@ -0,0 +1,26 @@
+// Package testutil 测试共用的辅助实现, 只由测试代码引用
+package testutil
+
+import "synctools/codes/internal/interfaces"
+
+// NopLogger 丢弃所有日志的记录器
+type NopLogger struct{}
+
+// NewNopLogger 创建丢弃所有日志的记录器
+func NewNopLogger() *NopLogger {
+	return &NopLogger{}
+}
+
+func (*NopLogger) Debug(string, interfaces.Fields) {}
+func (*NopLogger) Info(string, interfaces.Fields)  {}
+func (*NopLogger) Warn(string, interfaces.Fields)  {}
+func (*NopLogger) Error(string, interfaces.Fields) {}
+func (*NopLogger) Fatal(string, interfaces.Fields) {}
+
+// WithFields 添加字段, 仍然丢弃所有日志
+func (l *NopLogger) WithFields(interfaces.Fields) interfaces.Logger { return l }
+
+func (*NopLogger) SetLevel(interfaces.LogLevel)  {}
+func (*NopLogger) GetLevel() interfaces.LogLevel { return interfaces.INFO }
+func (*NopLogger) SetDebugMode(bool)             {}
+func (*NopLogger) GetDebugMode() bool            { return false }
@@ -1,8 +1,11 @@
 package viewmodels
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"path/filepath"
+	"time"
 
 	"synctools/codes/internal/interfaces"
 )
@@ -42,8 +45,9 @@ func (vm *MainViewModel) Connect() error {
 	return nil
 }
 
-// Disconnect 断开连接
+// Disconnect 断开连接, 先取消进行中的同步
 func (vm *MainViewModel) Disconnect() error {
+	vm.CancelSync()
 	return vm.syncService.Disconnect()
 }
 
@@ -53,8 +57,10 @@ func (vm *MainViewModel) IsConnected() bool {
 }
 
 // handleConnectionLost 处理连接丢失
-func (vm *MainViewModel) handleConnectionLost() {
-	vm.logger.Warn("连接丢失", interfaces.Fields{})
+func (vm *MainViewModel) handleConnectionLost(err error) {
+	vm.logger.Warn("连接丢失", interfaces.Fields{
+		"error": err,
+	})
 	vm.UpdateUIState()
 }
 
@@ -74,8 +80,16 @@ func (vm *MainViewModel) SyncFiles(path string) error {
 		return err
 	}
 
-	// 开始同步
-	if err := vm.syncService.SyncFiles(absPath); err != nil {
+	// 开始同步, 关闭窗口或断开连接时取消
+	ctx, done := vm.beginSync()
+	defer done()
+	if err := vm.syncService.SyncFiles(ctx, absPath); err != nil {
+		if errors.Is(err, context.Canceled) {
+			vm.logger.Info("同步已取消", interfaces.Fields{
+				"path": absPath,
+			})
+			return nil
+		}
 		vm.logger.Error("同步文件失败", interfaces.Fields{
 			"path":  absPath,
 			"error": err,
@@ -88,3 +102,47 @@ func (vm *MainViewModel) SyncFiles(path string) error {
 	})
 	return nil
 }
+
+// syncCancelTimeout 取消同步后等待正在写入的文件完成替换或清理的时间
+const syncCancelTimeout = 5 * time.Second
+
+// beginSync 登记进行中的同步, 返回同步使用的上下文和同步结束时调用的函数
+func (vm *MainViewModel) beginSync() (context.Context, func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	vm.syncMu.Lock()
+	vm.syncCancel = cancel
+	vm.syncDone = done
+	vm.syncMu.Unlock()
+
+	return ctx, func() {
+		vm.syncMu.Lock()
+		vm.syncCancel = nil
+		vm.syncDone = nil
+		vm.syncMu.Unlock()
+		cancel()
+		close(done)
+	}
+}
+
+// CancelSync 取消进行中的同步并等待同步结束
+// 取消后每个本地文件保持原样或已完整更新, 超过等待时间时不再等待
+func (vm *MainViewModel) CancelSync() {
+	vm.syncMu.Lock()
+	cancel, done := vm.syncCancel, vm.syncDone
+	vm.syncMu.Unlock()
+	if cancel == nil {
+		return
+	}
+
+	vm.logger.Info("取消同步", interfaces.Fields{})
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(syncCancelTimeout):
+		vm.logger.Warn("等待同步结束超时", interfaces.Fields{
+			"timeout": syncCancelTimeout.String(),
+		})
+	}
+}
@@ -16,6 +16,9 @@
 package viewmodels
 
 import (
+	"context"
+	"sync"
+
 	"github.com/lxn/walk"
 
 	"synctools/codes/internal/interfaces"
@@ -56,6 +59,11 @@ type MainViewModel struct {
 
 	// UI 更新回调
 	onUIUpdate func()
+
+	// 进行中的同步
+	syncMu     sync.Mutex
+	syncCancel context.CancelFunc // 取消进行中的同步, 未同步时为nil
+	syncDone   chan struct{}      // 同步结束信号
 }
 
 //
@@ -169,6 +177,7 @@ func (vm *MainViewModel) Initialize(window *walk.MainWindow) error {
 
 // Shutdown 关闭视图模型
 func (vm *MainViewModel) Shutdown() error {
+	vm.CancelSync()
 	if vm.IsConnected() {
 		if err := vm.Disconnect(); err != nil {
 			vm.logger.Error("关闭时断开连接失败", interfaces.Fields{
@@ -76,6 +76,9 @@ func (t *ClientTab) Setup() error {
 											Label{Text: "服务器地址:"},
 											LineEdit{
 												AssignTo: &t.addressEdit,
+												ToolTipText: "输入服务器地址\n" +
+													"带 http:// 或 https:// 前缀时使用HTTP传输, 例如: http://example.com\n" +
+													"从静态导出同步时填写导出目录或清单地址, 例如: file:///D:/export 或 https://example.com/pack/manifest.json",
 											},
 											Label{Text: "端口:"},
 											LineEdit{
@@ -32,6 +32,9 @@ func handleWindowClosing(viewModel *viewmodels.MainViewModel, logger interfaces.
 
 	logger.Debug("窗口正在关闭", interfaces.Fields{})
 
+	// 取消进行中的同步, 避免退出时留下写了一半的文件
+	viewModel.CancelSync()
+
 	// 断开连接
 	if viewModel.IsConnected() {
 		if err := viewModel.Disconnect(); err != nil {
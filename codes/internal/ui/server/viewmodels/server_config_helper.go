@@ -193,8 +193,9 @@ func (vm *ConfigViewModel) AddSyncFolder(path string, mode interfaces.SyncMode,
 
 	// 创建新的同步文件夹
 	folder := interfaces.SyncFolder{
-		Path:     path,
-		SyncMode: mode,
+		Path:      path,
+		SyncMode:  mode,
+		IsEnabled: true,
 	}
 
 	// 添加到列表
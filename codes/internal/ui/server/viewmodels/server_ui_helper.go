@@ -107,49 +107,34 @@ func (vm *ConfigViewModel) collectConfigFromUI() *interfaces.Config {
 		config = &interfaces.Config{}
 	}
 
-	// 创建新的配置对象
-	newConfig := &interfaces.Config{
-		UUID:            config.UUID,
-		Type:            interfaces.ConfigTypeServer,
-		SyncFolders:     config.SyncFolders,
-		FolderRedirects: config.FolderRedirects,
-	}
+	// 从当前配置复制, 只覆盖界面上编辑的字段, 界面上没有的认证、TLS、限速等设置保持不变
+	copied := *config
+	newConfig := &copied
+	newConfig.Type = interfaces.ConfigTypeServer
 
 	// 安全地获取 UI 值
 	if vm.nameEdit != nil {
 		newConfig.Name = vm.nameEdit.Text()
-	} else {
-		newConfig.Name = config.Name
 	}
 
 	if vm.versionEdit != nil {
 		newConfig.Version = vm.versionEdit.Text()
-	} else {
-		newConfig.Version = config.Version
 	}
 
 	if vm.hostEdit != nil {
 		newConfig.Host = vm.hostEdit.Text()
-	} else {
-		newConfig.Host = config.Host
 	}
 
 	if vm.portEdit != nil {
 		newConfig.Port = vm.getPortFromUI()
-	} else {
-		newConfig.Port = config.Port
 	}
 
 	if vm.syncDirEdit != nil {
 		newConfig.SyncDir = vm.syncDirEdit.Text()
-	} else {
-		newConfig.SyncDir = config.SyncDir
 	}
 
 	if vm.ignoreEdit != nil {
 		newConfig.IgnoreList = vm.getIgnoreListFromUI()
-	} else {
-		newConfig.IgnoreList = config.IgnoreList
 	}
 
 	return newConfig
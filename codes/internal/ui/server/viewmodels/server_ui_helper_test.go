@@ -0,0 +1,85 @@
+package viewmodels
+
+import (
+	"reflect"
+	"testing"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/internal/testutil"
+)
+
+// testLineEdit 只保存文本的输入框
+type testLineEdit struct {
+	text string
+}
+
+func (e *testLineEdit) Text() string              { return e.text }
+func (e *testLineEdit) SetText(text string) error { e.text = text; return nil }
+func (e *testLineEdit) SetEnabled(bool)           {}
+
+// testServerService 返回固定配置并记录保存的配置的服务端同步服务
+type testServerService struct {
+	interfaces.ServerSyncService
+	config *interfaces.Config
+	saved  *interfaces.Config
+}
+
+func (s *testServerService) GetCurrentConfig() *interfaces.Config { return s.config }
+
+func (s *testServerService) SaveConfig(config *interfaces.Config) error {
+	s.saved = config
+	return nil
+}
+
+// TestSaveConfigKeepsFields 界面保存配置时只修改界面上编辑的字段, 界面上没有的设置保持不变
+func TestSaveConfigKeepsFields(t *testing.T) {
+	tests := []struct {
+		name   string
+		config interfaces.Config
+	}{
+		{"auth secret", interfaces.Config{AuthSecret: "secret"}},
+		{"access tokens", interfaces.Config{AccessTokens: []interfaces.AccessToken{
+			{Name: "reader", Secret: "r", Folders: []string{"mods"}},
+			{Name: "old", Secret: "o", CanWrite: true, Revoked: true},
+		}}},
+		{"tls", interfaces.Config{TLS: interfaces.TLSConfig{Enabled: true, CertFile: "server.crt", KeyFile: "server.key"}}},
+		{"heartbeat", interfaces.Config{HeartbeatInterval: 5, HeartbeatMisses: 4}},
+		{"bandwidth", interfaces.Config{UploadLimit: 1024, ClientUploadLimit: 256}},
+		{"connection limits", interfaces.Config{MaxConnections: 50, MaxConnectionsPerIP: 2, MaxRequestsPerClient: 4, RequestQueueSize: 8}},
+		{"shutdown timeout", interfaces.Config{ShutdownTimeout: 60}},
+		{"watch interval", interfaces.Config{WatchInterval: 30}},
+		{"http port", interfaces.Config{HTTPPort: 8081}},
+		{"discovery", interfaces.Config{Discovery: true}},
+		{"listeners", interfaces.Config{Listeners: []interfaces.ListenerConfig{
+			{Name: "local", Network: "unix", Address: "/run/synctools.sock", Auth: interfaces.ListenerAuthNone, LocalOnly: true},
+			{Name: "lan", Address: ":8443", TLS: true, Auth: interfaces.ListenerAuthSecret, HTTP: true},
+		}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			current := tt.config
+			current.UUID = "server"
+			current.Type = interfaces.ConfigTypeServer
+			current.Name = "整合包"
+			current.Port = 8080
+
+			service := &testServerService{config: &current}
+			vm := &ConfigViewModel{
+				syncService: service,
+				logger:      testutil.NewNopLogger(),
+				nameEdit:    &testLineEdit{text: "新整合包"},
+				portEdit:    &testLineEdit{text: "9090"},
+			}
+			if err := vm.SaveConfig(); err != nil {
+				t.Fatal(err)
+			}
+
+			want := current
+			want.Name = "新整合包"
+			want.Port = 9090
+			if !reflect.DeepEqual(service.saved, &want) {
+				t.Errorf("保存的配置错误:\n期望 %+v\n实际 %+v", want, *service.saved)
+			}
+		})
+	}
+}
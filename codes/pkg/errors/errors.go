@@ -1,16 +1,19 @@
 package errors
 
 import (
+	stderrors "errors"
 	"fmt"
 	"net"
+	"time"
 )
 
 // 错误码常量定义
 const (
 	// Common error codes
-	CodeInternal = "INTERNAL"
-	CodeInvalid  = "INVALID"
-	CodeNotFound = "NOT_FOUND"
+	CodeInternal  = "INTERNAL"
+	CodeInvalid   = "INVALID"
+	CodeNotFound  = "NOT_FOUND"
+	CodeForbidden = "FORBIDDEN"
 
 	// Network error codes
 	CodeNetworkConnect     = "NETWORK_001"
@@ -43,9 +46,11 @@ const (
 
 // Error 基础错误类型
 type Error struct {
-	Code    string // 错误代码
-	Message string // 错误消息
-	Cause   error  // 原始错误
+	Code       string        // 错误代码
+	Message    string        // 错误消息
+	Cause      error         // 原始错误
+	Retryable  bool          // 是否可以稍后重试
+	RetryAfter time.Duration // 建议的重试等待时间
 }
 
 func (e *Error) Error() string {
@@ -55,6 +60,17 @@ func (e *Error) Error() string {
 	return fmt.Sprintf("%s: %s", e.Code, e.Message)
 }
 
+// Is 错误代码相同即视为同一错误, 可用预定义错误实例判断错误类型
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// Unwrap 获取原始错误
+func (e *Error) Unwrap() error {
+	return e.Cause
+}
+
 // NetworkError 网络错误类型
 type NetworkError struct {
 	Op      string // 操作名称
@@ -100,9 +116,10 @@ func (e *StorageError) Error() string {
 // 预定义错误实例
 var (
 	// Common errors
-	ErrInternal = &Error{Code: CodeInternal, Message: "内部错误"}
-	ErrInvalid  = &Error{Code: CodeInvalid, Message: "无效的参数"}
-	ErrNotFound = &Error{Code: CodeNotFound, Message: "资源未找到"}
+	ErrInternal  = &Error{Code: CodeInternal, Message: "内部错误"}
+	ErrInvalid   = &Error{Code: CodeInvalid, Message: "无效的参数"}
+	ErrNotFound  = &Error{Code: CodeNotFound, Message: "资源未找到"}
+	ErrForbidden = &Error{Code: CodeForbidden, Message: "没有权限"}
 
 	// Network errors
 	ErrNetworkConnect = &Error{
@@ -218,6 +235,17 @@ func NewError(code string, message string, cause error) *Error {
 	}
 }
 
+// NewRetryableError 创建可以稍后重试的错误, retryAfter为建议的重试等待时间
+func NewRetryableError(code string, message string, retryAfter time.Duration, cause error) *Error {
+	return &Error{
+		Code:       code,
+		Message:    message,
+		Cause:      cause,
+		Retryable:  true,
+		RetryAfter: retryAfter,
+	}
+}
+
 func NewNetworkError(op, message string, err error) *NetworkError {
 	return &NetworkError{
 		Op:      op,
@@ -235,6 +263,32 @@ func NewStorageError(op, message string, err error) *StorageError {
 }
 
 // 错误判断函数
+func Is(err, target error) bool {
+	return stderrors.Is(err, target)
+}
+
+func As(err error, target interface{}) bool {
+	return stderrors.As(err, target)
+}
+
+// IsRetryable 检查错误是否可以稍后重试
+func IsRetryable(err error) bool {
+	var e *Error
+	if stderrors.As(err, &e) {
+		return e.Retryable
+	}
+	return IsTimeout(err) || IsTemporary(err)
+}
+
+// GetRetryAfter 获取建议的重试等待时间, 没有建议时返回0
+func GetRetryAfter(err error) time.Duration {
+	var e *Error
+	if stderrors.As(err, &e) {
+		return e.RetryAfter
+	}
+	return 0
+}
+
 func IsNetworkError(err error) bool {
 	_, ok := err.(*NetworkError)
 	return ok
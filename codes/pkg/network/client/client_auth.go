@@ -0,0 +1,43 @@
+package client
+
+import (
+	"context"
+	"fmt"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/network/security"
+)
+
+// authenticate 完成认证挑战, 服务器未启用认证时直接返回
+// 配置了访问令牌时, 认证密钥为该令牌的密钥; 密钥不在网络上传输, 只发送对服务器随机数计算的HMAC
+func (c *NetworkClient) authenticate(ctx context.Context) error {
+	var challenge interfaces.AuthChallenge
+	if err := c.Request(ctx, "auth_challenge", struct{}{}, &challenge); err != nil {
+		return fmt.Errorf("请求认证失败: %w", err)
+	}
+	if !challenge.Required {
+		return nil
+	}
+
+	config := c.syncService.GetCurrentConfig()
+	if config.AuthSecret == "" {
+		return fmt.Errorf("服务器要求认证, 请在配置中填写认证密钥")
+	}
+
+	response := interfaces.AuthResponse{
+		Token: config.AuthToken,
+		MAC:   security.ComputeAuthMAC(config.AuthSecret, challenge.Nonce, config.UUID),
+	}
+
+	// 认证失败时服务器直接关闭连接, 不返回结果
+	var result interfaces.AuthResult
+	if err := c.Request(ctx, "auth_response", response, &result); err != nil {
+		return fmt.Errorf("认证失败, 请检查认证密钥: %w", err)
+	}
+	if !result.Success {
+		return fmt.Errorf("认证失败: %s", result.Message)
+	}
+
+	c.logger.Info("认证成功", interfaces.Fields{})
+	return nil
+}
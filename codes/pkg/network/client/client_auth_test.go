@@ -0,0 +1,85 @@
+package client
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/internal/testutil"
+	"synctools/codes/pkg/network/message"
+	server "synctools/codes/pkg/network/server"
+)
+
+// TestAuthenticate 客户端用认证密钥或访问令牌的密钥应答服务器的认证挑战, 密钥错误或缺失时握手失败
+func TestAuthenticate(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	s := server.NewServer(&interfaces.Config{
+		Host:         "127.0.0.1",
+		Port:         port,
+		SyncDir:      t.TempDir(),
+		AuthSecret:   "secret",
+		AccessTokens: []interfaces.AccessToken{{Name: "reader", Secret: "token-secret"}},
+	}, testServerService{}, testutil.NewNopLogger())
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	tests := []struct {
+		name    string
+		secret  string
+		token   string
+		wantErr string // 为空时期望握手成功
+	}{
+		{"secret", "secret", "", ""},
+		{"token", "token-secret", "reader", ""},
+		{"wrong secret", "wrong", "", "认证失败"},
+		{"token with server secret", "secret", "reader", "认证失败"},
+		{"revoked token", "token-secret", "writer", "认证失败"},
+		{"missing secret", "", "", "请在配置中填写认证密钥"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewNetworkClient(testutil.NewNopLogger(), &testSyncService{config: &interfaces.Config{
+				UUID:       "test",
+				AuthSecret: tt.secret,
+				AuthToken:  tt.token,
+			}})
+			if err := c.Connect("127.0.0.1", strconv.Itoa(port)); err != nil {
+				t.Fatal(err)
+			}
+			defer c.Disconnect()
+
+			_, _, err := c.SendInitMessage(context.Background(), &interfaces.InitRequest{UUID: "test"})
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("期望握手成功, 实际 %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("期望错误 %q, 实际 %v", tt.wantErr, err)
+			}
+		})
+	}
+
+	// 未认证的连接发送其他请求时被断开
+	conn, err := net.Dial("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	sender := message.NewMessageSender(testutil.NewNopLogger())
+	if err := sender.SendMessageWithID(conn, 1, message.MsgManifestRequest, "test", struct{}{}); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := sender.ReceiveMessage(conn); err == nil {
+		t.Errorf("未认证的请求应断开连接, 实际收到 %s", msg.Type)
+	}
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/network/message"
+)
+
+const (
+	// DefaultDiscoveryTimeout 默认收集服务器信标的时间
+	DefaultDiscoveryTimeout = 3 * time.Second
+	// discoveryProbeInterval 收集期间重发探测的间隔, 广播报文可能丢失
+	discoveryProbeInterval = time.Second
+)
+
+// DiscoverServers 在局域网中查找服务器, 在timeout内收集服务器信标
+// 向局域网广播探测, 服务器立即回复; 同时接收服务器定期广播的信标, 发现端口被占用时只依赖探测回复
+// 同一服务器从多个地址回复时分别列出, 结果按整合包名称和地址排序
+func DiscoverServers(logger interfaces.Logger, timeout time.Duration) ([]*interfaces.ServerBeacon, error) {
+	if timeout <= 0 {
+		timeout = DefaultDiscoveryTimeout
+	}
+
+	probeConn, err := net.ListenUDP("udp4", nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建发现连接失败: %v", err)
+	}
+	conns := []*net.UDPConn{probeConn}
+	if passiveConn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: message.DiscoveryPort}); err == nil {
+		conns = append(conns, passiveConn)
+	} else {
+		logger.Debug("监听局域网发现端口失败, 只接收探测回复", interfaces.Fields{
+			"port":  message.DiscoveryPort,
+			"error": err,
+		})
+	}
+
+	deadline := time.Now().Add(timeout)
+	var mu sync.Mutex
+	found := make(map[string]*interfaces.ServerBeacon)
+
+	var wg sync.WaitGroup
+	for _, conn := range conns {
+		conn.SetReadDeadline(deadline)
+		wg.Add(1)
+		go func(conn *net.UDPConn) {
+			defer wg.Done()
+			defer conn.Close()
+			buf := make([]byte, message.MaxDiscoveryPacket)
+			for {
+				n, from, err := conn.ReadFromUDP(buf)
+				if err != nil {
+					return
+				}
+				kind, beacon, err := message.DecodeDiscovery(buf[:n])
+				if err != nil || kind != message.DiscoveryBeacon {
+					continue
+				}
+
+				beacon.Address = from.IP.String()
+				mu.Lock()
+				if _, ok := found[beacon.UUID+"|"+beacon.Address]; !ok {
+					logger.Debug("发现服务器", interfaces.Fields{
+						"name":    beacon.Name,
+						"version": beacon.Version,
+						"address": beacon.Address,
+						"port":    beacon.Port,
+					})
+				}
+				found[beacon.UUID+"|"+beacon.Address] = beacon
+				mu.Unlock()
+			}
+		}(conn)
+	}
+
+	// 收集期间定期重发探测, 收集结束时读取超时, 接收协程退出
+	probe := message.EncodeProbe()
+	for time.Now().Before(deadline) {
+		for _, addr := range message.BroadcastAddrs(message.DiscoveryPort) {
+			probeConn.WriteToUDP(probe, addr)
+		}
+		wait := time.Until(deadline)
+		if wait > discoveryProbeInterval {
+			wait = discoveryProbeInterval
+		}
+		time.Sleep(wait)
+	}
+	wg.Wait()
+
+	servers := make([]*interfaces.ServerBeacon, 0, len(found))
+	for _, beacon := range found {
+		servers = append(servers, beacon)
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		if servers[i].Name != servers[j].Name {
+			return servers[i].Name < servers[j].Name
+		}
+		return servers[i].Address < servers[j].Address
+	})
+
+	logger.Info("局域网发现完成", interfaces.Fields{
+		"servers": len(servers),
+	})
+	return servers, nil
+}
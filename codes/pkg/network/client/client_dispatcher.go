@@ -0,0 +1,293 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/network/message"
+)
+
+// requestTimeout 等待响应的超时时间
+var requestTimeout = 30 * time.Second
+
+const (
+	// inboxSize 未携带请求ID的消息缓冲数量
+	inboxSize = 64
+	// streamBufferSize 单个文件传输缓冲的帧数, 缓冲满时分发暂停, 内存占用保持有界
+	streamBufferSize = 32
+	// throttleStep 下载限速时每段等待的字节数
+	throttleStep = 4 * 1024
+)
+
+// readLoop 持续读取连接上的帧并分发给等待的请求
+func (c *NetworkClient) readLoop(conn net.Conn, closed chan struct{}) {
+	// 连接关闭时停止限速等待
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-closed:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	for {
+		frame, err := c.msgSender.ReadFrame(conn)
+		if err != nil {
+			if err == io.EOF {
+				err = fmt.Errorf("服务器关闭了连接")
+			}
+			c.mu.Lock()
+			if c.conn == conn && c.shutdown != nil {
+				err = c.shutdown
+			}
+			c.mu.Unlock()
+			c.connectionLost(conn, err)
+			return
+		}
+		c.touch()
+
+		// 数据帧按流ID分发, 控制帧按消息中的请求ID分发
+		id := frame.Stream
+		if frame.Type == message.FrameControl {
+			msg, err := c.msgSender.DecodeMessage(frame)
+			if err != nil {
+				continue
+			}
+			if c.handleHeartbeat(conn, msg) {
+				continue
+			}
+			id = msg.ID
+		}
+
+		c.dispatch(id, frame, closed)
+		if frame.Type == message.FrameData {
+			c.lastData.Store(time.Now().UnixNano())
+			c.throttleDownload(ctx, message.FrameHeaderSize+len(frame.Payload))
+		}
+	}
+}
+
+// throttleDownload 按下载限速等待, 等待期间不读取连接
+// 限速很低时一帧的等待可能超过心跳和请求超时, 按小段等待并在每段后记录存活, 避免被误判为断开或超时
+func (c *NetworkClient) throttleDownload(ctx context.Context, n int) {
+	for n > 0 {
+		step := n
+		if step > throttleStep {
+			step = throttleStep
+		}
+		if err := c.downloadLimiter.Wait(ctx, step); err != nil {
+			return
+		}
+		c.touch()
+		c.lastData.Store(time.Now().UnixNano())
+		n -= step
+	}
+}
+
+// sinceLastData 距离上次收到文件数据或完成下载限速等待的时长
+func (c *NetworkClient) sinceLastData() time.Duration {
+	return time.Since(time.Unix(0, c.lastData.Load()))
+}
+
+// dispatch 将帧交给对应请求的通道
+func (c *NetworkClient) dispatch(id uint32, frame *message.Frame, closed chan struct{}) {
+	c.mu.Lock()
+	req, ok := c.pending[id]
+	c.mu.Unlock()
+
+	if !ok {
+		c.logger.Debug("丢弃无人等待的帧", interfaces.Fields{
+			"id":   id,
+			"type": frame.Type,
+		})
+		return
+	}
+
+	// 未携带请求ID的消息无人读取时丢弃, 避免阻塞其他请求
+	if id == 0 {
+		select {
+		case req.ch <- frame:
+		default:
+			c.logger.Warn("消息缓冲已满, 丢弃消息", interfaces.Fields{
+				"type": frame.Type,
+			})
+		}
+		return
+	}
+
+	// 请求注销后不再有人读取, 停止等待, 避免阻塞其他请求和心跳
+	select {
+	case req.ch <- frame:
+	case <-req.done:
+	case <-closed:
+	}
+}
+
+// pendingRequest 等待响应的请求
+type pendingRequest struct {
+	ch   chan *message.Frame // 接收分发给该请求的帧
+	done chan struct{}       // 请求注销时关闭
+}
+
+// newPendingRequest 创建等待响应的请求
+func newPendingRequest(bufferSize int) *pendingRequest {
+	return &pendingRequest{
+		ch:   make(chan *message.Frame, bufferSize),
+		done: make(chan struct{}),
+	}
+}
+
+// register 分配请求ID并注册接收通道
+func (c *NetworkClient) register(bufferSize int) (uint32, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.connected || c.conn == nil {
+		return 0, fmt.Errorf("未连接到服务器")
+	}
+
+	for {
+		c.nextID++
+		if c.nextID == 0 {
+			continue
+		}
+		if _, exists := c.pending[c.nextID]; !exists {
+			break
+		}
+	}
+	c.pending[c.nextID] = newPendingRequest(bufferSize)
+	return c.nextID, nil
+}
+
+// unregister 注销请求, 之后到达的帧将被丢弃
+func (c *NetworkClient) unregister(id uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if req, ok := c.pending[id]; ok {
+		delete(c.pending, id)
+		close(req.done)
+	}
+}
+
+// currentConn 获取当前连接
+func (c *NetworkClient) currentConn() (net.Conn, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected || c.conn == nil {
+		return nil, fmt.Errorf("未连接到服务器")
+	}
+	return c.conn, nil
+}
+
+// sendWithID 发送携带请求ID的消息
+func (c *NetworkClient) sendWithID(id uint32, msgType string, data interface{}) error {
+	conn, err := c.currentConn()
+	if err != nil {
+		return err
+	}
+	c.UpdateActivity()
+	config := c.syncService.GetCurrentConfig()
+	return c.msgSender.SendMessageWithID(conn, id, msgType, config.UUID, data)
+}
+
+// waitMessage 等待指定请求的下一条消息
+func (c *NetworkClient) waitMessage(ctx context.Context, id uint32) (*interfaces.Message, error) {
+	source, err := c.streamSource(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	frame, err := source.NextFrame()
+	if err != nil {
+		return nil, err
+	}
+	if frame.Type != message.FrameControl {
+		return nil, fmt.Errorf("收到意外的数据帧: 流 %d", frame.Stream)
+	}
+	return c.msgSender.DecodeMessage(frame)
+}
+
+// streamSource 创建读取指定请求帧的来源, 上下文取消时停止等待
+func (c *NetworkClient) streamSource(ctx context.Context, id uint32) (*streamFrameSource, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	req, ok := c.pending[id]
+	if !ok || c.closed == nil {
+		return nil, fmt.Errorf("未连接到服务器")
+	}
+	return &streamFrameSource{ctx: ctx, client: c, ch: req.ch, closed: c.closed}, nil
+}
+
+// closeConn 关闭连接并唤醒所有等待的请求
+// conn不为空时只在它仍是当前连接时关闭, 返回是否由本次调用关闭
+func (c *NetworkClient) closeConn(conn net.Conn, cause error) bool {
+	c.mu.Lock()
+	if c.conn == nil || (conn != nil && c.conn != conn) {
+		c.mu.Unlock()
+		return false
+	}
+	current := c.conn
+	c.conn = nil
+	c.connected = false
+	c.closeErr = cause
+	c.capabilities = nil
+	c.stats = c.stats.Add(c.msgSender.Stats(current))
+	close(c.closed)
+	c.mu.Unlock()
+
+	if err := current.Close(); err != nil {
+		c.logger.Error("关闭连接失败", interfaces.Fields{"error": err})
+	}
+	c.msgSender.Release(current)
+	return true
+}
+
+// streamFrameSource 从分发器读取单个请求的帧
+type streamFrameSource struct {
+	ctx    context.Context
+	client *NetworkClient
+	ch     chan *message.Frame
+	closed chan struct{}
+}
+
+// NextFrame 读取下一帧, 连接关闭、上下文取消或超时未收到数据时返回错误
+// 连接上仍有文件数据在传输时不判定超时, 限速或多个传输共享带宽时单个请求可能长时间收不到数据
+func (s *streamFrameSource) NextFrame() (*message.Frame, error) {
+	// 优先取出已缓冲的帧, 连接关闭前到达的数据仍然有效
+	select {
+	case frame := <-s.ch:
+		s.client.UpdateActivity()
+		return frame, nil
+	default:
+	}
+
+	timer := time.NewTimer(requestTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case frame := <-s.ch:
+			s.client.UpdateActivity()
+			return frame, nil
+		case <-s.closed:
+			s.client.mu.Lock()
+			err := s.client.closeErr
+			s.client.mu.Unlock()
+			return nil, fmt.Errorf("连接已关闭: %v", err)
+		case <-s.ctx.Done():
+			return nil, s.ctx.Err()
+		case <-timer.C:
+			idle := s.client.sinceLastData()
+			if idle >= requestTimeout {
+				return nil, fmt.Errorf("等待服务器响应超时")
+			}
+			timer.Reset(requestTimeout - idle)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/internal/testutil"
+	"synctools/codes/pkg/network/message"
+)
+
+// testSyncService 只提供配置的客户端同步服务
+type testSyncService struct {
+	interfaces.ClientSyncService
+	config *interfaces.Config
+}
+
+func (s *testSyncService) GetCurrentConfig() *interfaces.Config { return s.config }
+
+// serveTestConn 模拟不支持取消请求的服务器, 文件请求在后台持续发送直到结束
+func serveTestConn(conn net.Conn, dir string) {
+	sender := message.NewMessageSender(testutil.NewNopLogger())
+	sender.StartWriter(conn, 64)
+	for {
+		msg, err := sender.ReceiveMessage(conn)
+		if err != nil {
+			return
+		}
+		switch msg.Type {
+		case "auth_challenge":
+			sender.SendMessageWithID(conn, msg.ID, "auth_challenge", "", interfaces.AuthChallenge{})
+		case "init":
+			var req interfaces.InitRequest
+			json.Unmarshal(msg.Payload, &req)
+			local := []string{message.CapChunkedTransfer, message.CapMultiplex, message.CapHashMD5}
+			sender.SendMessageWithID(conn, msg.ID, "init_response", "", interfaces.InitResponse{
+				Success:         true,
+				ProtocolVersion: message.ProtocolVersion,
+				Capabilities:    message.NegotiateCapabilities(local, req.Capabilities),
+			})
+		case "file_request":
+			var req interfaces.FileTransferRequest
+			json.Unmarshal(msg.Payload, &req)
+			go sender.SendFileChunked(context.Background(), conn, msg.ID, "", filepath.Join(dir, req.FilePath), &req, nil)
+		case "list_request":
+			sender.SendMessageWithID(conn, msg.ID, "list_response", "", map[string]bool{"success": true})
+		}
+	}
+}
+
+// TestCancelledRequestDoesNotBlockConnection 取消的请求不再读取数据时, 同一连接上的其他请求仍能完成
+func TestCancelledRequestDoesNotBlockConnection(t *testing.T) {
+	dir := t.TempDir()
+	data := make([]byte, 1<<20)
+	rand.Read(data)
+	if err := os.WriteFile(filepath.Join(dir, "big.bin"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		serveTestConn(conn, dir)
+	}()
+
+	c := NewNetworkClient(testutil.NewNopLogger(), &testSyncService{config: &interfaces.Config{UUID: "test"}})
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	if err := c.Connect(host, port); err != nil {
+		t.Fatal(err)
+	}
+	defer c.Disconnect()
+	if _, _, err := c.SendInitMessage(context.Background(), &interfaces.InitRequest{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 进度通道不读取, 接收方停在第一次进度报告上, 分发器的缓冲随之填满
+	ctx, cancel := context.WithCancel(context.Background())
+	progress := make(chan interfaces.Progress)
+	done := make(chan error, 1)
+	go func() {
+		req := &interfaces.FileTransferRequest{FilePath: "big.bin", ChunkSize: 4096}
+		done <- c.RequestFile(ctx, req, filepath.Join(t.TempDir(), "big.bin"), progress)
+	}()
+	time.Sleep(200 * time.Millisecond)
+	cancel()
+	go func() {
+		for range progress {
+		}
+	}()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("期望取消错误, 实际 %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("取消的下载没有返回")
+	}
+	close(progress)
+
+	reqCtx, reqCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer reqCancel()
+	var resp map[string]bool
+	if err := c.Request(reqCtx, "list_request", interfaces.SyncRequest{Path: "."}, &resp); err != nil {
+		t.Fatalf("取消下载后的请求失败: %v", err)
+	}
+	if !resp["success"] {
+		t.Fatal("响应内容错误")
+	}
+}
@@ -0,0 +1,111 @@
+package client
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/network/message"
+)
+
+// idleTimeout 无操作自动断开的时间, 正在同步时不计入
+const idleTimeout = 3 * time.Minute
+
+// touch 记录收到服务器数据的时间
+func (c *NetworkClient) touch() {
+	c.lastRecv.Store(time.Now().UnixNano())
+}
+
+// sinceLastRecv 距离上次收到服务器数据的时长
+func (c *NetworkClient) sinceLastRecv() time.Duration {
+	return time.Since(time.Unix(0, c.lastRecv.Load()))
+}
+
+// monitorConnection 定期发送心跳并检查连接状态
+// 连续多次未收到服务器数据时判定连接断开, 长时间无操作时主动断开
+func (c *NetworkClient) monitorConnection(conn net.Conn, closed chan struct{}) {
+	interval, misses := message.HeartbeatSettings(c.syncService.GetCurrentConfig())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-closed:
+			return
+		case <-ticker.C:
+		}
+
+		if silence := c.sinceLastRecv(); silence > interval*time.Duration(misses) {
+			c.connectionLost(conn, fmt.Errorf("心跳超时: %s 内未收到服务器数据", silence.Round(time.Second)))
+			return
+		}
+
+		if c.idleDuration() > idleTimeout {
+			c.logger.Info("检测到3分钟无操作，自动断开连接", interfaces.Fields{})
+			c.connectionLost(conn, fmt.Errorf("超过%s无操作, 自动断开连接", idleTimeout))
+			return
+		}
+
+		if err := c.msgSender.SendMessageWithID(conn, 0, message.MsgPing, "", nil); err != nil {
+			c.logger.Debug("发送心跳失败", interfaces.Fields{
+				"error": err,
+			})
+		}
+	}
+}
+
+// handleHeartbeat 处理心跳和连接级别的消息, 返回true表示消息已处理
+func (c *NetworkClient) handleHeartbeat(conn net.Conn, msg *interfaces.Message) bool {
+	switch msg.Type {
+	case message.MsgPing:
+		// 回复可能被正在发送的文件请求阻塞, 不占用读取循环
+		go func() {
+			if err := c.msgSender.SendMessageWithID(conn, msg.ID, message.MsgPong, "", nil); err != nil {
+				c.logger.Debug("回复心跳失败", interfaces.Fields{
+					"error": err,
+				})
+			}
+		}()
+		return true
+	case message.MsgPong:
+		return true
+	case message.MsgBusy:
+		// 未携带请求ID的繁忙响应表示服务器拒绝了本次连接
+		if msg.ID == 0 {
+			c.connectionLost(conn, message.ParseBusy(msg))
+			return true
+		}
+	case message.MsgShutdown:
+		// 服务器会在进行中的传输完成后断开, 之后的断开原因使用关闭通知
+		notice := message.ParseBusy(msg)
+		c.logger.Warn("服务器正在关闭", interfaces.Fields{
+			"notice": notice,
+		})
+		c.mu.Lock()
+		if c.conn == conn {
+			c.shutdown = notice
+		}
+		c.mu.Unlock()
+		return true
+	case message.MsgManifestChanged:
+		c.handleManifestChanged(msg)
+		return true
+	}
+	return false
+}
+
+// connectionLost 关闭连接并通知断开原因
+// 同一连接只通知一次, 主动断开的连接不通知
+func (c *NetworkClient) connectionLost(conn net.Conn, cause error) {
+	if !c.closeConn(conn, cause) {
+		return
+	}
+
+	c.logger.Warn("连接已丢失", interfaces.Fields{
+		"error": cause,
+	})
+	if c.onConnLost != nil {
+		c.onConnLost(cause)
+	}
+}
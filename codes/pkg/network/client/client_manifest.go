@@ -0,0 +1,47 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/network/message"
+)
+
+// SetManifestChangedCallback 设置服务器文件清单变化的回调
+func (c *NetworkClient) SetManifestChangedCallback(callback func(notice *interfaces.ManifestChanged)) {
+	c.onManifestChanged = callback
+}
+
+// RequestManifest 获取服务器当前的配置和文件清单, 无需重新握手
+func (c *NetworkClient) RequestManifest(ctx context.Context) (*interfaces.Config, map[string]map[string]string, error) {
+	var response interfaces.ManifestResponse
+	if err := c.Request(ctx, message.MsgManifestRequest, struct{}{}, &response); err != nil {
+		return nil, nil, fmt.Errorf("获取文件清单失败: %w", err)
+	}
+	if !response.Success {
+		return nil, nil, fmt.Errorf("获取文件清单失败: %s", response.Message)
+	}
+	return response.Config, response.MD5Map, nil
+}
+
+// handleManifestChanged 处理服务器推送的文件清单变化通知
+// 回调在单独的协程中执行, 不阻塞读取循环
+func (c *NetworkClient) handleManifestChanged(msg *interfaces.Message) {
+	var notice interfaces.ManifestChanged
+	if err := json.Unmarshal(msg.Payload, &notice); err != nil {
+		c.logger.Error("解析文件清单变化通知失败", interfaces.Fields{
+			"error": err,
+		})
+		return
+	}
+
+	c.logger.Info("服务器文件清单已变化", interfaces.Fields{
+		"version": notice.Version,
+		"reason":  notice.Reason,
+	})
+	if c.onManifestChanged != nil {
+		go c.onManifestChanged(&notice)
+	}
+}
@@ -1,9 +1,12 @@
 package client
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"synctools/codes/internal/interfaces"
@@ -17,22 +20,43 @@ type NetworkClient struct {
 	serverAddr  string
 	serverPort  string
 	connected   bool
-	onConnLost  func()
+	onConnLost  func(err error)
 	syncService interfaces.ClientSyncService
 	msgSender   *message.MessageSender
 	lastActive  time.Time // 添加最后活动时间
 	isSyncing   bool      // 添加同步状态标志
+
+	mu       sync.Mutex                 // 保护连接状态和等待中的请求
+	nextID   uint32                     // 上一个分配的请求ID
+	pending  map[uint32]*pendingRequest // 等待响应的请求, ID为0的请求接收未携带请求ID的消息
+	closed   chan struct{}              // 当前连接的关闭信号
+	closeErr error                      // 当前连接关闭的原因
+	shutdown error                      // 服务器发出的关闭通知, 连接随后断开时作为断开原因
+
+	lastRecv        atomic.Int64          // 最后收到服务器数据的时间(UnixNano)
+	lastData        atomic.Int64          // 最后收到文件数据或完成下载限速等待的时间(UnixNano)
+	capabilities    []string              // 握手协商出的共同功能
+	stats           message.TransferStats // 已关闭连接累计的传输统计
+	downloadLimiter *message.RateLimiter  // 下载限速
+	transferMu      sync.Mutex            // 未协商并发请求时串行化文件传输
+
+	onManifestChanged func(notice *interfaces.ManifestChanged) // 服务器文件清单变化回调
 }
 
 // NewNetworkClient 创建新的网络客户端
 func NewNetworkClient(logger interfaces.Logger, syncService interfaces.ClientSyncService) *NetworkClient {
+	msgSender := message.NewMessageSender(logger)
+	// 读取由后台循环持续进行, 超时改为在等待响应时计算
+	msgSender.SetReadTimeout(0)
+
 	return &NetworkClient{
-		logger:      logger,
-		connected:   false,
-		syncService: syncService,
-		msgSender:   message.NewMessageSender(logger),
-		lastActive:  time.Now(),
-		isSyncing:   false,
+		logger:          logger,
+		connected:       false,
+		syncService:     syncService,
+		msgSender:       msgSender,
+		lastActive:      time.Now(),
+		isSyncing:       false,
+		downloadLimiter: message.NewRateLimiter(0),
 	}
 }
 
@@ -43,27 +67,52 @@ func (c *NetworkClient) Connect(addr, port string) error {
 		"serverPort": port,
 	})
 
-	if addr == "" || port == "" {
+	// 地址可以带 tcp:// 前缀
+	server, err := ParseServerURL(addr, port)
+	if err != nil {
+		return err
+	}
+	if server.Scheme != SchemeTCP {
+		return fmt.Errorf("不是TCP服务器地址: %s", addr)
+	}
+	if server.Host == "" || server.Port == "" {
 		return fmt.Errorf("服务器地址或端口不能为空")
 	}
 
-	c.serverAddr = addr
-	c.serverPort = port
+	c.serverAddr = server.Host
+	c.serverPort = server.Port
 
 	// 建立连接，保留5秒的初始连接超时
-	serverAddr := fmt.Sprintf("%s:%s", addr, port)
-	conn, err := net.DialTimeout("tcp", serverAddr, 5*time.Second)
+	serverAddr := server.Address()
+	conn, err := c.dial(serverAddr)
 	if err != nil {
 		c.logger.Error("连接服务器失败", interfaces.Fields{"error": err})
-		return fmt.Errorf("连接服务器失败: %v", err)
+		// 保留代理错误, 便于上层区分代理问题和服务器问题
+		return fmt.Errorf("连接服务器失败: %w", err)
 	}
 
+	closed := make(chan struct{})
+	c.mu.Lock()
 	c.conn = conn
 	c.connected = true
+	c.closed = closed
+	c.closeErr = nil
+	c.shutdown = nil
+	c.pending = map[uint32]*pendingRequest{
+		0: newPendingRequest(inboxSize),
+	}
 	c.lastActive = time.Now()
+	c.mu.Unlock()
+	c.touch()
+
+	// 按配置限制下载速率, 由读取循环在分发数据帧后等待
+	if config := c.syncService.GetCurrentConfig(); config != nil {
+		c.downloadLimiter.SetRate(int64(config.DownloadLimit) * 1024)
+	}
 
-	// 启动无操作检测
-	go c.monitorInactivity()
+	// 启动响应分发和无操作检测
+	go c.readLoop(conn, closed)
+	go c.monitorConnection(conn, closed)
 	return nil
 }
 
@@ -74,108 +123,169 @@ func (c *NetworkClient) Disconnect() error {
 	}
 
 	c.logger.Debug("断开服务器连接", interfaces.Fields{})
-
-	if c.conn != nil {
-		if err := c.conn.Close(); err != nil {
-			c.logger.Error("关闭连接失败", interfaces.Fields{"error": err})
-		}
-		c.conn = nil
-	}
-
-	c.connected = false
+	c.closeConn(nil, fmt.Errorf("连接已断开"))
 	return nil
 }
 
 // IsConnected 检查是否已连接
 func (c *NetworkClient) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	return c.connected && c.conn != nil
 }
 
 // SendData 发送数据
 func (c *NetworkClient) SendData(msgType string, data interface{}) error {
-	if !c.IsConnected() {
-		return fmt.Errorf("未连接到服务器")
-	}
-	c.UpdateActivity()
-	config := c.syncService.GetCurrentConfig()
-	return c.msgSender.SendMessage(c.conn, msgType, config.UUID, data)
+	return c.sendWithID(0, msgType, data)
 }
 
 // ReceiveData 接收数据
+// 只接收未携带请求ID的消息, 请求的响应由 Request 接收
 func (c *NetworkClient) ReceiveData(v interface{}) error {
-	if !c.IsConnected() {
-		return fmt.Errorf("未连接到服务器")
-	}
 	c.UpdateActivity()
-	msg, err := c.msgSender.ReceiveMessage(c.conn)
+	msg, err := c.waitMessage(context.Background(), 0)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(msg.Payload, v)
+}
+
+// Request 发送请求并等待对应的响应
+// 同一连接上可以同时有多个请求在等待, 上下文取消时停止等待
+// 服务器返回错误响应时还原为带错误代码的错误
+func (c *NetworkClient) Request(ctx context.Context, msgType string, data interface{}, v interface{}) error {
+	id, err := c.register(1)
+	if err != nil {
+		return err
+	}
+	defer c.unregister(id)
+
+	if err := c.sendWithID(id, msgType, data); err != nil {
+		return err
+	}
+
+	msg, err := c.waitMessage(ctx, id)
 	if err != nil {
 		return err
 	}
+	if err := message.ParseError(msg); err != nil {
+		return err
+	}
+	if v == nil {
+		return nil
+	}
 	return json.Unmarshal(msg.Payload, v)
 }
 
 // SendFile 发送文件
-func (c *NetworkClient) SendFile(path string, progress chan<- interfaces.Progress) error {
-	if !c.IsConnected() {
-		return fmt.Errorf("未连接到服务器")
+func (c *NetworkClient) SendFile(ctx context.Context, path string, progress chan<- interfaces.Progress) error {
+	conn, err := c.currentConn()
+	if err != nil {
+		return err
 	}
 	c.UpdateActivity()
 	config := c.syncService.GetCurrentConfig()
-	return c.msgSender.SendFile(c.conn, config.UUID, path, progress)
+	return c.msgSender.SendFile(ctx, conn, config.UUID, path, progress)
 }
 
 // ReceiveFile 接收文件
-func (c *NetworkClient) ReceiveFile(destDir string, progress chan<- interfaces.Progress) error {
-	if !c.IsConnected() {
-		return fmt.Errorf("未连接到服务器")
+// 只接收未携带请求ID的文件, 请求的文件由 RequestFile 接收
+func (c *NetworkClient) ReceiveFile(ctx context.Context, destDir string, progress chan<- interfaces.Progress) error {
+	source, err := c.streamSource(ctx, 0)
+	if err != nil {
+		return err
 	}
 	c.UpdateActivity()
-	return c.msgSender.ReceiveFile(c.conn, destDir, progress)
+	return c.msgSender.ReceiveFileFrom(ctx, source, destDir, progress)
 }
 
-// SetConnectionLostCallback 设置连接丢失回调
-func (c *NetworkClient) SetConnectionLostCallback(callback func()) {
+// RequestFile 请求下载文件并接收到目标路径
+// 目标路径存在未完成的下载时从已接收的偏移量续传, 多个文件请求可以在同一连接上并发进行
+// 上下文取消时通知服务器停止发送, 已接收的临时数据保留, 下次下载时续传
+func (c *NetworkClient) RequestFile(ctx context.Context, req *interfaces.FileTransferRequest, destPath string, progress chan<- interfaces.Progress) error {
+	// 服务器不支持并发请求时逐个传输
+	if !c.HasCapability(message.CapMultiplex) {
+		c.transferMu.Lock()
+		defer c.transferMu.Unlock()
+	}
+
+	if c.HasCapability(message.CapResume) {
+		message.PrepareResume(destPath, req)
+	} else {
+		req.Offset = 0
+		req.MD5 = ""
+	}
+	if req.Offset > 0 {
+		c.logger.Info("续传文件", interfaces.Fields{
+			"file":   req.FilePath,
+			"offset": req.Offset,
+		})
+	}
+
+	id, err := c.register(streamBufferSize)
+	if err != nil {
+		return err
+	}
+	defer c.unregister(id)
+
+	source, err := c.streamSource(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := c.sendWithID(id, "file_request", req); err != nil {
+		return fmt.Errorf("发送下载请求失败: %v", err)
+	}
+
+	err = c.msgSender.ReceiveFileFrom(ctx, source, destPath, progress)
+	if ctx.Err() != nil {
+		c.cancelRequest(id)
+	}
+	return err
+}
+
+// cancelRequest 通知服务器停止处理请求, 服务器不支持取消时只丢弃之后到达的数据
+func (c *NetworkClient) cancelRequest(id uint32) {
+	if !c.HasCapability(message.CapCancel) {
+		return
+	}
+	if err := c.sendWithID(id, message.MsgCancelRequest, nil); err != nil {
+		c.logger.Debug("发送取消请求失败", interfaces.Fields{
+			"id":    id,
+			"error": err,
+		})
+	}
+}
+
+// SetConnectionLostCallback 设置连接丢失回调, 回调参数为断开原因
+func (c *NetworkClient) SetConnectionLostCallback(callback func(err error)) {
 	c.onConnLost = callback
 }
 
 // UpdateActivity 更新最后活动时间
 func (c *NetworkClient) UpdateActivity() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.lastActive = time.Now()
 }
 
 // SetSyncing 设置同步状态
 func (c *NetworkClient) SetSyncing(syncing bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 	c.isSyncing = syncing
 	if syncing {
-		c.UpdateActivity()
+		c.lastActive = time.Now()
 	}
 }
 
-// monitorInactivity 监控无操作状态
-func (c *NetworkClient) monitorInactivity() {
-	ticker := time.NewTicker(30 * time.Second) // 每30秒检查一次
-	defer ticker.Stop()
-
-	for range ticker.C {
-		if !c.IsConnected() {
-			return
-		}
-
-		// 如果正在同步，跳过检查
-		if c.isSyncing {
-			continue
-		}
-
-		// 如果超过3分钟没有活动，自动断开连接
-		if time.Since(c.lastActive) > 3*time.Minute {
-			c.logger.Info("检测到3分钟无操作，自动断开连接", interfaces.Fields{})
-			if c.onConnLost != nil {
-				c.onConnLost()
-			}
-			c.Disconnect()
-			return
-		}
+// idleDuration 获取无操作时长, 同步进行中视为一直活动
+func (c *NetworkClient) idleDuration() time.Duration {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.isSyncing {
+		return 0
 	}
+	return time.Since(c.lastActive)
 }
 
 // isTimeout 判断是否为超时错误
@@ -187,27 +297,81 @@ func isTimeout(err error) bool {
 }
 
 // SendInitMessage 发送初始化消息并接收响应
-func (c *NetworkClient) SendInitMessage(initData interface{}) (*interfaces.Config, map[string]map[string]string, error) {
-	// 发送初始化消息
-	if err := c.SendData("init", initData); err != nil {
-		return nil, nil, fmt.Errorf("发送初始化消息失败: %v", err)
+// 握手时附带本端协议版本和功能列表, 服务器返回双方共同支持的功能
+func (c *NetworkClient) SendInitMessage(ctx context.Context, initData *interfaces.InitRequest) (*interfaces.Config, map[string]map[string]string, error) {
+	// 先完成认证, 未认证的连接不会收到初始化响应
+	if err := c.authenticate(ctx); err != nil {
+		return nil, nil, err
 	}
 
-	// 接收服务器响应
-	var response struct {
-		Success bool                         `json:"success"`
-		Message string                       `json:"message"`
-		Config  *interfaces.Config           `json:"config"`
-		MD5Map  map[string]map[string]string `json:"md5_map"`
-	}
+	initData.ProtocolVersion = message.ProtocolVersion
+	initData.Capabilities = message.SupportedCapabilities()
 
-	if err := c.ReceiveData(&response); err != nil {
-		return nil, nil, fmt.Errorf("接收初始化响应失败: %v", err)
+	// 发送初始化消息
+	var response interfaces.InitResponse
+	if err := c.Request(ctx, "init", initData, &response); err != nil {
+		return nil, nil, fmt.Errorf("初始化请求失败: %w", err)
 	}
 
 	if !response.Success {
+		if response.Reject != nil {
+			return nil, nil, fmt.Errorf("服务器拒绝连接: %s", describeReject(response.Reject, response.Message))
+		}
 		return nil, nil, fmt.Errorf("服务器拒绝连接: %s", response.Message)
 	}
 
+	// 服务器返回的功能已是协商结果, 再与本端取交集以防服务器返回未知功能
+	capabilities := message.NegotiateCapabilities(message.SupportedCapabilities(), response.Capabilities)
+	if missing := message.MissingCapabilities(capabilities); len(missing) > 0 {
+		return nil, nil, fmt.Errorf("服务器缺少必需的功能: %v", missing)
+	}
+
+	c.mu.Lock()
+	c.capabilities = capabilities
+	if c.conn != nil {
+		c.msgSender.SetCompression(c.conn, message.HasCapability(capabilities, message.CapCompressDeflate))
+	}
+	c.mu.Unlock()
+
+	c.logger.Info("握手完成", interfaces.Fields{
+		"protocol":     response.ProtocolVersion,
+		"capabilities": capabilities,
+	})
+
 	return response.Config, response.MD5Map, nil
 }
+
+// describeReject 生成握手被拒绝的说明
+func describeReject(reject *interfaces.HandshakeReject, detail string) string {
+	switch reject.Reason {
+	case message.RejectProtocolVersion:
+		return fmt.Sprintf("协议版本不兼容, 客户端版本 %d, 服务器支持 %d-%d, 请更新程序",
+			message.ProtocolVersion, reject.MinVersion, reject.MaxVersion)
+	case message.RejectCapabilities:
+		return fmt.Sprintf("客户端缺少服务器要求的功能 %v, 请更新程序", reject.Missing)
+	default:
+		return detail
+	}
+}
+
+// TransferStats 获取累计的传输字节统计, 包括重连前的连接
+func (c *NetworkClient) TransferStats() message.TransferStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		return c.stats
+	}
+	return c.stats.Add(c.msgSender.Stats(c.conn))
+}
+
+// SetDownloadLimit 设置下载速率上限(KB/s), 0表示不限速, 连接中修改立即生效
+func (c *NetworkClient) SetDownloadLimit(kbps int) {
+	c.downloadLimiter.SetRate(int64(kbps) * 1024)
+}
+
+// HasCapability 检查当前连接是否协商了指定功能
+func (c *NetworkClient) HasCapability(capability string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return message.HasCapability(c.capabilities, capability)
+}
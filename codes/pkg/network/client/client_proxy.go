@@ -0,0 +1,383 @@
+package client
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+)
+
+// proxySchemeSOCKS5H 由代理解析域名的SOCKS5, 本实现总是把域名交给代理解析
+const proxySchemeSOCKS5H = "socks5h"
+
+// ProxyError 通过代理建立连接失败
+// 与服务器本身的连接错误区分, 便于提示检查代理设置
+type ProxyError struct {
+	Proxy string // 代理地址
+	Err   error  // 失败原因
+}
+
+func (e *ProxyError) Error() string {
+	return fmt.Sprintf("通过代理 %s 连接失败: %v", e.Proxy, e.Err)
+}
+
+func (e *ProxyError) Unwrap() error {
+	return e.Err
+}
+
+// proxyURL 获取连接服务器使用的代理, 不使用代理时返回nil
+// 未配置代理类型时按环境变量选择代理
+func proxyURL(config *interfaces.Config, serverAddr string) (*url.URL, error) {
+	if config == nil {
+		return proxyFromEnvironment(serverAddr)
+	}
+
+	proxy := config.Proxy
+	switch proxy.Type {
+	case interfaces.ProxyEnv:
+		return proxyFromEnvironment(serverAddr)
+	case interfaces.ProxyNone:
+		return nil, nil
+	case interfaces.ProxySOCKS5, interfaces.ProxyHTTP:
+		if proxy.Address == "" {
+			return nil, fmt.Errorf("代理地址不能为空")
+		}
+		u := &url.URL{Scheme: string(proxy.Type), Host: proxy.Address}
+		if proxy.Username != "" {
+			u.User = url.UserPassword(proxy.Username, proxy.Password)
+		}
+		return u, nil
+	default:
+		return nil, fmt.Errorf("不支持的代理类型: %s", proxy.Type)
+	}
+}
+
+// proxyFromEnvironment 按 ALL_PROXY、HTTPS_PROXY、HTTP_PROXY 的顺序选择代理
+// NO_PROXY 中的地址和本机地址直接连接
+func proxyFromEnvironment(serverAddr string) (*url.URL, error) {
+	host, _, err := net.SplitHostPort(serverAddr)
+	if err != nil {
+		host = serverAddr
+	}
+	if bypassProxy(host, getenv("NO_PROXY", "no_proxy")) {
+		return nil, nil
+	}
+
+	for _, names := range [][2]string{
+		{"ALL_PROXY", "all_proxy"},
+		{"HTTPS_PROXY", "https_proxy"},
+		{"HTTP_PROXY", "http_proxy"},
+	} {
+		value := getenv(names[0], names[1])
+		if value == "" {
+			continue
+		}
+		// 环境变量中的代理可以省略 http:// 前缀
+		if !strings.Contains(value, "://") {
+			value = "http://" + value
+		}
+		u, err := url.Parse(value)
+		if err != nil {
+			return nil, fmt.Errorf("环境变量 %s 中的代理地址格式错误: %v", names[0], err)
+		}
+		return u, nil
+	}
+	return nil, nil
+}
+
+// getenv 获取环境变量, 大写名称优先
+func getenv(upper, lower string) string {
+	if value := os.Getenv(upper); value != "" {
+		return value
+	}
+	return os.Getenv(lower)
+}
+
+// bypassProxy 检查主机是否直接连接
+// NO_PROXY 为逗号分隔的主机名、域名后缀、IP或CIDR, * 表示所有主机
+func bypassProxy(host, noProxy string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip != nil && ip.IsLoopback() {
+		return true
+	}
+
+	for _, entry := range strings.Split(noProxy, ",") {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if entry == "" {
+			continue
+		}
+		if entry == "*" {
+			return true
+		}
+		if _, cidr, err := net.ParseCIDR(entry); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		if h, _, err := net.SplitHostPort(entry); err == nil {
+			entry = h
+		}
+		entry = strings.TrimPrefix(strings.TrimPrefix(entry, "*"), ".")
+		name := strings.ToLower(host)
+		if name == entry || strings.HasSuffix(name, "."+entry) {
+			return true
+		}
+	}
+	return false
+}
+
+// httpProxy 生成HTTP传输使用的代理选择函数, 每个请求按当前配置选择
+func httpProxy(syncService interfaces.ClientSyncService) func(*http.Request) (*url.URL, error) {
+	return func(req *http.Request) (*url.URL, error) {
+		return proxyURL(syncService.GetCurrentConfig(), req.URL.Host)
+	}
+}
+
+// dialProxy 通过代理连接目标地址, 代理握手在timeout内完成
+func dialProxy(proxy *url.URL, target string, timeout time.Duration) (net.Conn, error) {
+	scheme := strings.ToLower(proxy.Scheme)
+	proxyAddr := proxy.Host
+	if proxy.Port() == "" {
+		switch scheme {
+		case string(interfaces.ProxySOCKS5), proxySchemeSOCKS5H:
+			proxyAddr = net.JoinHostPort(proxy.Hostname(), "1080")
+		case string(interfaces.ProxyHTTP):
+			proxyAddr = net.JoinHostPort(proxy.Hostname(), "80")
+		}
+	}
+
+	fail := func(err error) error {
+		return &ProxyError{Proxy: scheme + "://" + proxyAddr, Err: err}
+	}
+
+	var handshake func(conn net.Conn, proxy *url.URL, target string) (net.Conn, error)
+	switch scheme {
+	case string(interfaces.ProxySOCKS5), proxySchemeSOCKS5H:
+		handshake = socks5Connect
+	case string(interfaces.ProxyHTTP):
+		handshake = httpConnect
+	default:
+		return nil, fail(fmt.Errorf("不支持的代理类型: %s", proxy.Scheme))
+	}
+
+	conn, err := net.DialTimeout("tcp", proxyAddr, timeout)
+	if err != nil {
+		return nil, fail(err)
+	}
+
+	conn.SetDeadline(time.Now().Add(timeout))
+	tunnel, err := handshake(conn, proxy, target)
+	if err != nil {
+		conn.Close()
+		return nil, fail(err)
+	}
+	conn.SetDeadline(time.Time{})
+	return tunnel, nil
+}
+
+// SOCKS5协议常量
+const (
+	socks5Version      = 0x05
+	socks5AuthNone     = 0x00
+	socks5AuthPassword = 0x02
+	socks5AuthRejected = 0xff
+	socks5CmdConnect   = 0x01
+	socks5AddrIPv4     = 0x01
+	socks5AddrDomain   = 0x03
+	socks5AddrIPv6     = 0x04
+)
+
+// socks5Replies SOCKS5连接失败的原因
+var socks5Replies = map[byte]string{
+	0x01: "代理服务器内部错误",
+	0x02: "代理规则不允许连接",
+	0x03: "网络不可达",
+	0x04: "主机不可达",
+	0x05: "目标拒绝连接",
+	0x06: "连接超时",
+	0x07: "不支持的命令",
+	0x08: "不支持的地址类型",
+}
+
+// socks5Connect 完成SOCKS5握手, 配置了用户名时使用用户名密码认证
+// 目标地址为域名时交给代理解析, 服务器地址只在代理可达的网络中可解析时也能连接
+func socks5Connect(conn net.Conn, proxy *url.URL, target string) (net.Conn, error) {
+	host, portStr, err := net.SplitHostPort(target)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.Atoi(portStr)
+	if err != nil || port <= 0 || port > 65535 {
+		return nil, fmt.Errorf("无效的端口: %s", portStr)
+	}
+
+	methods := []byte{socks5AuthNone}
+	if proxy.User != nil {
+		methods = append(methods, socks5AuthPassword)
+	}
+	if _, err := conn.Write(append([]byte{socks5Version, byte(len(methods))}, methods...)); err != nil {
+		return nil, err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return nil, fmt.Errorf("读取代理响应失败: %v", err)
+	}
+	if reply[0] != socks5Version {
+		return nil, fmt.Errorf("代理服务器不是SOCKS5代理")
+	}
+	switch reply[1] {
+	case socks5AuthNone:
+	case socks5AuthPassword:
+		if proxy.User == nil {
+			return nil, fmt.Errorf("代理服务器要求用户名密码认证")
+		}
+		if err := socks5Authenticate(conn, proxy.User); err != nil {
+			return nil, err
+		}
+	case socks5AuthRejected:
+		return nil, fmt.Errorf("代理服务器不接受提供的认证方式")
+	default:
+		return nil, fmt.Errorf("代理服务器选择了不支持的认证方式: %d", reply[1])
+	}
+
+	request := []byte{socks5Version, socks5CmdConnect, 0x00}
+	if ip := net.ParseIP(host); ip != nil {
+		if ip4 := ip.To4(); ip4 != nil {
+			request = append(append(request, socks5AddrIPv4), ip4...)
+		} else {
+			request = append(append(request, socks5AddrIPv6), ip.To16()...)
+		}
+	} else {
+		if len(host) > 255 {
+			return nil, fmt.Errorf("主机名过长: %s", host)
+		}
+		request = append(append(request, socks5AddrDomain, byte(len(host))), host...)
+	}
+	request = binary.BigEndian.AppendUint16(request, uint16(port))
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	// 响应: 版本、结果、保留、地址类型, 之后是代理绑定的地址和端口
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(conn, header); err != nil {
+		return nil, fmt.Errorf("读取代理响应失败: %v", err)
+	}
+	if header[1] != 0x00 {
+		reason, ok := socks5Replies[header[1]]
+		if !ok {
+			reason = fmt.Sprintf("错误码 %d", header[1])
+		}
+		return nil, fmt.Errorf("代理无法连接 %s: %s", target, reason)
+	}
+
+	var skip int
+	switch header[3] {
+	case socks5AddrIPv4:
+		skip = net.IPv4len
+	case socks5AddrIPv6:
+		skip = net.IPv6len
+	case socks5AddrDomain:
+		length := make([]byte, 1)
+		if _, err := io.ReadFull(conn, length); err != nil {
+			return nil, fmt.Errorf("读取代理响应失败: %v", err)
+		}
+		skip = int(length[0])
+	default:
+		return nil, fmt.Errorf("代理响应的地址类型无效: %d", header[3])
+	}
+	if _, err := io.CopyN(io.Discard, conn, int64(skip+2)); err != nil {
+		return nil, fmt.Errorf("读取代理响应失败: %v", err)
+	}
+	return conn, nil
+}
+
+// socks5Authenticate 用户名密码认证(RFC 1929)
+func socks5Authenticate(conn net.Conn, user *url.Userinfo) error {
+	username := user.Username()
+	password, _ := user.Password()
+	if len(username) > 255 || len(password) > 255 {
+		return fmt.Errorf("代理用户名或密码过长")
+	}
+
+	request := []byte{0x01, byte(len(username))}
+	request = append(request, username...)
+	request = append(request, byte(len(password)))
+	request = append(request, password...)
+	if _, err := conn.Write(request); err != nil {
+		return err
+	}
+
+	reply := make([]byte, 2)
+	if _, err := io.ReadFull(conn, reply); err != nil {
+		return fmt.Errorf("读取代理认证响应失败: %v", err)
+	}
+	if reply[1] != 0x00 {
+		return fmt.Errorf("代理认证失败, 请检查代理用户名和密码")
+	}
+	return nil
+}
+
+// httpConnect 通过HTTP CONNECT建立隧道, 配置了用户名时使用Basic认证
+func httpConnect(conn net.Conn, proxy *url.URL, target string) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: target},
+		Host:   target,
+		Header: make(http.Header),
+	}
+	if proxy.User != nil {
+		password, _ := proxy.User.Password()
+		credentials := base64.StdEncoding.EncodeToString([]byte(proxy.User.Username() + ":" + password))
+		req.Header.Set("Proxy-Authorization", "Basic "+credentials)
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		return nil, fmt.Errorf("读取代理响应失败: %v", err)
+	}
+	resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusProxyAuthRequired:
+		return nil, fmt.Errorf("代理认证失败, 请检查代理用户名和密码")
+	case resp.StatusCode/100 != 2:
+		return nil, fmt.Errorf("代理拒绝连接 %s: %s", target, resp.Status)
+	}
+
+	// 代理可能在响应后紧接着转发了服务器的数据
+	if reader.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, reader: reader}, nil
+	}
+	return conn, nil
+}
+
+// bufferedConn 先读取握手时已缓冲的数据的连接
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+// Read 读取连接数据
+func (c *bufferedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
@@ -0,0 +1,228 @@
+package client
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeProxy 进程内的代理服务器, 握手成功后把隧道中的数据原样返回
+type fakeProxy struct {
+	listener net.Listener
+	targets  chan string // 客户端请求连接的目标地址
+}
+
+// startFakeProxy 启动代理服务器, handshake 完成握手并返回目标地址, 返回错误时关闭连接
+func startFakeProxy(t *testing.T, handshake func(conn net.Conn, reader *bufio.Reader) (string, error)) *fakeProxy {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := &fakeProxy{listener: ln, targets: make(chan string, 1)}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				reader := bufio.NewReader(conn)
+				target, err := handshake(conn, reader)
+				if err != nil {
+					return
+				}
+				p.targets <- target
+				io.Copy(conn, reader)
+			}()
+		}
+	}()
+	return p
+}
+
+// socks5Handshake 生成SOCKS5代理的握手, 设置用户名时要求用户名密码认证, reply 为连接结果
+func socks5Handshake(username, password string, reply byte) func(net.Conn, *bufio.Reader) (string, error) {
+	return func(conn net.Conn, reader *bufio.Reader) (string, error) {
+		header := make([]byte, 2)
+		if _, err := io.ReadFull(reader, header); err != nil {
+			return "", err
+		}
+		methods := make([]byte, header[1])
+		if _, err := io.ReadFull(reader, methods); err != nil {
+			return "", err
+		}
+
+		if username == "" {
+			conn.Write([]byte{socks5Version, socks5AuthNone})
+		} else {
+			if !strings.ContainsRune(string(methods), socks5AuthPassword) {
+				conn.Write([]byte{socks5Version, socks5AuthRejected})
+				return "", fmt.Errorf("不支持的认证方式")
+			}
+			conn.Write([]byte{socks5Version, socks5AuthPassword})
+			fields := make([]string, 2)
+			version, _ := reader.ReadByte()
+			for i := range fields {
+				length, _ := reader.ReadByte()
+				buf := make([]byte, length)
+				io.ReadFull(reader, buf)
+				fields[i] = string(buf)
+			}
+			if version != 0x01 || fields[0] != username || fields[1] != password {
+				conn.Write([]byte{0x01, 0x01})
+				return "", fmt.Errorf("认证失败")
+			}
+			conn.Write([]byte{0x01, 0x00})
+		}
+
+		request := make([]byte, 4)
+		if _, err := io.ReadFull(reader, request); err != nil {
+			return "", err
+		}
+		var host string
+		switch request[3] {
+		case socks5AddrIPv4, socks5AddrIPv6:
+			ip := make(net.IP, net.IPv4len)
+			if request[3] == socks5AddrIPv6 {
+				ip = make(net.IP, net.IPv6len)
+			}
+			io.ReadFull(reader, ip)
+			host = ip.String()
+		case socks5AddrDomain:
+			length, _ := reader.ReadByte()
+			buf := make([]byte, length)
+			io.ReadFull(reader, buf)
+			host = string(buf)
+		}
+		port := make([]byte, 2)
+		if _, err := io.ReadFull(reader, port); err != nil {
+			return "", err
+		}
+
+		// 绑定地址使用域名, 客户端需要跳过变长的地址
+		bound := append([]byte{socks5Version, reply, 0x00, socks5AddrDomain, 5}, "proxy"...)
+		conn.Write(append(bound, 0x04, 0x38))
+		if reply != 0x00 {
+			return "", fmt.Errorf("拒绝连接")
+		}
+		return net.JoinHostPort(host, fmt.Sprint(binary.BigEndian.Uint16(port))), nil
+	}
+}
+
+// connectHandshake 生成HTTP CONNECT代理的握手, 设置用户名时要求Basic认证
+// 握手成功后在响应之后紧接着发送 greeting, 模拟代理提前转发的服务器数据
+func connectHandshake(username, password, greeting string) func(net.Conn, *bufio.Reader) (string, error) {
+	return func(conn net.Conn, reader *bufio.Reader) (string, error) {
+		req, err := http.ReadRequest(reader)
+		if err != nil {
+			return "", err
+		}
+		if req.Method != http.MethodConnect {
+			conn.Write([]byte("HTTP/1.1 405 Method Not Allowed\r\n\r\n"))
+			return "", fmt.Errorf("不是CONNECT请求")
+		}
+		if username != "" {
+			credentials := base64.StdEncoding.EncodeToString([]byte(username + ":" + password))
+			if req.Header.Get("Proxy-Authorization") != "Basic "+credentials {
+				conn.Write([]byte("HTTP/1.1 407 Proxy Authentication Required\r\n\r\n"))
+				return "", fmt.Errorf("认证失败")
+			}
+		}
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n" + greeting))
+		return req.Host, nil
+	}
+}
+
+// TestDialProxy 通过SOCKS5和HTTP CONNECT代理建立隧道, 域名交给代理解析, 握手失败时返回代理错误
+func TestDialProxy(t *testing.T) {
+	const target = "sync.internal:25000"
+
+	tests := []struct {
+		name      string
+		scheme    string
+		handshake func(net.Conn, *bufio.Reader) (string, error)
+		user      *url.Userinfo
+		greeting  string // 代理在握手响应后紧接着转发的数据
+		wantErr   string // 为空时期望连接成功
+	}{
+		{"socks5", "socks5", socks5Handshake("", "", 0x00), nil, "", ""},
+		{"socks5 password", "socks5h", socks5Handshake("user", "pass", 0x00), url.UserPassword("user", "pass"), "", ""},
+		{"socks5 wrong password", "socks5", socks5Handshake("user", "pass", 0x00), url.UserPassword("user", "wrong"), "", "代理认证失败"},
+		{"socks5 password required", "socks5", socks5Handshake("user", "pass", 0x00), nil, "", "不接受提供的认证方式"},
+		{"socks5 refused", "socks5", socks5Handshake("", "", 0x05), nil, "", "目标拒绝连接"},
+		{"connect", "http", connectHandshake("", "", ""), nil, "", ""},
+		{"connect buffered", "http", connectHandshake("user", "pass", "hello"), url.UserPassword("user", "pass"), "hello", ""},
+		{"connect wrong password", "http", connectHandshake("user", "pass", ""), url.UserPassword("user", "wrong"), "", "代理认证失败"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := startFakeProxy(t, tt.handshake)
+			proxy := &url.URL{Scheme: tt.scheme, Host: p.listener.Addr().String(), User: tt.user}
+
+			conn, err := dialProxy(proxy, target, 5*time.Second)
+			if tt.wantErr != "" {
+				var proxyErr *ProxyError
+				if !errors.As(err, &proxyErr) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("期望代理错误 %q, 实际 %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			if got := <-p.targets; got != target {
+				t.Errorf("代理收到的目标地址 %s, 期望 %s", got, target)
+			}
+			if _, err := conn.Write([]byte("ping")); err != nil {
+				t.Fatal(err)
+			}
+			want := tt.greeting + "ping"
+			got := make([]byte, len(want))
+			if _, err := io.ReadFull(conn, got); err != nil || string(got) != want {
+				t.Errorf("隧道中的数据 %q, 期望 %q: %v", got, want, err)
+			}
+		})
+	}
+}
+
+// TestBypassProxy 本机地址和 NO_PROXY 中的主机直接连接
+func TestBypassProxy(t *testing.T) {
+	noProxy := "example.com, .lan, 10.0.0.0/8, host.local:8080"
+	tests := []struct {
+		host string
+		want bool
+	}{
+		{"localhost", true},
+		{"127.0.0.1", true},
+		{"::1", true},
+		{"example.com", true},
+		{"sync.example.com", true},
+		{"nas.lan", true},
+		{"10.1.2.3", true},
+		{"host.local", true},
+		{"example.org", false},
+		{"192.168.1.2", false},
+	}
+	for _, tt := range tests {
+		if got := bypassProxy(tt.host, noProxy); got != tt.want {
+			t.Errorf("%s: 期望 %v, 实际 %v", tt.host, tt.want, got)
+		}
+	}
+	if !bypassProxy("example.org", "*") {
+		t.Error("* 应匹配所有主机")
+	}
+}
@@ -0,0 +1,110 @@
+package client
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/internal/testutil"
+	server "synctools/codes/pkg/network/server"
+)
+
+// testServerService 没有文件清单的服务端同步服务
+type testServerService struct {
+	interfaces.ServerSyncService
+}
+
+func (testServerService) GetLocalFilesWithMD5(ctx context.Context, dir string) (map[string]string, error) {
+	return map[string]string{}, nil
+}
+
+// TestThrottledDownloadsDoNotTimeout 限速很低且多个下载共享带宽时, 单个下载不会因为暂时收不到数据而超时
+func TestThrottledDownloadsDoNotTimeout(t *testing.T) {
+	timeout := requestTimeout
+	requestTimeout = time.Second
+	defer func() { requestTimeout = timeout }()
+
+	tests := []struct {
+		name        string
+		uploadKB    int // 服务端对单个客户端的上传限速
+		downloadKB  int // 客户端下载限速
+		size        int
+		concurrency int
+	}{
+		{"server", 2, 0, 2 << 10, 3},
+		{"client", 0, 8, 8 << 10, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			data := make([]byte, tt.size)
+			rand.Read(data)
+			for i := 0; i < tt.concurrency; i++ {
+				if err := os.WriteFile(filepath.Join(dir, fmt.Sprintf("%d.bin", i)), data, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			port := ln.Addr().(*net.TCPAddr).Port
+			ln.Close()
+
+			var folders []interfaces.SyncFolder
+			for i := 0; i < tt.concurrency; i++ {
+				folders = append(folders, interfaces.SyncFolder{Path: fmt.Sprintf("%d.bin", i), IsEnabled: true})
+			}
+			s := server.NewServer(&interfaces.Config{
+				Host:              "127.0.0.1",
+				Port:              port,
+				SyncDir:           dir,
+				SyncFolders:       folders,
+				ClientUploadLimit: tt.uploadKB,
+			}, testServerService{}, testutil.NewNopLogger())
+			if err := s.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer s.Stop()
+
+			c := NewNetworkClient(testutil.NewNopLogger(), &testSyncService{config: &interfaces.Config{UUID: "test"}})
+			if err := c.Connect("127.0.0.1", strconv.Itoa(port)); err != nil {
+				t.Fatal(err)
+			}
+			defer c.Disconnect()
+			if _, _, err := c.SendInitMessage(context.Background(), &interfaces.InitRequest{}); err != nil {
+				t.Fatal(err)
+			}
+			c.SetDownloadLimit(tt.downloadKB)
+
+			out := t.TempDir()
+			errs := make(chan error, tt.concurrency)
+			var wg sync.WaitGroup
+			for i := 0; i < tt.concurrency; i++ {
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					name := fmt.Sprintf("%d.bin", i)
+					req := &interfaces.FileTransferRequest{FilePath: name}
+					if err := c.RequestFile(context.Background(), req, filepath.Join(out, name), nil); err != nil {
+						errs <- fmt.Errorf("%s: %v", name, err)
+					}
+				}(i)
+			}
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				t.Error(err)
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package client
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/network/security"
+)
+
+// dialTimeout 建立连接的超时时间
+const dialTimeout = 5 * time.Second
+
+// dial 建立到服务器的连接, 配置了代理时通过代理连接, 配置启用TLS时校验证书指纹
+func (c *NetworkClient) dial(serverAddr string) (net.Conn, error) {
+	config := c.syncService.GetCurrentConfig()
+	conn, err := dialServer(config, serverAddr)
+	if err != nil {
+		return nil, err
+	}
+	if config == nil || !config.TLS.Enabled {
+		return conn, nil
+	}
+
+	pinned := security.NormalizeFingerprint(config.TLS.Fingerprint)
+	tlsConn := tls.Client(conn, security.ClientTLSConfig(pinned))
+	tlsConn.SetDeadline(time.Now().Add(dialTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		conn.Close()
+		return nil, checkFingerprint(c.logger, serverAddr, err)
+	}
+	tlsConn.SetDeadline(time.Time{})
+
+	// 首次连接时记录服务器证书指纹, 之后的连接都必须使用相同的证书
+	if pinned == "" {
+		pinFingerprint(c.logger, c.syncService, config, security.PeerFingerprint(tlsConn))
+	}
+	return tlsConn, nil
+}
+
+// dialServer 建立到服务器的TCP连接, 按配置或环境变量选择代理
+func dialServer(config *interfaces.Config, serverAddr string) (net.Conn, error) {
+	proxy, err := proxyURL(config, serverAddr)
+	if err != nil {
+		return nil, err
+	}
+	if proxy == nil {
+		return net.DialTimeout("tcp", serverAddr, dialTimeout)
+	}
+	return dialProxy(proxy, serverAddr, dialTimeout)
+}
+
+// checkFingerprint 证书指纹不匹配时记录日志并给出处理提示, 其他错误原样返回
+func checkFingerprint(logger interfaces.Logger, serverAddr string, err error) error {
+	var mismatch *security.FingerprintMismatchError
+	if !errors.As(err, &mismatch) {
+		return err
+	}
+	logger.Error("服务器证书已变更, 拒绝连接", interfaces.Fields{
+		"server":   serverAddr,
+		"expected": mismatch.Expected,
+		"actual":   mismatch.Actual,
+	})
+	return fmt.Errorf("%v, 如确认服务器已更换证书, 请清除配置中的证书指纹后重新连接", mismatch)
+}
+
+// pinFingerprint 记录服务器证书指纹并保存到配置
+func pinFingerprint(logger interfaces.Logger, syncService interfaces.ClientSyncService, config *interfaces.Config, fingerprint string) {
+	config.TLS.Fingerprint = fingerprint
+	logger.Info("已记录服务器证书指纹", interfaces.Fields{
+		"fingerprint": fingerprint,
+	})
+
+	if err := syncService.SaveConfig(config); err != nil {
+		logger.Warn("保存服务器证书指纹失败", interfaces.Fields{
+			"error": err,
+		})
+	}
+}
@@ -0,0 +1,464 @@
+package client
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/errors"
+	"synctools/codes/pkg/network/message"
+	"synctools/codes/pkg/network/security"
+)
+
+const (
+	// httpResponseTimeout 等待服务器响应头的超时时间, 服务器计算大文件MD5时需要较长时间
+	httpResponseTimeout = 60 * time.Second
+	// httpMaxIdleConns 保持的空闲连接数, 与并行下载数上限一致
+	httpMaxIdleConns = 16
+	// httpErrorBodyLimit 读取错误响应内容的上限
+	httpErrorBodyLimit = 4096
+)
+
+// HTTPClient 通过HTTP(S)获取文件清单和下载文件的客户端
+// HTTP是无连接的, Connect只记录服务器地址; 请求因网络错误失败时视为连接中断, 由同步服务重连后续传
+type HTTPClient struct {
+	logger          interfaces.Logger
+	syncService     interfaces.ClientSyncService
+	msgSender       *message.MessageSender
+	downloadLimiter *message.RateLimiter // 下载限速
+
+	mu           sync.Mutex
+	server       *ServerURL
+	client       *http.Client
+	pinned       string   // 已固定的服务器证书指纹
+	connected    bool     // 是否已连接
+	capabilities []string // 握手后具备的功能
+
+	received atomic.Int64 // 累计接收的文件字节数
+
+	onConnLost        func(err error)
+	onManifestChanged func(notice *interfaces.ManifestChanged)
+}
+
+// NewHTTPClient 创建HTTP客户端
+func NewHTTPClient(logger interfaces.Logger, syncService interfaces.ClientSyncService) *HTTPClient {
+	return &HTTPClient{
+		logger:          logger,
+		syncService:     syncService,
+		msgSender:       message.NewMessageSender(logger),
+		downloadLimiter: message.NewRateLimiter(0),
+	}
+}
+
+// Connect 记录服务器地址, 实际的请求在握手时发出
+func (c *HTTPClient) Connect(addr, port string) error {
+	c.logger.Debug("开始连接服务器", interfaces.Fields{
+		"serverAddr": addr,
+		"serverPort": port,
+	})
+
+	server, err := ParseServerURL(addr, port)
+	if err != nil {
+		return err
+	}
+	if server.Scheme != SchemeHTTP && server.Scheme != SchemeHTTPS {
+		return fmt.Errorf("不是HTTP服务器地址: %s", addr)
+	}
+	if server.Port == "" {
+		return fmt.Errorf("服务器地址或端口不能为空")
+	}
+
+	config := c.syncService.GetCurrentConfig()
+	pinned := ""
+	if config != nil {
+		pinned = security.NormalizeFingerprint(config.TLS.Fingerprint)
+		c.downloadLimiter.SetRate(int64(config.DownloadLimit) * 1024)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client != nil {
+		c.client.CloseIdleConnections()
+	}
+	c.server = server
+	c.pinned = pinned
+	c.client = c.newHTTPClient(server, pinned)
+	c.connected = true
+	c.capabilities = nil
+	return nil
+}
+
+// newHTTPClient 创建请求使用的HTTP客户端, HTTPS按固定的指纹校验服务器证书
+func (c *HTTPClient) newHTTPClient(server *ServerURL, pinned string) *http.Client {
+	transport := &http.Transport{
+		Proxy:                 httpProxy(c.syncService),
+		DialContext:           (&net.Dialer{Timeout: dialTimeout}).DialContext,
+		TLSHandshakeTimeout:   dialTimeout,
+		ResponseHeaderTimeout: httpResponseTimeout,
+		MaxIdleConnsPerHost:   httpMaxIdleConns,
+		// 文件内容由MD5校验, 不允许中间环节改变编码
+		DisableCompression: true,
+	}
+	if server.Scheme == SchemeHTTPS {
+		transport.TLSClientConfig = security.ClientTLSConfig(pinned)
+	}
+	return &http.Client{Transport: transport}
+}
+
+// Disconnect 断开连接
+func (c *HTTPClient) Disconnect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected {
+		return nil
+	}
+
+	c.logger.Debug("断开服务器连接", interfaces.Fields{})
+	c.connected = false
+	if c.client != nil {
+		c.client.CloseIdleConnections()
+	}
+	return nil
+}
+
+// IsConnected 检查是否已连接
+func (c *HTTPClient) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+// SendInitMessage 获取服务器配置和文件清单
+// HTTP传输没有握手, 每个请求单独签名认证
+func (c *HTTPClient) SendInitMessage(ctx context.Context, initData *interfaces.InitRequest) (*interfaces.Config, map[string]map[string]string, error) {
+	config, md5Map, err := c.RequestManifest(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("初始化请求失败: %w", err)
+	}
+
+	capabilities := message.HTTPCapabilities()
+	c.mu.Lock()
+	c.capabilities = capabilities
+	c.mu.Unlock()
+
+	c.logger.Info("握手完成", interfaces.Fields{
+		"transport":    "http",
+		"capabilities": capabilities,
+	})
+	return config, md5Map, nil
+}
+
+// RequestManifest 获取服务器当前的配置和文件清单
+func (c *HTTPClient) RequestManifest(ctx context.Context) (*interfaces.Config, map[string]map[string]string, error) {
+	resp, err := c.get(ctx, message.HTTPManifestPath, nil)
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取文件清单失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("获取文件清单失败: %w", statusError(resp))
+	}
+
+	var response interfaces.ManifestResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, nil, fmt.Errorf("解析文件清单失败: %v", err)
+	}
+	if !response.Success {
+		return nil, nil, fmt.Errorf("获取文件清单失败: %s", response.Message)
+	}
+	return response.Config, response.MD5Map, nil
+}
+
+// RequestFile 下载文件到目标路径
+// 存在未完成的下载时以Range请求续传, If-Range保证服务器文件变化后从头下载
+func (c *HTTPClient) RequestFile(ctx context.Context, req *interfaces.FileTransferRequest, destPath string, progress chan<- interfaces.Progress) error {
+	message.PrepareResume(destPath, req)
+
+	header := http.Header{}
+	if req.Offset > 0 {
+		c.logger.Info("续传文件", interfaces.Fields{
+			"file":   req.FilePath,
+			"offset": req.Offset,
+		})
+		header.Set("Range", fmt.Sprintf("bytes=%d-", req.Offset))
+		header.Set("If-Range", strconv.Quote(req.MD5))
+	}
+
+	filePath := path.Clean(filepath.ToSlash(req.FilePath))
+	resp, err := c.get(ctx, message.HTTPFilesPath+filePath, header)
+	if err != nil {
+		return fmt.Errorf("发送下载请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	info, err := fileInfoFromResponse(resp, filePath)
+	if err != nil {
+		return err
+	}
+	// 续传信息按请求路径记录
+	info.Path = req.FilePath
+
+	body := &httpBodyReader{
+		ctx:      ctx,
+		body:     resp.Body,
+		received: &c.received,
+		limiter:  c.downloadLimiter,
+		onError:  c.connectionLost,
+	}
+	return c.msgSender.ReceiveFileStream(ctx, body, info, destPath, progress)
+}
+
+// HasCapability 检查是否具备指定功能
+func (c *HTTPClient) HasCapability(capability string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return message.HasCapability(c.capabilities, capability)
+}
+
+// TransferStats 获取累计接收的文件字节数, HTTP传输不压缩
+func (c *HTTPClient) TransferStats() message.TransferStats {
+	n := c.received.Load()
+	return message.TransferStats{WireBytes: n, RawBytes: n}
+}
+
+// SetSyncing 设置同步状态, HTTP传输没有无操作检测, 无需处理
+func (c *HTTPClient) SetSyncing(syncing bool) {}
+
+// SetConnectionLostCallback 设置连接丢失回调, 回调参数为断开原因
+func (c *HTTPClient) SetConnectionLostCallback(callback func(err error)) {
+	c.onConnLost = callback
+}
+
+// SetManifestChangedCallback 设置服务器文件清单变化的回调
+// HTTP传输没有服务器推送, 文件清单变化在重新获取清单时发现
+func (c *HTTPClient) SetManifestChangedCallback(callback func(notice *interfaces.ManifestChanged)) {
+	c.onManifestChanged = callback
+}
+
+// SetDownloadLimit 设置下载速率上限(KB/s), 0表示不限速, 下载中修改立即生效
+func (c *HTTPClient) SetDownloadLimit(kbps int) {
+	c.downloadLimiter.SetRate(int64(kbps) * 1024)
+}
+
+// get 发送签名的GET请求, 网络错误时视为连接中断
+func (c *HTTPClient) get(ctx context.Context, requestPath string, header http.Header) (*http.Response, error) {
+	c.mu.Lock()
+	connected, server, client := c.connected, c.server, c.client
+	c.mu.Unlock()
+	if !connected {
+		return nil, fmt.Errorf("未连接到服务器")
+	}
+
+	target := url.URL{
+		Scheme: server.Scheme,
+		Host:   server.Address(),
+		Path:   server.BasePath + requestPath,
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	// 签名不包含代理的路径前缀, 与服务器收到的路径一致
+	if config := c.syncService.GetCurrentConfig(); config != nil && config.AuthSecret != "" {
+		authHeader, err := security.SignRequest(config.AuthSecret, config.AuthToken, config.UUID, requestPath, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Authorization", authHeader)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil && ctx.Err() != nil {
+		// 主动取消的请求不是连接中断
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		err = checkFingerprint(c.logger, server.Address(), err)
+		c.connectionLost(err)
+		return nil, err
+	}
+	c.pinPeer(resp)
+	return resp, nil
+}
+
+// pinPeer 首次通过HTTPS访问时记录服务器证书指纹, 之后的请求都必须使用相同的证书
+func (c *HTTPClient) pinPeer(resp *http.Response) {
+	if resp.TLS == nil || len(resp.TLS.PeerCertificates) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	if c.pinned != "" {
+		c.mu.Unlock()
+		return
+	}
+	fingerprint := security.Fingerprint(resp.TLS.PeerCertificates[0].Raw)
+	c.pinned = fingerprint
+	old := c.client
+	c.client = c.newHTTPClient(c.server, fingerprint)
+	c.mu.Unlock()
+	old.CloseIdleConnections()
+
+	if config := c.syncService.GetCurrentConfig(); config != nil {
+		pinFingerprint(c.logger, c.syncService, config, fingerprint)
+	}
+}
+
+// connectionLost 标记连接中断并通知断开原因, 主动断开后不再通知
+func (c *HTTPClient) connectionLost(cause error) {
+	c.mu.Lock()
+	if !c.connected {
+		c.mu.Unlock()
+		return
+	}
+	c.connected = false
+	c.mu.Unlock()
+
+	c.logger.Warn("连接已丢失", interfaces.Fields{
+		"error": cause,
+	})
+	if c.onConnLost != nil {
+		c.onConnLost(cause)
+	}
+}
+
+// fileInfoFromResponse 从下载响应中获取文件信息
+// 200表示从头下载, 206表示从Content-Range的起始位置续传; ETag为文件MD5
+func fileInfoFromResponse(resp *http.Response, filePath string) (*interfaces.FileMessageInfo, error) {
+	info := &interfaces.FileMessageInfo{
+		Name: path.Base(filePath),
+		Path: filePath,
+	}
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		if resp.ContentLength < 0 {
+			return nil, fmt.Errorf("服务器响应缺少文件大小")
+		}
+		info.Size = resp.ContentLength
+	case http.StatusPartialContent:
+		start, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return nil, err
+		}
+		info.Offset = start
+		info.Size = total
+	default:
+		return nil, statusError(resp)
+	}
+
+	etag := resp.Header.Get("ETag")
+	md5sum, err := strconv.Unquote(etag)
+	if err != nil || len(md5sum) != 32 {
+		return nil, fmt.Errorf("服务器响应缺少文件校验值: %s", etag)
+	}
+	if _, err := hex.DecodeString(md5sum); err != nil {
+		return nil, fmt.Errorf("服务器响应缺少文件校验值: %s", etag)
+	}
+	info.MD5 = md5sum
+	return info, nil
+}
+
+// parseContentRange 解析"bytes start-end/total"格式的Content-Range, 只接受到文件末尾的范围
+func parseContentRange(value string) (int64, int64, error) {
+	spec, ok := strings.CutPrefix(value, "bytes ")
+	if !ok {
+		return 0, 0, fmt.Errorf("无效的Content-Range: %s", value)
+	}
+	rangePart, totalPart, ok := strings.Cut(spec, "/")
+	if !ok {
+		return 0, 0, fmt.Errorf("无效的Content-Range: %s", value)
+	}
+	startPart, endPart, ok := strings.Cut(rangePart, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("无效的Content-Range: %s", value)
+	}
+
+	start, err1 := strconv.ParseInt(startPart, 10, 64)
+	end, err2 := strconv.ParseInt(endPart, 10, 64)
+	total, err3 := strconv.ParseInt(totalPart, 10, 64)
+	if err1 != nil || err2 != nil || err3 != nil || start < 0 || start > end || end != total-1 {
+		return 0, 0, fmt.Errorf("无效的Content-Range: %s", value)
+	}
+	return start, total, nil
+}
+
+// statusError 将失败的HTTP响应转换为错误
+// 服务器返回错误响应时还原为带错误代码的错误, 否则按状态码转换, 服务器繁忙时携带建议的重试时间
+func statusError(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, httpErrorBodyLimit))
+
+	var response interfaces.ErrorResponse
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") &&
+		json.Unmarshal(body, &response) == nil && response.Code != "" {
+		err := message.ResponseError(&response)
+		if resp.StatusCode == http.StatusUnauthorized {
+			return fmt.Errorf("认证失败, 请检查认证密钥: %w", err)
+		}
+		return err
+	}
+
+	detail := strings.TrimSpace(string(body))
+	if detail == "" {
+		detail = resp.Status
+	}
+
+	switch resp.StatusCode {
+	case http.StatusServiceUnavailable:
+		retryAfter, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+		return errors.NewRetryableError(errors.CodeServiceBusy,
+			fmt.Sprintf("%s, 请在%d秒后重试", detail, retryAfter), time.Duration(retryAfter)*time.Second, nil)
+	case http.StatusUnauthorized:
+		return fmt.Errorf("认证失败, 请检查认证密钥: %s", detail)
+	case http.StatusForbidden:
+		return errors.NewError(errors.CodeForbidden, detail, nil)
+	case http.StatusNotFound:
+		return errors.NewError(errors.CodeStorageNotFound, detail, nil)
+	default:
+		return fmt.Errorf("服务器返回错误: %s", detail)
+	}
+}
+
+// httpBodyReader 读取下载响应内容, 统计字节数并限速
+// 读取中途出错说明连接已中断, 已接收的数据保留用于续传
+type httpBodyReader struct {
+	ctx      context.Context
+	body     io.Reader
+	received *atomic.Int64        // 累计接收的字节数
+	limiter  *message.RateLimiter // 下载限速
+	onError  func(err error)      // 读取出错时调用
+}
+
+// Read 读取响应内容
+func (r *httpBodyReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if n > 0 {
+		r.received.Add(int64(n))
+		if err := r.limiter.Wait(r.ctx, n); err != nil {
+			return n, err
+		}
+	}
+	// 取消请求导致的读取错误不是连接中断
+	if err != nil && err != io.EOF && r.ctx.Err() == nil {
+		r.onError(err)
+	}
+	return n, err
+}
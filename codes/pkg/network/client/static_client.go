@@ -0,0 +1,489 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/network/message"
+	"synctools/codes/pkg/network/security"
+)
+
+// SchemeFile 本地静态导出目录
+const SchemeFile = "file"
+
+// StaticClient 从静态导出目录或静态网站同步的客户端
+// 清单由服务器的签名私钥签名, 首次同步时记录签名公钥, 之后只接受相同公钥签名的清单;
+// 内容文件按MD5命名, 下载后按清单中的MD5校验, 托管方无法替换文件内容
+type StaticClient struct {
+	logger          interfaces.Logger
+	syncService     interfaces.ClientSyncService
+	msgSender       *message.MessageSender
+	downloadLimiter *message.RateLimiter // 下载限速
+
+	mu           sync.Mutex
+	baseURL      *url.URL // 远程导出目录的地址, 本地目录时为nil
+	baseDir      string   // 本地导出目录
+	client       *http.Client
+	connected    bool                       // 是否已连接
+	capabilities []string                   // 握手后具备的功能
+	manifest     *interfaces.StaticManifest // 最近一次获取的清单
+
+	received atomic.Int64 // 累计接收的文件字节数
+
+	onConnLost        func(err error)
+	onManifestChanged func(notice *interfaces.ManifestChanged)
+}
+
+// NewStaticClient 创建静态导出客户端
+func NewStaticClient(logger interfaces.Logger, syncService interfaces.ClientSyncService) *StaticClient {
+	return &StaticClient{
+		logger:          logger,
+		syncService:     syncService,
+		msgSender:       message.NewMessageSender(logger),
+		downloadLimiter: message.NewRateLimiter(0),
+	}
+}
+
+// IsStaticURL 检查服务器地址是否为静态导出
+// file:// 地址指向本地导出目录; http(s):// 地址以清单文件名结尾时指向静态网站上的导出目录
+func IsStaticURL(addr string) bool {
+	u, err := url.Parse(strings.TrimSpace(addr))
+	if err != nil {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case SchemeFile:
+		return true
+	case SchemeHTTP, SchemeHTTPS:
+		return path.Base(u.Path) == message.StaticManifestFile
+	default:
+		return false
+	}
+}
+
+// Connect 记录导出目录, 实际的读取在握手时进行
+// 静态导出的地址是完整的, 不使用单独填写的端口
+func (c *StaticClient) Connect(addr, port string) error {
+	c.logger.Debug("开始连接服务器", interfaces.Fields{
+		"serverAddr": addr,
+	})
+
+	if !IsStaticURL(addr) {
+		return fmt.Errorf("不是静态导出地址: %s", addr)
+	}
+	u, err := url.Parse(strings.TrimSpace(addr))
+	if err != nil {
+		return fmt.Errorf("服务器地址格式错误: %v", err)
+	}
+
+	var baseURL *url.URL
+	var baseDir string
+	if strings.EqualFold(u.Scheme, SchemeFile) {
+		baseDir = localExportDir(u)
+	} else {
+		baseURL = &url.URL{
+			Scheme: strings.ToLower(u.Scheme),
+			Host:   u.Host,
+			Path:   path.Dir(u.Path),
+		}
+		if u.Host == "" {
+			return fmt.Errorf("服务器地址不能为空")
+		}
+	}
+
+	config := c.syncService.GetCurrentConfig()
+	if config != nil {
+		c.downloadLimiter.SetRate(int64(config.DownloadLimit) * 1024)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.client != nil {
+		c.client.CloseIdleConnections()
+	}
+	c.baseURL = baseURL
+	c.baseDir = baseDir
+	c.client = nil
+	if baseURL != nil {
+		c.client = c.newHTTPClient()
+	}
+	c.connected = true
+	c.capabilities = nil
+	c.manifest = nil
+	return nil
+}
+
+// localExportDir 获取 file:// 地址对应的本地目录, 地址可以指向目录或其中的清单文件
+func localExportDir(u *url.URL) string {
+	p := u.Path
+	if u.Opaque != "" {
+		// file:C:/path 形式的地址
+		p = u.Opaque
+	}
+	if runtime.GOOS == "windows" && len(p) >= 3 && p[0] == '/' && p[2] == ':' {
+		// file:///C:/path 的路径以斜杠开头
+		p = p[1:]
+	}
+	if u.Host != "" && u.Host != "localhost" {
+		// file://server/share/path 为网络共享目录
+		p = "//" + u.Host + p
+	}
+
+	dir := filepath.FromSlash(p)
+	if filepath.Base(dir) == message.StaticManifestFile {
+		dir = filepath.Dir(dir)
+	}
+	return dir
+}
+
+// newHTTPClient 创建访问静态网站的HTTP客户端
+// 静态网站通常使用公共证书, 按系统证书校验; 文件内容由清单签名和MD5保证
+func (c *StaticClient) newHTTPClient() *http.Client {
+	transport := &http.Transport{
+		Proxy:                 httpProxy(c.syncService),
+		DialContext:           (&net.Dialer{Timeout: dialTimeout}).DialContext,
+		TLSHandshakeTimeout:   dialTimeout,
+		ResponseHeaderTimeout: httpResponseTimeout,
+		MaxIdleConnsPerHost:   httpMaxIdleConns,
+		// 文件内容由MD5校验, 不允许中间环节改变编码
+		DisableCompression: true,
+	}
+	return &http.Client{Transport: transport}
+}
+
+// Disconnect 断开连接
+func (c *StaticClient) Disconnect() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.connected {
+		return nil
+	}
+
+	c.logger.Debug("断开服务器连接", interfaces.Fields{})
+	c.connected = false
+	if c.client != nil {
+		c.client.CloseIdleConnections()
+	}
+	return nil
+}
+
+// IsConnected 检查是否已连接
+func (c *StaticClient) IsConnected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+// SendInitMessage 获取并校验清单
+// 静态导出没有握手和认证, 导出的内容对能访问导出目录的所有人可见
+func (c *StaticClient) SendInitMessage(ctx context.Context, initData *interfaces.InitRequest) (*interfaces.Config, map[string]map[string]string, error) {
+	config, md5Map, err := c.RequestManifest(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("初始化请求失败: %v", err)
+	}
+
+	capabilities := message.HTTPCapabilities()
+	c.mu.Lock()
+	c.capabilities = capabilities
+	c.mu.Unlock()
+
+	c.logger.Info("握手完成", interfaces.Fields{
+		"transport":    "static",
+		"capabilities": capabilities,
+	})
+	return config, md5Map, nil
+}
+
+// RequestManifest 获取导出时的配置和文件清单
+func (c *StaticClient) RequestManifest(ctx context.Context) (*interfaces.Config, map[string]map[string]string, error) {
+	data, err := c.readManifest(ctx)
+	if err != nil {
+		return nil, nil, fmt.Errorf("获取文件清单失败: %v", err)
+	}
+
+	manifest, err := c.verifyManifest(data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	c.mu.Lock()
+	c.manifest = manifest
+	c.mu.Unlock()
+
+	c.logger.Info("获取静态清单成功", interfaces.Fields{
+		"create_time": manifest.CreateTime,
+		"files":       len(manifest.Files),
+	})
+	return manifest.Config, manifest.MD5Map, nil
+}
+
+// verifyManifest 校验清单签名并解析清单, 首次同步时记录签名公钥
+func (c *StaticClient) verifyManifest(data []byte) (*interfaces.StaticManifest, error) {
+	var signed interfaces.SignedManifest
+	if err := json.Unmarshal(data, &signed); err != nil {
+		return nil, fmt.Errorf("解析文件清单失败: %v", err)
+	}
+
+	config := c.syncService.GetCurrentConfig()
+	pinned := ""
+	if config != nil {
+		pinned = config.ManifestKey
+	}
+	if err := security.VerifyManifest(pinned, signed.PublicKey, signed.Signature, signed.Manifest); err != nil {
+		var mismatch *security.SigningKeyMismatchError
+		if errors.As(err, &mismatch) {
+			c.logger.Error("清单签名公钥已变更, 拒绝同步", interfaces.Fields{
+				"expected": mismatch.Expected,
+				"actual":   mismatch.Actual,
+			})
+			return nil, fmt.Errorf("%v, 如确认服务器已更换签名私钥, 请清除配置中的清单签名公钥后重新连接", mismatch)
+		}
+		return nil, err
+	}
+
+	var manifest interfaces.StaticManifest
+	if err := json.Unmarshal(signed.Manifest, &manifest); err != nil {
+		return nil, fmt.Errorf("解析文件清单失败: %v", err)
+	}
+	if manifest.FormatVersion != message.StaticFormatVersion {
+		return nil, fmt.Errorf("不支持的清单格式版本: %d", manifest.FormatVersion)
+	}
+	if manifest.Config == nil {
+		return nil, fmt.Errorf("清单缺少服务器配置")
+	}
+
+	// 首次同步时记录签名公钥, 之后的清单都必须使用相同的私钥签名
+	if pinned == "" && config != nil {
+		config.ManifestKey = security.NormalizeFingerprint(signed.PublicKey)
+		c.logger.Info("已记录清单签名公钥", interfaces.Fields{
+			"public_key": config.ManifestKey,
+		})
+		if err := c.syncService.SaveConfig(config); err != nil {
+			c.logger.Warn("保存清单签名公钥失败", interfaces.Fields{
+				"error": err,
+			})
+		}
+	}
+	return &manifest, nil
+}
+
+// readManifest 读取清单文件, 远程清单要求缓存重新验证, 避免拿到过期的清单
+func (c *StaticClient) readManifest(ctx context.Context) ([]byte, error) {
+	c.mu.Lock()
+	baseDir := c.baseDir
+	c.mu.Unlock()
+
+	if baseDir != "" {
+		return os.ReadFile(filepath.Join(baseDir, message.StaticManifestFile))
+	}
+
+	header := http.Header{}
+	header.Set("Cache-Control", "no-cache")
+	resp, err := c.get(ctx, message.StaticManifestFile, header)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, statusError(resp)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// RequestFile 下载文件到目标路径
+// 内容文件按MD5命名, 内容不会变化, 未完成的下载只要MD5一致即可直接续传
+func (c *StaticClient) RequestFile(ctx context.Context, req *interfaces.FileTransferRequest, destPath string, progress chan<- interfaces.Progress) error {
+	c.mu.Lock()
+	connected, manifest, baseDir := c.connected, c.manifest, c.baseDir
+	c.mu.Unlock()
+	if !connected || manifest == nil {
+		return fmt.Errorf("未连接到服务器")
+	}
+
+	filePath := path.Clean(filepath.ToSlash(req.FilePath))
+	file, ok := manifest.Files[filePath]
+	if !ok {
+		return fmt.Errorf("清单中不存在该文件: %s", filePath)
+	}
+	// MD5来自服务器提供的清单, 用于拼接内容文件路径, 必须先校验格式
+	if !message.ValidStaticBlobName(file.MD5) {
+		return fmt.Errorf("清单中的文件MD5无效: %s", filePath)
+	}
+
+	message.PrepareResume(destPath, req)
+	if req.MD5 != file.MD5 || req.Offset > file.Size {
+		req.Offset = 0
+	}
+	if req.Offset > 0 {
+		c.logger.Info("续传文件", interfaces.Fields{
+			"file":   req.FilePath,
+			"offset": req.Offset,
+		})
+	}
+
+	info := &interfaces.FileMessageInfo{
+		Name:   path.Base(filePath),
+		Path:   req.FilePath,
+		Size:   file.Size,
+		MD5:    file.MD5,
+		Offset: req.Offset,
+	}
+	blobPath := message.StaticBlobPath(file.MD5)
+
+	if baseDir != "" {
+		return c.receiveLocal(ctx, filepath.Join(baseDir, filepath.FromSlash(blobPath)), info, destPath, progress)
+	}
+
+	header := http.Header{}
+	if info.Offset > 0 {
+		header.Set("Range", fmt.Sprintf("bytes=%d-", info.Offset))
+	}
+	resp, err := c.get(ctx, blobPath, header)
+	if err != nil {
+		return fmt.Errorf("发送下载请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// 不支持Range的静态网站返回完整内容, 从头下载
+		info.Offset = 0
+	case http.StatusPartialContent:
+		start, total, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return err
+		}
+		if start != info.Offset || total != info.Size {
+			return fmt.Errorf("无效的Content-Range: %s", resp.Header.Get("Content-Range"))
+		}
+	default:
+		return statusError(resp)
+	}
+
+	body := &httpBodyReader{
+		ctx:      ctx,
+		body:     resp.Body,
+		received: &c.received,
+		limiter:  c.downloadLimiter,
+		onError:  c.connectionLost,
+	}
+	return c.msgSender.ReceiveFileStream(ctx, body, info, destPath, progress)
+}
+
+// receiveLocal 从本地导出目录复制内容文件
+func (c *StaticClient) receiveLocal(ctx context.Context, blobPath string, info *interfaces.FileMessageInfo, destPath string, progress chan<- interfaces.Progress) error {
+	blob, err := os.Open(blobPath)
+	if err != nil {
+		return fmt.Errorf("打开内容文件失败: %v", err)
+	}
+	defer blob.Close()
+
+	if _, err := blob.Seek(info.Offset, io.SeekStart); err != nil {
+		return fmt.Errorf("定位内容文件失败: %v", err)
+	}
+
+	body := &httpBodyReader{
+		ctx:      ctx,
+		body:     blob,
+		received: &c.received,
+		limiter:  c.downloadLimiter,
+		onError:  func(err error) {},
+	}
+	return c.msgSender.ReceiveFileStream(ctx, body, info, destPath, progress)
+}
+
+// HasCapability 检查是否具备指定功能
+func (c *StaticClient) HasCapability(capability string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return message.HasCapability(c.capabilities, capability)
+}
+
+// TransferStats 获取累计接收的文件字节数, 静态导出不压缩
+func (c *StaticClient) TransferStats() message.TransferStats {
+	n := c.received.Load()
+	return message.TransferStats{WireBytes: n, RawBytes: n}
+}
+
+// SetSyncing 设置同步状态, 静态导出没有无操作检测, 无需处理
+func (c *StaticClient) SetSyncing(syncing bool) {}
+
+// SetConnectionLostCallback 设置连接丢失回调, 回调参数为断开原因
+func (c *StaticClient) SetConnectionLostCallback(callback func(err error)) {
+	c.onConnLost = callback
+}
+
+// SetManifestChangedCallback 设置服务器文件清单变化的回调
+// 静态导出没有服务器推送, 清单变化在重新获取清单时发现
+func (c *StaticClient) SetManifestChangedCallback(callback func(notice *interfaces.ManifestChanged)) {
+	c.onManifestChanged = callback
+}
+
+// SetDownloadLimit 设置下载速率上限(KB/s), 0表示不限速, 下载中修改立即生效
+func (c *StaticClient) SetDownloadLimit(kbps int) {
+	c.downloadLimiter.SetRate(int64(kbps) * 1024)
+}
+
+// get 请求导出目录中的文件, 网络错误时视为连接中断
+func (c *StaticClient) get(ctx context.Context, name string, header http.Header) (*http.Response, error) {
+	c.mu.Lock()
+	connected, baseURL, client := c.connected, c.baseURL, c.client
+	c.mu.Unlock()
+	if !connected {
+		return nil, fmt.Errorf("未连接到服务器")
+	}
+
+	target := *baseURL
+	target.Path = path.Join(baseURL.Path, name)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	resp, err := client.Do(req)
+	if err != nil && ctx.Err() != nil {
+		// 主动取消的请求不是连接中断
+		return nil, ctx.Err()
+	}
+	if err != nil {
+		c.connectionLost(err)
+		return nil, err
+	}
+	return resp, nil
+}
+
+// connectionLost 标记连接中断并通知断开原因, 主动断开后不再通知
+func (c *StaticClient) connectionLost(cause error) {
+	c.mu.Lock()
+	if !c.connected {
+		c.mu.Unlock()
+		return
+	}
+	c.connected = false
+	c.mu.Unlock()
+
+	c.logger.Warn("连接已丢失", interfaces.Fields{
+		"error": cause,
+	})
+	if c.onConnLost != nil {
+		c.onConnLost(cause)
+	}
+}
@@ -0,0 +1,118 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/network/message"
+)
+
+// 服务器地址支持的传输方式
+const (
+	SchemeTCP   = "tcp"   // 自定义帧协议, 默认方式
+	SchemeHTTP  = "http"  // HTTP传输
+	SchemeHTTPS = "https" // 基于TLS的HTTP传输
+)
+
+// Transport 客户端到服务器的传输
+// TCP传输支持服务器推送; HTTP传输用于只允许HTTP(S)的网络或经过缓存代理访问服务器
+type Transport interface {
+	// Connect 连接到服务器, addr可以带传输方式前缀
+	Connect(addr, port string) error
+
+	// Disconnect 断开连接
+	Disconnect() error
+
+	// IsConnected 检查是否已连接
+	IsConnected() bool
+
+	// SendInitMessage 完成认证和握手, 返回服务器配置和文件清单
+	SendInitMessage(ctx context.Context, initData *interfaces.InitRequest) (*interfaces.Config, map[string]map[string]string, error)
+
+	// RequestManifest 获取服务器当前的配置和文件清单
+	RequestManifest(ctx context.Context) (*interfaces.Config, map[string]map[string]string, error)
+
+	// RequestFile 请求下载文件并接收到目标路径, 存在未完成的下载时续传
+	// 上下文取消时中止传输并删除临时文件, 目标文件保持不变
+	RequestFile(ctx context.Context, req *interfaces.FileTransferRequest, destPath string, progress chan<- interfaces.Progress) error
+
+	// HasCapability 检查当前连接是否具备指定功能
+	HasCapability(capability string) bool
+
+	// TransferStats 获取累计的传输字节统计
+	TransferStats() message.TransferStats
+
+	// SetSyncing 设置同步状态
+	SetSyncing(syncing bool)
+
+	// SetConnectionLostCallback 设置连接丢失回调, 回调参数为断开原因
+	SetConnectionLostCallback(callback func(err error))
+
+	// SetManifestChangedCallback 设置服务器文件清单变化的回调
+	SetManifestChangedCallback(callback func(notice *interfaces.ManifestChanged))
+}
+
+// ServerURL 解析后的服务器地址
+type ServerURL struct {
+	Scheme   string // 传输方式
+	Host     string // 主机名
+	Port     string // 端口
+	BasePath string // HTTP传输的路径前缀, 经反向代理转发到子路径时使用
+}
+
+// Address 获取主机和端口组成的地址
+func (u *ServerURL) Address() string {
+	return net.JoinHostPort(u.Host, u.Port)
+}
+
+// ParseServerURL 解析服务器地址
+// 地址可以带 tcp://、http:// 或 https:// 前缀, 不带前缀时使用TCP传输; 地址中包含端口时优先使用该端口
+// 配置的端口是TCP端口, HTTP传输只使用地址中的端口, 未指定时使用80或443
+func ParseServerURL(addr, port string) (*ServerURL, error) {
+	addr = strings.TrimSpace(addr)
+	if !strings.Contains(addr, "://") {
+		return &ServerURL{Scheme: SchemeTCP, Host: addr, Port: port}, nil
+	}
+
+	u, err := url.Parse(addr)
+	if err != nil {
+		return nil, fmt.Errorf("服务器地址格式错误: %v", err)
+	}
+
+	server := &ServerURL{
+		Scheme: strings.ToLower(u.Scheme),
+		Host:   u.Hostname(),
+		Port:   u.Port(),
+	}
+
+	switch server.Scheme {
+	case SchemeTCP:
+		if server.Port == "" {
+			server.Port = port
+		}
+	case SchemeHTTP, SchemeHTTPS:
+		server.BasePath = strings.TrimSuffix(u.Path, "/")
+		if server.Port == "" && server.Scheme == SchemeHTTP {
+			server.Port = "80"
+		} else if server.Port == "" {
+			server.Port = "443"
+		}
+	default:
+		return nil, fmt.Errorf("不支持的传输方式: %s", u.Scheme)
+	}
+
+	if server.Host == "" {
+		return nil, fmt.Errorf("服务器地址不能为空")
+	}
+	return server, nil
+}
+
+// IsHTTPURL 检查服务器地址是否使用HTTP传输
+func IsHTTPURL(addr string) bool {
+	server, err := ParseServerURL(addr, "")
+	return err == nil && (server.Scheme == SchemeHTTP || server.Scheme == SchemeHTTPS)
+}
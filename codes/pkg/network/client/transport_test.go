@@ -0,0 +1,43 @@
+package client
+
+import "testing"
+
+func TestParseServerURL(t *testing.T) {
+	tests := []struct {
+		addr     string
+		port     string
+		scheme   string
+		host     string
+		wantPort string
+		basePath string
+	}{
+		{"example.com", "25000", SchemeTCP, "example.com", "25000", ""},
+		{"tcp://example.com", "25000", SchemeTCP, "example.com", "25000", ""},
+		{"tcp://example.com:26000", "25000", SchemeTCP, "example.com", "26000", ""},
+		{"http://example.com", "25000", SchemeHTTP, "example.com", "80", ""},
+		{"https://example.com", "25000", SchemeHTTPS, "example.com", "443", ""},
+		{"http://example.com:8080", "25000", SchemeHTTP, "example.com", "8080", ""},
+		{"https://example.com/sync/", "25000", SchemeHTTPS, "example.com", "443", "/sync"},
+		{"HTTP://[::1]:8080", "", SchemeHTTP, "::1", "8080", ""},
+	}
+
+	for _, tt := range tests {
+		server, err := ParseServerURL(tt.addr, tt.port)
+		if err != nil {
+			t.Errorf("ParseServerURL(%q, %q) 返回错误: %v", tt.addr, tt.port, err)
+			continue
+		}
+		if server.Scheme != tt.scheme || server.Host != tt.host || server.Port != tt.wantPort || server.BasePath != tt.basePath {
+			t.Errorf("ParseServerURL(%q, %q) = %+v, 期望 %s://%s:%s%s",
+				tt.addr, tt.port, *server, tt.scheme, tt.host, tt.wantPort, tt.basePath)
+		}
+	}
+}
+
+func TestParseServerURLInvalid(t *testing.T) {
+	for _, addr := range []string{"ftp://example.com", "http://", "http://exa mple.com"} {
+		if _, err := ParseServerURL(addr, "25000"); err == nil {
+			t.Errorf("ParseServerURL(%q) 期望返回错误", addr)
+		}
+	}
+}
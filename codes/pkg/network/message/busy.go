@@ -0,0 +1,58 @@
+package message
+
+import (
+	"encoding/json"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/errors"
+)
+
+const (
+	// MsgBusy 服务器繁忙响应
+	MsgBusy = "busy"
+	// MsgShutdown 服务器正在关闭的通知
+	MsgShutdown = "shutdown"
+)
+
+// NewBusyResponse 创建服务器繁忙响应
+func NewBusyResponse(message string, retryAfter time.Duration) interfaces.ErrorResponse {
+	return interfaces.ErrorResponse{
+		Success:    false,
+		Code:       errors.CodeServiceBusy,
+		Message:    message,
+		Retryable:  true,
+		RetryAfter: seconds(retryAfter),
+	}
+}
+
+// NewShutdownNotice 创建服务器关闭通知, drain为服务器等待传输完成的时间
+func NewShutdownNotice(drain time.Duration) interfaces.ErrorResponse {
+	return interfaces.ErrorResponse{
+		Success:    false,
+		Code:       errors.CodeServiceStop,
+		Message:    "服务器正在关闭",
+		Retryable:  true,
+		RetryAfter: seconds(drain),
+	}
+}
+
+// seconds 将时长向上取整为秒
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
+
+// ParseBusy 将服务器繁忙响应或关闭通知转换为错误, 都不是时返回nil
+// 旧版服务器的繁忙响应不带可重试标记, 按可重试处理
+func ParseBusy(msg *interfaces.Message) error {
+	if msg.Type != MsgBusy && msg.Type != MsgShutdown {
+		return nil
+	}
+
+	var busy interfaces.ErrorResponse
+	if err := json.Unmarshal(msg.Payload, &busy); err != nil {
+		return errors.NewRetryableError(errors.CodeServiceBusy, "服务器繁忙", 0, err)
+	}
+	busy.Retryable = true
+	return ResponseError(&busy)
+}
@@ -0,0 +1,29 @@
+package message
+
+import (
+	"context"
+	"io"
+)
+
+// MsgCancelRequest 取消进行中的请求, 消息ID为要取消的请求ID, 服务器不回复
+const MsgCancelRequest = "cancel_request"
+
+// contextReader 在上下文取消后停止读取
+type contextReader struct {
+	ctx    context.Context
+	reader io.Reader
+}
+
+// ContextReader 包装读取器, 上下文取消后的读取返回取消原因
+// 用于计算大文件MD5等不可中断的长时间读取
+func ContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, reader: r}
+}
+
+// Read 读取数据, 上下文已取消时返回取消原因
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.reader.Read(p)
+}
@@ -0,0 +1,153 @@
+package message
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const (
+	// FlagCompressed 帧负载使用DEFLATE压缩
+	FlagCompressed uint8 = 0x01
+
+	// compressMinSize 小于该长度的负载不压缩
+	compressMinSize = 512
+	// compressLevel 压缩级别, 优先保证传输速度
+	compressLevel = flate.BestSpeed
+)
+
+// incompressibleExts 已压缩格式的文件, 再次压缩只会浪费CPU
+var incompressibleExts = map[string]struct{}{
+	".jar":  {},
+	".zip":  {},
+	".png":  {},
+	".jpg":  {},
+	".jpeg": {},
+	".gif":  {},
+	".webp": {},
+	".gz":   {},
+	".7z":   {},
+	".rar":  {},
+	".xz":   {},
+	".bz2":  {},
+	".zst":  {},
+	".ogg":  {},
+	".mp3":  {},
+	".mp4":  {},
+}
+
+// flateWriters 复用压缩器, 避免每帧分配压缩状态
+var flateWriters = sync.Pool{
+	New: func() interface{} {
+		w, _ := flate.NewWriter(nil, compressLevel)
+		return w
+	},
+}
+
+// TransferStats 连接上的传输字节统计
+type TransferStats struct {
+	WireBytes int64 // 实际在网络上收发的字节数
+	RawBytes  int64 // 压缩前的字节数
+}
+
+// Add 累加统计
+func (t TransferStats) Add(other TransferStats) TransferStats {
+	return TransferStats{
+		WireBytes: t.WireBytes + other.WireBytes,
+		RawBytes:  t.RawBytes + other.RawBytes,
+	}
+}
+
+// Sub 计算两次统计之间的差值
+func (t TransferStats) Sub(other TransferStats) TransferStats {
+	return TransferStats{
+		WireBytes: t.WireBytes - other.WireBytes,
+		RawBytes:  t.RawBytes - other.RawBytes,
+	}
+}
+
+// Ratio 压缩率, 网络字节数占原始字节数的比例
+func (t TransferStats) Ratio() float64 {
+	if t.RawBytes == 0 {
+		return 1
+	}
+	return float64(t.WireBytes) / float64(t.RawBytes)
+}
+
+// IsCompressible 根据扩展名判断文件是否值得压缩
+func IsCompressible(path string) bool {
+	_, skip := incompressibleExts[strings.ToLower(filepath.Ext(path))]
+	return !skip
+}
+
+// SetCompression 设置连接是否压缩发送的帧, 应在双方协商支持压缩后启用
+// 接收方根据帧标志位解压, 不需要设置
+func (s *MessageSender) SetCompression(conn net.Conn, enabled bool) {
+	s.state(conn).compress.Store(enabled)
+}
+
+// Stats 获取连接的传输字节统计
+func (s *MessageSender) Stats(conn net.Conn) TransferStats {
+	st := s.state(conn)
+	return TransferStats{
+		WireBytes: st.wireBytes.Load(),
+		RawBytes:  st.rawBytes.Load(),
+	}
+}
+
+// recordStats 记录一帧的网络字节数和原始字节数
+func (st *connState) recordStats(wire, raw int) {
+	st.wireBytes.Add(int64(FrameHeaderSize + wire))
+	st.rawBytes.Add(int64(FrameHeaderSize + raw))
+}
+
+// compressFrame 压缩帧负载, 压缩后没有变小时保持原样
+func compressFrame(frame *Frame) *Frame {
+	if len(frame.Payload) < compressMinSize || frame.Flags&FlagCompressed != 0 {
+		return frame
+	}
+
+	var buf bytes.Buffer
+	buf.Grow(len(frame.Payload) / 2)
+
+	w := flateWriters.Get().(*flate.Writer)
+	defer flateWriters.Put(w)
+	w.Reset(&buf)
+	if _, err := w.Write(frame.Payload); err != nil {
+		return frame
+	}
+	if err := w.Close(); err != nil {
+		return frame
+	}
+	if buf.Len() >= len(frame.Payload) {
+		return frame
+	}
+
+	return &Frame{
+		Type:    frame.Type,
+		Flags:   frame.Flags | FlagCompressed,
+		Stream:  frame.Stream,
+		Payload: buf.Bytes(),
+		rawSize: len(frame.Payload),
+	}
+}
+
+// decompressPayload 解压帧负载, 解压后的长度同样受最大帧长度限制
+func (s *MessageSender) decompressPayload(payload []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(payload))
+	defer r.Close()
+
+	data, err := io.ReadAll(io.LimitReader(r, int64(s.maxFrameSize)+1))
+	if err != nil {
+		return nil, fmt.Errorf("解压帧负载失败: %v", err)
+	}
+	if len(data) > s.maxFrameSize {
+		return nil, fmt.Errorf("解压后帧长度超出限制: > %d", s.maxFrameSize)
+	}
+	return data, nil
+}
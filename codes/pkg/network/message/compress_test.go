@@ -0,0 +1,118 @@
+package message
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/internal/testutil"
+)
+
+// TestCompressFrame 只压缩足够长且压缩后变小的负载, 已压缩的帧不再压缩
+func TestCompressFrame(t *testing.T) {
+	random := make([]byte, 4096)
+	rand.Read(random)
+	text := []byte(strings.Repeat("synctools compress ", 256))
+
+	tests := []struct {
+		name       string
+		frame      *Frame
+		compressed bool
+	}{
+		{"text", &Frame{Type: FrameData, Payload: text}, true},
+		{"short", &Frame{Type: FrameData, Payload: text[:compressMinSize-1]}, false},
+		{"random", &Frame{Type: FrameData, Payload: random}, false},
+		{"already compressed", &Frame{Type: FrameData, Flags: FlagCompressed, Payload: text}, false},
+	}
+	sender := NewMessageSender(testutil.NewNopLogger())
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := compressFrame(tt.frame)
+			if (got != tt.frame) != tt.compressed {
+				t.Fatalf("期望压缩 %v, 实际 %v", tt.compressed, got != tt.frame)
+			}
+			if !tt.compressed {
+				return
+			}
+			if got.Flags&FlagCompressed == 0 || len(got.Payload) >= len(tt.frame.Payload) || got.rawSize != len(tt.frame.Payload) {
+				t.Errorf("压缩的帧错误: flags %d, %d -> %d 字节", got.Flags, len(tt.frame.Payload), len(got.Payload))
+			}
+			data, err := sender.decompressPayload(got.Payload)
+			if err != nil || !bytes.Equal(data, tt.frame.Payload) {
+				t.Errorf("解压后的负载错误: %v", err)
+			}
+		})
+	}
+}
+
+// TestDecompressLimit 解压后超过最大帧长度的负载被拒绝, 防止小帧解压出大量数据
+func TestDecompressLimit(t *testing.T) {
+	sender := NewMessageSender(testutil.NewNopLogger())
+	sender.SetMaxFrameSize(4096)
+	frame := compressFrame(&Frame{Type: FrameData, Payload: make([]byte, 64<<10)})
+	if frame.Flags&FlagCompressed == 0 || len(frame.Payload) > 4096 {
+		t.Fatalf("测试数据应压缩到帧长度限制以内: %d 字节", len(frame.Payload))
+	}
+	if _, err := sender.decompressPayload(frame.Payload); err == nil || !strings.Contains(err.Error(), "超出限制") {
+		t.Errorf("期望超出长度限制, 实际 %v", err)
+	}
+}
+
+// TestSendFileCompression 协商压缩后文本文件压缩传输, 已压缩格式的文件和未协商压缩的连接不压缩
+func TestSendFileCompression(t *testing.T) {
+	dir := t.TempDir()
+	data := []byte(strings.Repeat("key=value\n", 16<<10))
+
+	tests := []struct {
+		name       string
+		file       string
+		enabled    bool
+		compressed bool
+	}{
+		{"text", "options.txt", true, true},
+		{"jar", "a.jar", true, false},
+		{"disabled", "config.txt", false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(dir, tt.file)
+			if err := os.WriteFile(path, data, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			server, client := net.Pipe()
+			defer server.Close()
+			defer client.Close()
+			sender := NewMessageSender(testutil.NewNopLogger())
+			sender.SetCompression(server, tt.enabled)
+			done := make(chan error, 1)
+			go func() {
+				req := &interfaces.FileTransferRequest{FilePath: tt.file}
+				done <- sender.SendFileChunked(context.Background(), server, 1, "", path, req, nil)
+			}()
+
+			receiver := NewMessageSender(testutil.NewNopLogger())
+			destPath := filepath.Join(t.TempDir(), tt.file)
+			if err := receiver.ReceiveFile(context.Background(), client, destPath, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+			if got, err := os.ReadFile(destPath); err != nil || !bytes.Equal(got, data) {
+				t.Fatalf("接收的文件错误: %v", err)
+			}
+
+			stats := receiver.Stats(client)
+			if compressed := stats.WireBytes < stats.RawBytes/2; compressed != tt.compressed {
+				t.Errorf("期望压缩 %v, 实际网络字节数 %d, 原始字节数 %d", tt.compressed, stats.WireBytes, stats.RawBytes)
+			}
+		})
+	}
+}
@@ -0,0 +1,114 @@
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+)
+
+const (
+	// DiscoveryPort 局域网发现使用的UDP端口
+	DiscoveryPort = 25001
+	// DiscoveryInterval 服务器广播信标的间隔
+	DiscoveryInterval = 2 * time.Second
+	// MaxDiscoveryPacket 发现报文的最大长度
+	MaxDiscoveryPacket = 1024
+	// discoveryMagic 发现报文的标识, 用于忽略同一端口上的其他广播
+	discoveryMagic = "synctools-discovery"
+)
+
+// 发现报文类型
+const (
+	DiscoveryBeacon = "beacon" // 服务器信标
+	DiscoveryProbe  = "probe"  // 客户端探测, 服务器收到后立即回复信标
+)
+
+// discoveryPacket 局域网发现报文
+type discoveryPacket struct {
+	Magic  string                   `json:"magic"`
+	Type   string                   `json:"type"`
+	Beacon *interfaces.ServerBeacon `json:"beacon,omitempty"`
+}
+
+// EncodeBeacon 编码服务器信标
+func EncodeBeacon(beacon *interfaces.ServerBeacon) ([]byte, error) {
+	data, err := json.Marshal(&discoveryPacket{Magic: discoveryMagic, Type: DiscoveryBeacon, Beacon: beacon})
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > MaxDiscoveryPacket {
+		return nil, fmt.Errorf("信标长度超过上限: %d", len(data))
+	}
+	return data, nil
+}
+
+// EncodeProbe 编码客户端探测
+func EncodeProbe() []byte {
+	data, _ := json.Marshal(&discoveryPacket{Magic: discoveryMagic, Type: DiscoveryProbe})
+	return data
+}
+
+// DecodeDiscovery 解析发现报文, 返回报文类型和信标, 不是发现报文时返回错误
+func DecodeDiscovery(data []byte) (string, *interfaces.ServerBeacon, error) {
+	var packet discoveryPacket
+	if err := json.Unmarshal(data, &packet); err != nil {
+		return "", nil, err
+	}
+	if packet.Magic != discoveryMagic {
+		return "", nil, fmt.Errorf("不是发现报文")
+	}
+
+	switch packet.Type {
+	case DiscoveryProbe:
+		return packet.Type, nil, nil
+	case DiscoveryBeacon:
+		if packet.Beacon == nil || packet.Beacon.Port <= 0 {
+			return "", nil, fmt.Errorf("信标内容不完整")
+		}
+		return packet.Type, packet.Beacon, nil
+	default:
+		return "", nil, fmt.Errorf("未知的发现报文类型: %s", packet.Type)
+	}
+}
+
+// BroadcastAddrs 获取发送发现报文的广播地址
+// 受限广播在部分系统上只从一个网卡发出, 同时向每个网卡的子网广播地址发送
+func BroadcastAddrs(port int) []*net.UDPAddr {
+	addrs := []*net.UDPAddr{{IP: net.IPv4bcast, Port: port}}
+
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		return addrs
+	}
+	for _, iface := range ifaces {
+		if iface.Flags&net.FlagUp == 0 || iface.Flags&net.FlagBroadcast == 0 || iface.Flags&net.FlagLoopback != 0 {
+			continue
+		}
+		ifaceAddrs, err := iface.Addrs()
+		if err != nil {
+			continue
+		}
+		for _, addr := range ifaceAddrs {
+			ipNet, ok := addr.(*net.IPNet)
+			if !ok {
+				continue
+			}
+			ip, mask := ipNet.IP.To4(), ipNet.Mask
+			if len(mask) == net.IPv6len {
+				mask = mask[12:]
+			}
+			if ip == nil || len(mask) != net.IPv4len {
+				continue
+			}
+			bcast := make(net.IP, net.IPv4len)
+			for i := range ip {
+				bcast[i] = ip[i] | ^mask[i]
+			}
+			addrs = append(addrs, &net.UDPAddr{IP: bcast, Port: port})
+		}
+	}
+	return addrs
+}
@@ -0,0 +1,89 @@
+package message
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/errors"
+)
+
+// NewErrorResponse 将处理请求失败的错误转换为错误响应
+// 响应只包含错误代码和错误消息, 原始错误可能包含服务器上的路径和系统错误, 不发送给客户端;
+// 未携带错误代码的错误按原因归类并使用固定的消息, 无法归类时为内部错误
+func NewErrorResponse(err error) interfaces.ErrorResponse {
+	var e *errors.Error
+	if errors.As(err, &e) {
+		return interfaces.ErrorResponse{
+			Success:    false,
+			Code:       e.Code,
+			Message:    e.Message,
+			Retryable:  e.Retryable,
+			RetryAfter: seconds(e.RetryAfter),
+		}
+	}
+
+	response := interfaces.ErrorResponse{
+		Success: false,
+		Code:    errors.CodeInternal,
+		Message: "服务器内部错误",
+	}
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		response.Code = errors.CodeStorageNotFound
+		response.Message = "文件不存在"
+	case errors.Is(err, os.ErrPermission):
+		response.Code = errors.CodeForbidden
+		response.Message = "没有权限访问文件"
+	case errors.As(err, &syntaxErr), errors.As(err, &typeErr):
+		response.Code = errors.CodeNetworkInvalidData
+		response.Message = "请求数据格式错误"
+	case errors.Is(err, context.DeadlineExceeded), errors.IsTimeout(err):
+		response.Code = errors.CodeNetworkTimeout
+		response.Message = "处理请求超时"
+		response.Retryable = true
+	}
+	return response
+}
+
+// HasErrorDetail 检查错误是否包含不发送给客户端的详细信息, 这些信息应记录在服务器日志中
+func HasErrorDetail(err error) bool {
+	var e *errors.Error
+	return !errors.As(err, &e) || e.Cause != nil
+}
+
+// ParseError 将服务器返回的错误响应转换为错误, 不是错误响应时返回nil
+// 繁忙响应和关闭通知总是错误, 其他响应失败且带有错误代码时为错误响应
+func ParseError(msg *interfaces.Message) error {
+	if err := ParseBusy(msg); err != nil {
+		return err
+	}
+
+	var response interfaces.ErrorResponse
+	if err := json.Unmarshal(msg.Payload, &response); err != nil {
+		return nil
+	}
+	if response.Success || response.Code == "" {
+		return nil
+	}
+	return ResponseError(&response)
+}
+
+// ResponseError 将错误响应还原为错误, 可以用errors.Is与预定义错误实例比较
+func ResponseError(response *interfaces.ErrorResponse) *errors.Error {
+	message := response.Message
+	if response.RetryAfter > 0 {
+		message = fmt.Sprintf("%s, 请在%d秒后重试", message, response.RetryAfter)
+	}
+	return &errors.Error{
+		Code:       response.Code,
+		Message:    message,
+		Retryable:  response.Retryable,
+		RetryAfter: time.Duration(response.RetryAfter) * time.Second,
+	}
+}
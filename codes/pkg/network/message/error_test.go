@@ -0,0 +1,67 @@
+package message
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/errors"
+)
+
+// TestErrorResponse 错误按错误代码发送给客户端, 客户端还原出相同的错误, 原始原因不发送给客户端
+func TestErrorResponse(t *testing.T) {
+	pathErr := &os.PathError{Op: "open", Path: "/srv/pack/mods/a.jar", Err: os.ErrNotExist}
+	tests := []struct {
+		name       string
+		err        error
+		code       string
+		retryable  bool
+		retryAfter time.Duration
+	}{
+		{"coded", errors.NewError(errors.CodeForbidden, "请求路径跳出同步文件夹", pathErr), errors.CodeForbidden, false, 0},
+		{"retryable", errors.NewRetryableError(errors.CodeServiceBusy, "服务器繁忙", 3*time.Second, nil), errors.CodeServiceBusy, true, 3 * time.Second},
+		{"wrapped", fmt.Errorf("发送文件失败: %w", errors.NewError(errors.CodeStorageLoad, "读取文件失败", pathErr)), errors.CodeStorageLoad, false, 0},
+		{"not exist", pathErr, errors.CodeStorageNotFound, false, 0},
+		{"permission", &os.PathError{Op: "open", Path: "/srv/pack/a", Err: os.ErrPermission}, errors.CodeForbidden, false, 0},
+		{"json", json.Unmarshal([]byte("{"), &struct{}{}), errors.CodeNetworkInvalidData, false, 0},
+		{"timeout", fmt.Errorf("读取超时: %w", context.DeadlineExceeded), errors.CodeNetworkTimeout, true, 0},
+		{"internal", fmt.Errorf("stat /srv/pack/mods: input/output error"), errors.CodeInternal, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := NewErrorResponse(tt.err)
+			if response.Success || response.Code != tt.code || response.Retryable != tt.retryable {
+				t.Errorf("错误响应错误: %+v", response)
+			}
+			if strings.Contains(response.Message, "/srv/pack") {
+				t.Errorf("错误响应包含服务器路径: %s", response.Message)
+			}
+
+			payload, err := json.Marshal(response)
+			if err != nil {
+				t.Fatal(err)
+			}
+			parsed := ParseError(&interfaces.Message{Type: "data", Payload: payload})
+			if !errors.Is(parsed, errors.NewError(tt.code, "", nil)) {
+				t.Fatalf("还原的错误代码错误: %v", parsed)
+			}
+			if errors.IsRetryable(parsed) != tt.retryable || errors.GetRetryAfter(parsed) != tt.retryAfter {
+				t.Errorf("还原的重试信息错误: %v", parsed)
+			}
+		})
+	}
+}
+
+// TestParseErrorIgnoresSuccess 成功响应和不带错误代码的响应不是错误响应
+func TestParseErrorIgnoresSuccess(t *testing.T) {
+	for _, payload := range []string{`{"success": true}`, `{"success": false, "message": "失败"}`, `[]`} {
+		if err := ParseError(&interfaces.Message{Type: "data", Payload: json.RawMessage(payload)}); err != nil {
+			t.Errorf("%s: 期望不是错误响应, 实际 %v", payload, err)
+		}
+	}
+}
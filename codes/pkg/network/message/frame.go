@@ -0,0 +1,223 @@
+package message
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"time"
+)
+
+/*
+帧格式(大端序):
+
+	偏移  长度  字段
+	0     2     魔数 "ST"
+	2     1     协议版本
+	3     1     帧类型
+	4     1     标志位, 0x01表示负载使用DEFLATE压缩
+	5     3     保留, 必须为0
+	8     4     流ID, 数据帧所属的传输
+	12    4     负载长度
+	16    n     负载
+
+控制帧的负载是JSON编码的 interfaces.Message, 数据帧的负载是原始文件字节.
+*/
+
+// FrameType 帧类型
+type FrameType uint8
+
+const (
+	// FrameControl 控制帧, 负载为JSON消息
+	FrameControl FrameType = 1
+	// FrameData 数据帧, 负载为原始文件数据
+	FrameData FrameType = 2
+)
+
+const (
+	// FrameVersion 当前帧格式版本
+	FrameVersion = 1
+	// FrameHeaderSize 帧头长度
+	FrameHeaderSize = 16
+	// DefaultMaxFrameSize 默认最大帧负载长度
+	DefaultMaxFrameSize = 16 * 1024 * 1024
+
+	frameMagic0 = 'S'
+	frameMagic1 = 'T'
+
+	// 读写单帧的超时时间
+	frameIOTimeout = 30 * time.Second
+)
+
+// Frame 协议帧
+type Frame struct {
+	Type    FrameType // 帧类型
+	Flags   uint8     // 标志位
+	Stream  uint32    // 流ID
+	Payload []byte    // 负载
+
+	compressible bool // 启用压缩时是否压缩负载
+	rawSize      int  // 压缩前的负载长度, 未压缩时为0
+}
+
+// SetMaxFrameSize 设置允许接收和发送的最大帧负载长度
+func (s *MessageSender) SetMaxFrameSize(size int) {
+	if size <= 0 {
+		size = DefaultMaxFrameSize
+	}
+	s.maxFrameSize = size
+}
+
+// WriteFrame 向连接写入一帧
+// 同一连接上的写入互斥进行, 保证帧不会被其他写入打断; 启用发送队列时由队列协程写入
+func (s *MessageSender) WriteFrame(conn net.Conn, frame *Frame) error {
+	return s.writeFrameContext(context.Background(), conn, frame)
+}
+
+// writeFrameContext 向连接写入一帧, 上下文取消时停止限速等待
+func (s *MessageSender) writeFrameContext(ctx context.Context, conn net.Conn, frame *Frame) error {
+	if conn == nil {
+		return fmt.Errorf("连接为空")
+	}
+	if len(frame.Payload) > s.maxFrameSize {
+		return fmt.Errorf("帧长度超出限制: %d > %d", len(frame.Payload), s.maxFrameSize)
+	}
+
+	st := s.state(conn)
+	// 在调用方协程中压缩, 不占用发送队列
+	if frame.compressible && st.compress.Load() {
+		frame = compressFrame(frame)
+	}
+	// 只限制文件数据, 控制消息不受影响
+	if frame.Type == FrameData {
+		if err := st.throttle(ctx, FrameHeaderSize+len(frame.Payload)); err != nil {
+			return err
+		}
+	}
+	queue, done := s.writer(st)
+	if queue == nil {
+		return s.writeFrame(conn, st, frame)
+	}
+
+	// 等待队列写入完成后再返回, 调用方可以复用负载缓冲
+	item := &outboundFrame{frame: frame, result: make(chan error, 1)}
+	select {
+	case queue <- item:
+	case <-done:
+		return fmt.Errorf("连接已关闭")
+	}
+	select {
+	case err := <-item.result:
+		return err
+	case <-done:
+		return fmt.Errorf("连接已关闭")
+	}
+}
+
+// writeFrame 直接向连接写入一帧
+func (s *MessageSender) writeFrame(conn net.Conn, st *connState, frame *Frame) error {
+	var header [FrameHeaderSize]byte
+	header[0] = frameMagic0
+	header[1] = frameMagic1
+	header[2] = FrameVersion
+	header[3] = byte(frame.Type)
+	header[4] = frame.Flags
+	binary.BigEndian.PutUint32(header[8:12], frame.Stream)
+	binary.BigEndian.PutUint32(header[12:16], uint32(len(frame.Payload)))
+
+	st.writeMu.Lock()
+	defer st.writeMu.Unlock()
+
+	// 设置写入超时
+	if err := conn.SetWriteDeadline(time.Now().Add(frameIOTimeout)); err != nil {
+		return fmt.Errorf("设置写入超时失败: %v", err)
+	}
+	defer conn.SetWriteDeadline(time.Time{}) // 清除超时设置
+
+	buffers := net.Buffers{header[:], frame.Payload}
+	if _, err := buffers.WriteTo(conn); err != nil {
+		return fmt.Errorf("写入帧失败: %v", err)
+	}
+
+	raw := len(frame.Payload)
+	if frame.rawSize > 0 {
+		raw = frame.rawSize
+	}
+	st.recordStats(len(frame.Payload), raw)
+	return nil
+}
+
+// ReadFrame 从连接读取一帧
+// 使用连接上持久的读取缓冲, 不会丢失已缓冲的后续数据
+func (s *MessageSender) ReadFrame(conn net.Conn) (*Frame, error) {
+	if conn == nil {
+		return nil, fmt.Errorf("连接为空")
+	}
+
+	st := s.state(conn)
+	st.readMu.Lock()
+	defer st.readMu.Unlock()
+
+	// 设置读取超时
+	if s.readTimeout > 0 {
+		if err := conn.SetReadDeadline(time.Now().Add(s.readTimeout)); err != nil {
+			return nil, fmt.Errorf("设置读取超时失败: %v", err)
+		}
+		defer conn.SetReadDeadline(time.Time{}) // 清除超时设置
+	}
+
+	var header [FrameHeaderSize]byte
+	if _, err := io.ReadFull(st.reader, header[:]); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, fmt.Errorf("读取帧头失败: %v", err)
+	}
+
+	if header[0] != frameMagic0 || header[1] != frameMagic1 {
+		return nil, fmt.Errorf("无效的帧头: %x", header[:4])
+	}
+	if header[2] != FrameVersion {
+		return nil, fmt.Errorf("不支持的帧版本: %d", header[2])
+	}
+
+	// 保留字段和未定义的标志位留给以后的版本, 收到非0值说明对端使用了不兼容的格式
+	if header[5] != 0 || header[6] != 0 || header[7] != 0 {
+		return nil, fmt.Errorf("帧头保留字段不为0: %x", header[5:8])
+	}
+	if header[4]&^FlagCompressed != 0 {
+		return nil, fmt.Errorf("未知的帧标志位: %#x", header[4])
+	}
+
+	frame := &Frame{
+		Type:   FrameType(header[3]),
+		Flags:  header[4],
+		Stream: binary.BigEndian.Uint32(header[8:12]),
+	}
+	if frame.Type != FrameControl && frame.Type != FrameData {
+		return nil, fmt.Errorf("未知的帧类型: %d", frame.Type)
+	}
+
+	length := binary.BigEndian.Uint32(header[12:16])
+	if int64(length) > int64(s.maxFrameSize) {
+		return nil, fmt.Errorf("帧长度超出限制: %d > %d", length, s.maxFrameSize)
+	}
+
+	frame.Payload = make([]byte, length)
+	if _, err := io.ReadFull(st.reader, frame.Payload); err != nil {
+		return nil, fmt.Errorf("读取帧负载失败: %v", err)
+	}
+
+	// 边接收边解压, 调用方拿到的始终是原始数据
+	if frame.Flags&FlagCompressed != 0 {
+		data, err := s.decompressPayload(frame.Payload)
+		if err != nil {
+			return nil, err
+		}
+		frame.Payload = data
+		frame.Flags &^= FlagCompressed
+	}
+	st.recordStats(int(length), len(frame.Payload))
+	return frame, nil
+}
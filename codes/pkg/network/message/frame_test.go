@@ -0,0 +1,130 @@
+package message
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"synctools/codes/internal/testutil"
+)
+
+// TestFrameRoundTrip 控制帧和数据帧写入后按原样读出, 压缩的帧读出时已解压
+func TestFrameRoundTrip(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	sender := NewMessageSender(testutil.NewNopLogger())
+	sender.SetCompression(client, true)
+
+	frames := []*Frame{
+		{Type: FrameControl, Payload: []byte(`{"type":"ping"}`)},
+		{Type: FrameData, Stream: 7, Payload: []byte("0123456789")},
+		{Type: FrameData, Stream: 8, Payload: bytes.Repeat([]byte("a"), 64*1024), compressible: true},
+	}
+	errc := make(chan error, 1)
+	go func() {
+		for _, frame := range frames {
+			if err := sender.WriteFrame(client, frame); err != nil {
+				errc <- err
+				return
+			}
+		}
+		errc <- nil
+	}()
+
+	for _, want := range frames {
+		got, err := sender.ReadFrame(server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Type != want.Type || got.Stream != want.Stream || got.Flags != 0 || !bytes.Equal(got.Payload, want.Payload) {
+			t.Errorf("读出的帧错误: type %d stream %d flags %d len %d", got.Type, got.Stream, got.Flags, len(got.Payload))
+		}
+	}
+	if err := <-errc; err != nil {
+		t.Fatal(err)
+	}
+	if stats := sender.Stats(server); stats.WireBytes >= stats.RawBytes {
+		t.Errorf("压缩的帧应减少网络字节数: %+v", stats)
+	}
+}
+
+// TestReadFrameMalformed 拒绝魔数、版本、类型、保留字段、标志位或长度不合法的帧头
+func TestReadFrameMalformed(t *testing.T) {
+	valid := func() []byte {
+		header := make([]byte, FrameHeaderSize)
+		header[0], header[1], header[2], header[3] = frameMagic0, frameMagic1, FrameVersion, byte(FrameControl)
+		return header
+	}
+
+	tests := []struct {
+		name   string
+		modify func(header []byte)
+		want   string
+	}{
+		{"magic", func(h []byte) { h[0] = 'X' }, "无效的帧头"},
+		{"version", func(h []byte) { h[2] = FrameVersion + 1 }, "不支持的帧版本"},
+		{"type", func(h []byte) { h[3] = 9 }, "未知的帧类型"},
+		{"reserved", func(h []byte) { h[6] = 1 }, "保留字段"},
+		{"flags", func(h []byte) { h[4] = FlagCompressed | 0x80 }, "未知的帧标志位"},
+		{"length", func(h []byte) { binary.BigEndian.PutUint32(h[12:16], DefaultMaxFrameSize+1) }, "帧长度超出限制"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, server := net.Pipe()
+			defer client.Close()
+			defer server.Close()
+
+			header := valid()
+			tt.modify(header)
+			go client.Write(header)
+
+			_, err := NewMessageSender(testutil.NewNopLogger()).ReadFrame(server)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("期望错误 %q, 实际 %v", tt.want, err)
+			}
+		})
+	}
+}
+
+// TestStartWriterConcurrent 启用发送队列与其他协程的写入并发进行, 所有帧完整送达
+func TestStartWriterConcurrent(t *testing.T) {
+	client, server := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+
+	sender := NewMessageSender(testutil.NewNopLogger())
+	defer sender.Release(client)
+
+	const writers = 8
+	errc := make(chan error, writers)
+	for i := 0; i < writers; i++ {
+		go func(i int) {
+			errc <- sender.WriteFrame(client, &Frame{Type: FrameData, Stream: uint32(i), Payload: []byte("data")})
+		}(i)
+	}
+	// 部分写入已经开始直接写入连接后再启用发送队列
+	time.Sleep(10 * time.Millisecond)
+	sender.StartWriter(client, 4)
+
+	seen := make(map[uint32]bool)
+	for i := 0; i < writers; i++ {
+		frame, err := sender.ReadFrame(server)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(frame.Payload) != "data" || seen[frame.Stream] {
+			t.Fatalf("帧被其他写入打断: stream %d payload %q", frame.Stream, frame.Payload)
+		}
+		seen[frame.Stream] = true
+	}
+	for i := 0; i < writers; i++ {
+		if err := <-errc; err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package message
+
+import (
+	"time"
+
+	"synctools/codes/internal/interfaces"
+)
+
+const (
+	// DefaultHeartbeatInterval 默认心跳间隔
+	DefaultHeartbeatInterval = 15 * time.Second
+	// DefaultHeartbeatMisses 默认允许连续丢失的心跳次数
+	DefaultHeartbeatMisses = 3
+
+	// MsgPing 心跳请求
+	MsgPing = "ping"
+	// MsgPong 心跳响应
+	MsgPong = "pong"
+)
+
+// HeartbeatSettings 从配置读取心跳间隔和允许丢失的次数, 未配置时使用默认值
+func HeartbeatSettings(config *interfaces.Config) (time.Duration, int) {
+	interval := DefaultHeartbeatInterval
+	misses := DefaultHeartbeatMisses
+	if config == nil {
+		return interval, misses
+	}
+	if config.HeartbeatInterval > 0 {
+		interval = time.Duration(config.HeartbeatInterval) * time.Second
+	}
+	if config.HeartbeatMisses > 0 {
+		misses = config.HeartbeatMisses
+	}
+	return interval, misses
+}
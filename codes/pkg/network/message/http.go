@@ -0,0 +1,20 @@
+package message
+
+// HTTP传输的请求路径
+const (
+	// HTTPManifestPath 获取服务器配置和文件清单
+	HTTPManifestPath = "/manifest"
+	// HTTPFilesPath 下载文件, 后接相对于同步目录的文件路径, 打包同步的压缩包同样由此下载
+	HTTPFilesPath = "/files/"
+)
+
+// HTTPCapabilities HTTP传输具备的功能
+// 文件按Range续传, 多个请求可以并行; HTTP没有服务器推送, 不支持文件清单变化通知
+func HTTPCapabilities() []string {
+	return []string{
+		CapChunkedTransfer,
+		CapResume,
+		CapMultiplex,
+		CapHashMD5,
+	}
+}
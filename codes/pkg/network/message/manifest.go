@@ -0,0 +1,47 @@
+package message
+
+import (
+	"path"
+	"path/filepath"
+
+	"synctools/codes/internal/interfaces"
+)
+
+// 文件清单消息
+const (
+	// MsgManifestChanged 服务器文件清单已变化, 由服务器主动推送
+	MsgManifestChanged = "manifest_changed"
+	// MsgManifestRequest 请求服务器当前的文件清单
+	MsgManifestRequest = "manifest_request"
+	// MsgManifestResponse 文件清单响应
+	MsgManifestResponse = "manifest_response"
+)
+
+// ClientConfig 生成发送给客户端的服务器配置
+// 只复制客户端需要的字段, 配置中新增的字段默认不发送; folders为客户端可见的同步文件夹, 重定向只保留这些文件夹的
+func ClientConfig(config *interfaces.Config, folders []interfaces.SyncFolder) *interfaces.Config {
+	visible := &interfaces.Config{
+		UUID:         config.UUID,
+		Type:         config.Type,
+		Name:         config.Name,
+		Version:      config.Version,
+		SyncFolders:  folders,
+		IgnoreList:   config.IgnoreList,
+		LastModified: config.LastModified,
+		CreateTime:   config.CreateTime,
+	}
+	for _, redirect := range config.FolderRedirects {
+		for _, folder := range folders {
+			if cleanSlash(redirect.ServerPath) == cleanSlash(folder.Path) {
+				visible.FolderRedirects = append(visible.FolderRedirects, redirect)
+				break
+			}
+		}
+	}
+	return visible
+}
+
+// cleanSlash 规范化使用/或系统分隔符的路径
+func cleanSlash(p string) string {
+	return path.Clean(filepath.ToSlash(p))
+}
@@ -0,0 +1,64 @@
+package message
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+)
+
+// TestClientConfig 发送给客户端的配置只包含白名单中的字段, 重定向只保留可见的同步文件夹
+func TestClientConfig(t *testing.T) {
+	now := time.Now()
+	config := &interfaces.Config{
+		UUID:            "uuid",
+		Type:            interfaces.ConfigTypeServer,
+		Name:            "整合包",
+		Version:         "1.0.0",
+		Host:            "0.0.0.0",
+		Port:            25000,
+		HTTPPort:        25001,
+		Listeners:       []interfaces.ListenerConfig{{Name: "local", Network: "unix", Address: "/run/synctools.sock"}},
+		UploadLimit:     1024,
+		SyncDir:         "/srv/pack",
+		SyncFolders:     []interfaces.SyncFolder{{Path: "mods", IsEnabled: true}, {Path: "private", IsEnabled: true}},
+		IgnoreList:      []string{"*.log"},
+		FolderRedirects: []interfaces.FolderRedirect{{ServerPath: "mods", ClientPath: "mods2"}, {ServerPath: "private", ClientPath: "p"}},
+		TLS:             interfaces.TLSConfig{Enabled: true, CertFile: "/etc/cert.pem", KeyFile: "/etc/key.pem"},
+		Proxy:           interfaces.ProxyConfig{Type: interfaces.ProxyHTTP, Address: "proxy:8080", Username: "user", Password: "password"},
+		ManifestKey:     "key",
+		AuthSecret:      "secret",
+		AccessTokens:    []interfaces.AccessToken{{Name: "reader", Secret: "secret"}},
+		LastModified:    now,
+		CreateTime:      now,
+	}
+	visible := ClientConfig(config, config.SyncFolders[:1])
+
+	if len(visible.SyncFolders) != 1 || visible.SyncFolders[0].Path != "mods" {
+		t.Errorf("同步文件夹错误: %v", visible.SyncFolders)
+	}
+	if len(visible.FolderRedirects) != 1 || visible.FolderRedirects[0].ServerPath != "mods" {
+		t.Errorf("重定向错误: %v", visible.FolderRedirects)
+	}
+
+	// 白名单之外的字段都必须为零值, 配置新增的字段默认不发送
+	allowed := map[string]bool{
+		"UUID": true, "Type": true, "Name": true, "Version": true,
+		"SyncFolders": true, "IgnoreList": true, "FolderRedirects": true,
+		"LastModified": true, "CreateTime": true,
+	}
+	v := reflect.ValueOf(visible).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		name := v.Type().Field(i).Name
+		if allowed[name] {
+			if v.Field(i).IsZero() {
+				t.Errorf("字段 %s 没有发送给客户端", name)
+			}
+			continue
+		}
+		if !v.Field(i).IsZero() {
+			t.Errorf("字段 %s 不应发送给客户端: %v", name, v.Field(i).Interface())
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package message
+
+import (
+	"container/list"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"os"
+	"sync"
+)
+
+// md5CacheSize 缓存的文件MD5数量上限
+const md5CacheSize = 4096
+
+// MD5Cache 按路径、大小和修改时间缓存文件MD5, 文件变化后重新计算
+// 发送文件和HTTP下载的ETag都需要MD5, 避免每次请求都读取整个文件; 超出数量上限时淘汰最久未使用的条目; 零值可直接使用
+type MD5Cache struct {
+	mu      sync.Mutex
+	entries map[md5CacheKey]*list.Element
+	order   *list.List // 按使用时间排序, 最近使用的在前
+}
+
+// md5CacheKey 缓存条目的键, 文件大小或修改时间变化后不再命中
+type md5CacheKey struct {
+	path    string
+	size    int64
+	modTime int64
+}
+
+// md5CacheEntry 缓存的文件MD5
+type md5CacheEntry struct {
+	key md5CacheKey
+	md5 string
+}
+
+// Get 获取打开的文件的MD5, 缓存未命中时流式计算并重置读取位置
+func (c *MD5Cache) Get(ctx context.Context, file *os.File, info os.FileInfo) (string, error) {
+	key := md5CacheKey{path: file.Name(), size: info.Size(), modTime: info.ModTime().UnixNano()}
+	if md5sum, ok := c.lookup(key); ok {
+		return md5sum, nil
+	}
+
+	// 流式计算MD5, 不把文件读入内存
+	hash := md5.New()
+	if _, err := io.Copy(hash, ContextReader(ctx, file)); err != nil {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	md5sum := hex.EncodeToString(hash.Sum(nil))
+	c.add(key, md5sum)
+	return md5sum, nil
+}
+
+// lookup 查找缓存的MD5并标记为最近使用
+func (c *MD5Cache) lookup(key md5CacheKey) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return "", false
+	}
+	c.order.MoveToFront(elem)
+	return elem.Value.(*md5CacheEntry).md5, true
+}
+
+// add 添加缓存条目, 超出数量上限时淘汰最久未使用的条目
+func (c *MD5Cache) add(key md5CacheKey, md5sum string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.entries == nil {
+		c.entries = make(map[md5CacheKey]*list.Element)
+		c.order = list.New()
+	}
+	if elem, ok := c.entries[key]; ok {
+		c.order.MoveToFront(elem)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&md5CacheEntry{key: key, md5: md5sum})
+	for c.order.Len() > md5CacheSize {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*md5CacheEntry).key)
+	}
+}
@@ -0,0 +1,108 @@
+package message
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/internal/testutil"
+)
+
+// TestMD5CacheBounded 文件MD5缓存超出数量上限时淘汰最久未使用的条目, 文件变化后不再命中
+func TestMD5CacheBounded(t *testing.T) {
+	var c MD5Cache
+	for i := 0; i < md5CacheSize+10; i++ {
+		c.add(md5CacheKey{path: "a", size: int64(i)}, "md5")
+		if i == 0 {
+			// 最先添加的条目最近使用过, 不被淘汰
+			continue
+		}
+		c.lookup(md5CacheKey{path: "a", size: 0})
+	}
+	if len(c.entries) != md5CacheSize || c.order.Len() != md5CacheSize {
+		t.Fatalf("缓存条目数 %d, 期望 %d", len(c.entries), md5CacheSize)
+	}
+	if _, ok := c.lookup(md5CacheKey{path: "a", size: 0}); !ok {
+		t.Error("最近使用的条目不应被淘汰")
+	}
+	if _, ok := c.lookup(md5CacheKey{path: "a", size: 1}); ok {
+		t.Error("最久未使用的条目应被淘汰")
+	}
+	if _, ok := c.lookup(md5CacheKey{path: "a", size: 0, modTime: 1}); ok {
+		t.Error("修改时间变化后不应命中")
+	}
+}
+
+// TestSendFileResumeOffset 只有请求的MD5与文件一致时才从请求的偏移量续传, 没有MD5可以校验时从头发送
+func TestSendFileResumeOffset(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.bin")
+	data := []byte("0123456789abcdef")
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	sum := md5.Sum(data)
+	md5sum := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name   string
+		offset int64
+		md5    string
+		want   int64
+	}{
+		{"resume", 6, md5sum, 6},
+		{"changed", 6, "0cc175b9c0f1b6a831c399e269772661", 0},
+		{"no md5", 6, "", 0},
+		{"beyond size", int64(len(data)) + 1, md5sum, 0},
+	}
+	cache := &MD5Cache{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, client := net.Pipe()
+			defer server.Close()
+			defer client.Close()
+
+			sender := NewMessageSender(testutil.NewNopLogger())
+			sender.SetMD5Cache(cache)
+			done := make(chan error, 1)
+			go func() {
+				req := &interfaces.FileTransferRequest{FilePath: "a.bin", Offset: tt.offset, MD5: tt.md5}
+				done <- sender.SendFileChunked(context.Background(), server, 1, "", path, req, nil)
+			}()
+
+			destPath := filepath.Join(t.TempDir(), "a.bin")
+			if tt.want > 0 {
+				// 已接收的部分作为续传的.part文件
+				if err := os.WriteFile(destPath+PartFileSuffix, data[:tt.want], 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			receiver := NewMessageSender(testutil.NewNopLogger())
+			msg, err := receiver.ReceiveMessage(client)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var info interfaces.FileMessageInfo
+			if err := json.Unmarshal(msg.Payload, &info); err != nil {
+				t.Fatal(err)
+			}
+			if info.Offset != tt.want || info.MD5 != md5sum {
+				t.Fatalf("续传信息错误: offset %d, md5 %s", info.Offset, info.MD5)
+			}
+			if err := receiver.receiveFileData(context.Background(), &connFrameSource{sender: receiver, conn: client}, &info, destPath, nil); err != nil {
+				t.Fatal(err)
+			}
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+			if got, err := os.ReadFile(destPath); err != nil || string(got) != string(data) {
+				t.Fatalf("接收的文件错误: %q, %v", got, err)
+			}
+		})
+	}
+}
@@ -1,40 +1,178 @@
 package message
 
 import (
+	"bufio"
+	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"synctools/codes/internal/interfaces"
 )
 
+const (
+	// DefaultChunkSize 默认文件分块大小
+	DefaultChunkSize = 64 * 1024
+	// MinChunkSize 最小文件分块大小
+	MinChunkSize = 4 * 1024
+	// MaxChunkSize 最大文件分块大小
+	MaxChunkSize = 1024 * 1024
+)
+
 // MessageSender 消息发送器
 type MessageSender struct {
-	logger interfaces.Logger
+	logger       interfaces.Logger
+	maxFrameSize int
+	readTimeout  time.Duration
+	states       map[net.Conn]*connState
+	statesMu     sync.Mutex
+	md5Cache     *MD5Cache // 发送文件时使用的MD5缓存, 为nil时每次计算
+}
+
+// connState 单个连接的收发状态
+type connState struct {
+	reader  *bufio.Reader       // 连接上持久的读取缓冲, 避免帧之间的数据丢失
+	readMu  sync.Mutex          // 读取锁, 保证帧被完整读取
+	writeMu sync.Mutex          // 写入锁, 保证帧被完整写入
+	queue   chan *outboundFrame // 发送队列, 为空时直接写入连接, 由MessageSender.statesMu保护
+	done    chan struct{}       // 发送队列关闭信号, 由MessageSender.statesMu保护
+
+	compress  atomic.Bool  // 是否压缩发送的帧
+	wireBytes atomic.Int64 // 网络上收发的字节数
+	rawBytes  atomic.Int64 // 压缩前的字节数
+
+	limitMu       sync.Mutex
+	writeLimiters []*RateLimiter // 发送数据帧的限速器
+
+	ctx    context.Context // 连接的上下文, 释放连接时取消, 停止限速等待
+	cancel context.CancelFunc
+}
+
+// outboundFrame 发送队列中的帧
+type outboundFrame struct {
+	frame  *Frame
+	result chan error
 }
 
 // NewMessageSender 创建新的消息发送器
 func NewMessageSender(logger interfaces.Logger) *MessageSender {
 	return &MessageSender{
-		logger: logger,
+		logger:       logger,
+		maxFrameSize: DefaultMaxFrameSize,
+		readTimeout:  frameIOTimeout,
+		states:       make(map[net.Conn]*connState),
+	}
+}
+
+// SetMD5Cache 设置发送文件时使用的MD5缓存, 多个连接的发送器可以共用同一缓存
+func (s *MessageSender) SetMD5Cache(cache *MD5Cache) {
+	s.md5Cache = cache
+}
+
+// SetReadTimeout 设置读取单帧的超时时间, 0表示不超时
+// 由后台循环持续读取的连接应关闭读取超时, 改为在等待响应处计时
+func (s *MessageSender) SetReadTimeout(timeout time.Duration) {
+	s.readTimeout = timeout
+}
+
+// state 获取连接对应的收发状态, 不存在时创建
+func (s *MessageSender) state(conn net.Conn) *connState {
+	s.statesMu.Lock()
+	defer s.statesMu.Unlock()
+
+	st, ok := s.states[conn]
+	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
+		st = &connState{
+			reader: bufio.NewReader(conn),
+			ctx:    ctx,
+			cancel: cancel,
+		}
+		s.states[conn] = st
+	}
+	return st
+}
+
+// Release 释放连接对应的收发状态, 连接关闭时调用
+func (s *MessageSender) Release(conn net.Conn) {
+	s.statesMu.Lock()
+	defer s.statesMu.Unlock()
+	if st, ok := s.states[conn]; ok {
+		st.cancel()
+		if st.done != nil {
+			close(st.done)
+		}
+	}
+	delete(s.states, conn)
+}
+
+// StartWriter 为连接启用发送队列
+// 启用后所有写入由单独的协程按顺序完成, 多个并发传输的帧在队列中交替发送
+func (s *MessageSender) StartWriter(conn net.Conn, queueSize int) {
+	st := s.state(conn)
+
+	s.statesMu.Lock()
+	if st.queue != nil {
+		s.statesMu.Unlock()
+		return
+	}
+	queue := make(chan *outboundFrame, queueSize)
+	done := make(chan struct{})
+	st.queue, st.done = queue, done
+	s.statesMu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case item := <-queue:
+				item.result <- s.writeFrame(conn, st, item.frame)
+			case <-done:
+				return
+			}
+		}
+	}()
+}
+
+// writer 获取连接的发送队列, 未启用发送队列时返回nil
+// 发送队列可能由其他协程启用, 需要在statesMu保护下读取
+func (s *MessageSender) writer(st *connState) (chan<- *outboundFrame, <-chan struct{}) {
+	s.statesMu.Lock()
+	defer s.statesMu.Unlock()
+	return st.queue, st.done
+}
+
+// NormalizeChunkSize 将请求的分块大小限制在允许范围内
+func NormalizeChunkSize(size int) int {
+	switch {
+	case size <= 0:
+		return DefaultChunkSize
+	case size < MinChunkSize:
+		return MinChunkSize
+	case size > MaxChunkSize:
+		return MaxChunkSize
+	default:
+		return size
 	}
 }
 
 // SendMessage 发送消息到指定连接
 func (s *MessageSender) SendMessage(conn net.Conn, msgType string, uuid string, payload interface{}) error {
+	return s.SendMessageWithID(conn, 0, msgType, uuid, payload)
+}
+
+// SendMessageWithID 发送携带请求ID的消息, 用于请求和对应的响应
+func (s *MessageSender) SendMessageWithID(conn net.Conn, id uint32, msgType string, uuid string, payload interface{}) error {
 	if conn == nil {
 		return fmt.Errorf("连接为空")
 	}
 
-	// 设置写入超时
-	if err := conn.SetWriteDeadline(time.Now().Add(30 * time.Second)); err != nil {
-		return fmt.Errorf("设置写入超时失败: %v", err)
-	}
-	defer conn.SetWriteDeadline(time.Time{}) // 清除超时设置
-
 	// 将payload转换为json.RawMessage
 	var payloadJSON json.RawMessage
 	if payload != nil {
@@ -50,6 +188,7 @@ func (s *MessageSender) SendMessage(conn net.Conn, msgType string, uuid string,
 	}
 
 	msg := &interfaces.Message{
+		ID:      id,
 		Type:    msgType,
 		UUID:    uuid,
 		Payload: payloadJSON,
@@ -66,17 +205,17 @@ func (s *MessageSender) SendMessage(conn net.Conn, msgType string, uuid string,
 	}
 
 	s.logger.Debug("发送消息", interfaces.Fields{
+		"id":      id,
 		"type":    msgType,
 		"uuid":    uuid,
 		"payload": s.FormatPayload(payloadJSON),
-		"data":    string(data),
 	})
 
-	// 写入数据
-	if _, err := conn.Write(append(data, '\n')); err != nil {
+	// 写入控制帧
+	if err := s.WriteFrame(conn, &Frame{Type: FrameControl, Payload: data, compressible: true}); err != nil {
 		s.logger.Error("写入数据失败", interfaces.Fields{
 			"error": err,
-			"data":  string(data),
+			"type":  msgType,
 		})
 		return fmt.Errorf("发送消息失败: %v", err)
 	}
@@ -86,42 +225,35 @@ func (s *MessageSender) SendMessage(conn net.Conn, msgType string, uuid string,
 
 // ReceiveMessage 从连接接收消息
 func (s *MessageSender) ReceiveMessage(conn net.Conn) (*interfaces.Message, error) {
-	if conn == nil {
-		return nil, fmt.Errorf("连接为空")
-	}
-
-	// 设置读取超时
-	if err := conn.SetReadDeadline(time.Now().Add(30 * time.Second)); err != nil {
-		return nil, fmt.Errorf("设置读取超时失败: %v", err)
-	}
-	defer conn.SetReadDeadline(time.Time{}) // 清除超时设置
-
-	// 读取原始数据
-	decoder := json.NewDecoder(conn)
-	var rawData json.RawMessage
-	if err := decoder.Decode(&rawData); err != nil {
-		s.logger.Error("读取原始数据失败", interfaces.Fields{
+	frame, err := s.ReadFrame(conn)
+	if err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		s.logger.Error("读取帧失败", interfaces.Fields{
 			"error": err,
-			"data":  string(rawData),
 		})
 		return nil, fmt.Errorf("接收消息失败: %v", err)
 	}
+	if frame.Type != FrameControl {
+		return nil, fmt.Errorf("收到意外的数据帧: 流 %d, 长度 %d", frame.Stream, len(frame.Payload))
+	}
+	return s.DecodeMessage(frame)
+}
 
-	s.logger.Debug("接收原始数据", interfaces.Fields{
-		"data": s.FormatPayload(rawData),
-	})
-
-	// 尝试解析消息
+// DecodeMessage 解析控制帧中的消息
+func (s *MessageSender) DecodeMessage(frame *Frame) (*interfaces.Message, error) {
 	var msg interfaces.Message
-	if err := json.Unmarshal(rawData, &msg); err != nil {
+	if err := json.Unmarshal(frame.Payload, &msg); err != nil {
 		s.logger.Error("解析消息失败", interfaces.Fields{
 			"error": err,
-			"data":  string(rawData),
+			"data":  s.FormatPayload(frame.Payload),
 		})
 		return nil, fmt.Errorf("解析消息失败: %v", err)
 	}
 
 	s.logger.Debug("接收消息", interfaces.Fields{
+		"id":      msg.ID,
 		"type":    msg.Type,
 		"uuid":    msg.UUID,
 		"payload": s.FormatPayload(msg.Payload),
@@ -131,146 +263,337 @@ func (s *MessageSender) ReceiveMessage(conn net.Conn) (*interfaces.Message, erro
 }
 
 // SendFile 发送文件
-func (s *MessageSender) SendFile(conn net.Conn, uuid string, path string, progress chan<- interfaces.Progress) error {
-	// 1. 发送文件信息
-	fileInfo, err := os.Stat(path)
+func (s *MessageSender) SendFile(ctx context.Context, conn net.Conn, uuid string, path string, progress chan<- interfaces.Progress) error {
+	return s.SendFileChunked(ctx, conn, 0, uuid, path, &interfaces.FileTransferRequest{
+		FilePath: filepath.Base(path),
+	}, progress)
+}
+
+// SendFileChunked 以分块方式流式发送文件
+// 先发送包含大小和MD5的file消息, 再按块发送原始数据帧, 内存占用只与块大小有关
+// 数据帧的流ID与请求ID相同, 接收方据此区分同一连接上并发的传输
+// 上下文取消时停止发送并返回取消原因, 接收方的文件保持不变
+func (s *MessageSender) SendFileChunked(ctx context.Context, conn net.Conn, id uint32, uuid string, path string, req *interfaces.FileTransferRequest, progress chan<- interfaces.Progress) error {
+	file, err := os.Open(path)
 	if err != nil {
-		return fmt.Errorf("获取文件信息失败: %v", err)
+		return fmt.Errorf("打开文件失败: %v", err)
 	}
+	defer file.Close()
 
-	// 2. 读取整个文件内容
-	fileContent, err := os.ReadFile(path)
+	fileInfo, err := file.Stat()
 	if err != nil {
-		return fmt.Errorf("读取文件失败: %v", err)
+		return fmt.Errorf("获取文件信息失败: %v", err)
+	}
+	if fileInfo.IsDir() {
+		return fmt.Errorf("不能发送目录: %s", path)
 	}
 
-	// 3. 发送文件内容
-	chunk := struct {
-		Data []byte `json:"data"`
-	}{
-		Data: fileContent,
+	// 1. 获取文件MD5, 文件未变化时使用缓存, 不重复读取整个文件
+	cache := s.md5Cache
+	if cache == nil {
+		cache = &MD5Cache{}
+	}
+	md5sum, err := cache.Get(ctx, file, fileInfo)
+	if err != nil {
+		return fmt.Errorf("计算文件MD5失败: %w", err)
 	}
 
-	// 发送前更新进度为0%
-	if progress != nil {
-		progress <- interfaces.Progress{
-			Total:     fileInfo.Size(),
-			Current:   0,
-			Speed:     0,
-			Remaining: fileInfo.Size(),
-		}
+	// 2. 确定起始偏移量, 文件已变化、偏移量无效或续传请求没有MD5可以校验时从头传输
+	normalizedPath := filepath.ToSlash(req.FilePath)
+	size := fileInfo.Size()
+	offset := req.Offset
+	if offset < 0 || offset > size || req.MD5 != md5sum {
+		offset = 0
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		return fmt.Errorf("重置文件读取位置失败: %v", err)
 	}
 
-	if err := s.SendMessage(conn, "file_data", uuid, chunk); err != nil {
-		return fmt.Errorf("发送文件数据失败: %v", err)
+	// 3. 发送文件信息
+	if err := s.SendMessageWithID(conn, id, "file", uuid, interfaces.FileMessageInfo{
+		Name:   filepath.Base(normalizedPath),
+		Size:   size,
+		MD5:    md5sum,
+		Path:   normalizedPath,
+		Offset: offset,
+	}); err != nil {
+		return fmt.Errorf("发送文件信息失败: %v", err)
 	}
 
-	// 发送完成后更新进度为100%
-	if progress != nil {
-		progress <- interfaces.Progress{
-			Total:     fileInfo.Size(),
-			Current:   fileInfo.Size(),
-			Speed:     float64(fileInfo.Size()),
-			Remaining: 0,
+	// 4. 分块发送文件内容
+	tracker := newProgressTracker(normalizedPath, size, offset, progress)
+	tracker.report()
+
+	// 已压缩格式的文件不再压缩
+	compressible := IsCompressible(path)
+
+	// 限速时按限速器的单次额度缩小分块, 一帧的等待时间不会超过接收方的超时
+	st := s.state(conn)
+	buf := make([]byte, NormalizeChunkSize(req.ChunkSize))
+	for offset < size {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		n, readErr := io.ReadFull(file, buf[:st.chunkLimit(len(buf))])
+		if n > 0 {
+			if err := s.writeFrameContext(ctx, conn, &Frame{Type: FrameData, Stream: id, Payload: buf[:n], compressible: compressible}); err != nil {
+				if ctx.Err() != nil {
+					return ctx.Err()
+				}
+				return fmt.Errorf("发送文件数据失败: %v", err)
+			}
+			offset += int64(n)
+			tracker.add(int64(n))
+		}
+
+		if readErr == io.EOF || readErr == io.ErrUnexpectedEOF {
+			if offset < size {
+				// 文件在发送过程中被截断
+				return fmt.Errorf("文件读取提前结束: 已发送 %d/%d", offset, size)
+			}
+			break
+		}
+		if readErr != nil {
+			return fmt.Errorf("读取文件失败: %v", readErr)
 		}
 	}
 
+	s.logger.Debug("文件发送完成", interfaces.Fields{
+		"path":   normalizedPath,
+		"md5":    md5sum,
+		"size":   s.FormatFileSize(size),
+		"resume": req.Offset,
+	})
 	return nil
 }
 
-// ReceiveFile 接收文件
-func (s *MessageSender) ReceiveFile(conn net.Conn, destDir string, progress chan<- interfaces.Progress) error {
+// ReceiveFile 从连接接收文件
+func (s *MessageSender) ReceiveFile(ctx context.Context, conn net.Conn, destPath string, progress chan<- interfaces.Progress) error {
+	return s.ReceiveFileFrom(ctx, &connFrameSource{sender: s, conn: conn}, destPath, progress)
+}
+
+// ReceiveFileFrom 从帧来源接收文件
+// 数据写入目标路径旁的.part文件, 连接中断时保留以便续传, 全部接收并校验MD5后再替换目标文件
+// 上下文取消时保留.part文件以便下次续传并返回取消原因, 目标文件保持不变
+func (s *MessageSender) ReceiveFileFrom(ctx context.Context, source FrameSource, destPath string, progress chan<- interfaces.Progress) error {
 	// 1. 接收文件信息
-	msg, err := s.ReceiveMessage(conn)
+	frame, err := source.NextFrame()
 	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
 		return fmt.Errorf("接收文件信息失败: %v", err)
 	}
-
+	if frame.Type != FrameControl {
+		return fmt.Errorf("收到意外的数据帧: 流 %d", frame.Stream)
+	}
+	msg, err := s.DecodeMessage(frame)
+	if err != nil {
+		return fmt.Errorf("接收文件信息失败: %v", err)
+	}
+	if err := checkFailureMessage(msg); err != nil {
+		return err
+	}
 	if msg.Type != "file" {
 		return fmt.Errorf("收到意外的消息类型: %s", msg.Type)
 	}
 
-	var fileInfo struct {
-		Name string `json:"name"`
-		Size int64  `json:"size"`
-		MD5  string `json:"md5"`
-		Path string `json:"path"`
-	}
+	var fileInfo interfaces.FileMessageInfo
 	if err := json.Unmarshal(msg.Payload, &fileInfo); err != nil {
 		return fmt.Errorf("解析文件信息失败: %v", err)
 	}
 
 	s.logger.Debug("接收文件信息", interfaces.Fields{
-		"name": fileInfo.Name,
-		"path": fileInfo.Path,
-		"size": s.FormatFileSize(fileInfo.Size),
+		"name":   fileInfo.Name,
+		"path":   fileInfo.Path,
+		"size":   s.FormatFileSize(fileInfo.Size),
+		"offset": fileInfo.Offset,
 	})
 
-	// 开始接收前更新进度为0%
-	if progress != nil {
-		progress <- interfaces.Progress{
-			Total:     fileInfo.Size,
-			Current:   0,
-			Speed:     0,
-			Remaining: fileInfo.Size,
-		}
-	}
+	return s.receiveFileData(ctx, source, &fileInfo, destPath, progress)
+}
 
-	// 2. 接收文件内容
-	msg, err = s.ReceiveMessage(conn)
-	if err != nil {
-		return fmt.Errorf("接收文件内容失败: %v", err)
-	}
+// ReceiveFileStream 从数据流接收文件, 文件信息由调用方从传输协议中获得
+// 用于HTTP等不使用帧格式的传输, 续传、MD5校验和替换目标文件的方式与 ReceiveFileFrom 相同
+func (s *MessageSender) ReceiveFileStream(ctx context.Context, r io.Reader, fileInfo *interfaces.FileMessageInfo, destPath string, progress chan<- interfaces.Progress) error {
+	source := &streamFrameSource{reader: r, buf: make([]byte, DefaultChunkSize)}
+	return s.receiveFileData(ctx, source, fileInfo, destPath, progress)
+}
 
-	if msg.Type != "file_data" {
-		return fmt.Errorf("收到意外的消息类型: %s", msg.Type)
+// receiveFileData 接收文件信息之后的文件内容
+func (s *MessageSender) receiveFileData(ctx context.Context, source FrameSource, fileInfo *interfaces.FileMessageInfo, destPath string, progress chan<- interfaces.Progress) error {
+	// 2. 打开.part文件, 续传时先计算已接收部分的MD5
+	if err := os.MkdirAll(filepath.Dir(destPath), 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %v", err)
 	}
 
-	var chunk struct {
-		Data []byte `json:"data"`
-	}
-	if err := json.Unmarshal(msg.Payload, &chunk); err != nil {
-		return fmt.Errorf("解析文件内容失败: %v", err)
+	partFile, hash, err := openPartFile(destPath, fileInfo.Offset)
+	if err != nil {
+		removePartial(destPath)
+		return err
 	}
+	closed := false
+	defer func() {
+		if !closed {
+			partFile.Close()
+		}
+	}()
 
-	// 3. 写入文件
-	// 确保目标目录存在
-	targetDir := filepath.Dir(destDir)
-	if err := os.MkdirAll(targetDir, 0755); err != nil {
-		return fmt.Errorf("创建目录失败: %v", err)
+	if err := savePartialMeta(destPath, &partialMeta{
+		Path: fileInfo.Path,
+		MD5:  fileInfo.MD5,
+		Size: fileInfo.Size,
+	}); err != nil {
+		return fmt.Errorf("保存续传信息失败: %v", err)
 	}
 
 	s.logger.Debug("写入文件", interfaces.Fields{
-		"dest_dir":   destDir,
-		"target_dir": targetDir,
-		"file_name":  fileInfo.Name,
-		"file_path":  fileInfo.Path,
+		"dest_path": destPath,
+		"part_path": partFile.Name(),
+		"file_name": fileInfo.Name,
+		"file_path": fileInfo.Path,
 	})
 
-	if err := os.WriteFile(destDir, chunk.Data, 0644); err != nil {
-		return fmt.Errorf("写入文件失败: %v", err)
-	}
+	// 3. 逐块接收并写入
+	tracker := newProgressTracker(fileInfo.Path, fileInfo.Size, fileInfo.Offset, progress)
+	tracker.report()
+
+	received := fileInfo.Offset
+	writer := io.MultiWriter(partFile, hash)
+	for received < fileInfo.Size {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		frame, err := source.NextFrame()
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return fmt.Errorf("接收文件内容失败: %v", err)
+		}
+
+		// 传输中途收到控制帧, 说明服务端发送失败
+		if frame.Type == FrameControl {
+			msg, err := s.DecodeMessage(frame)
+			if err != nil {
+				return err
+			}
+			if err := checkFailureMessage(msg); err != nil {
+				return err
+			}
+			return fmt.Errorf("收到意外的消息类型: %s", msg.Type)
+		}
 
-	// 接收完成后更新进度为100%
-	if progress != nil {
-		progress <- interfaces.Progress{
-			Total:     fileInfo.Size,
-			Current:   fileInfo.Size,
-			Speed:     float64(fileInfo.Size),
-			Remaining: 0,
+		if received+int64(len(frame.Payload)) > fileInfo.Size {
+			return fmt.Errorf("文件数据超出声明的大小: %d", fileInfo.Size)
+		}
+		if _, err := writer.Write(frame.Payload); err != nil {
+			return fmt.Errorf("写入文件失败: %v", err)
 		}
+		received += int64(len(frame.Payload))
+		tracker.add(int64(len(frame.Payload)))
+	}
+
+	// 4. 校验MD5, 校验失败的数据不能用于续传
+	closed = true
+	if err := partFile.Close(); err != nil {
+		return fmt.Errorf("关闭临时文件失败: %v", err)
+	}
+	if md5sum := hex.EncodeToString(hash.Sum(nil)); md5sum != fileInfo.MD5 {
+		removePartial(destPath)
+		return fmt.Errorf("文件MD5校验失败: 期望 %s, 实际 %s", fileInfo.MD5, md5sum)
 	}
 
+	// 5. 替换目标文件
+	if err := ReplaceFile(destPath+PartFileSuffix, destPath); err != nil {
+		return fmt.Errorf("替换目标文件失败: %v", err)
+	}
+	os.Remove(destPath + PartMetaSuffix)
+
 	s.logger.Debug("文件接收完成", interfaces.Fields{
 		"name":     fileInfo.Name,
 		"path":     fileInfo.Path,
 		"size":     s.FormatFileSize(fileInfo.Size),
-		"received": s.FormatFileSize(int64(len(chunk.Data))),
+		"resumed":  s.FormatFileSize(fileInfo.Offset),
+		"received": s.FormatFileSize(received - fileInfo.Offset),
 	})
 
 	return nil
 }
 
+// FrameSource 帧来源
+// 多路复用的连接上, 单个传输的帧由分发器转交, 而不是直接从连接读取
+type FrameSource interface {
+	NextFrame() (*Frame, error)
+}
+
+// connFrameSource 直接从连接读取帧
+type connFrameSource struct {
+	sender *MessageSender
+	conn   net.Conn
+}
+
+// NextFrame 读取下一帧
+func (c *connFrameSource) NextFrame() (*Frame, error) {
+	return c.sender.ReadFrame(c.conn)
+}
+
+// streamFrameSource 将数据流按块转换为数据帧
+type streamFrameSource struct {
+	reader io.Reader
+	buf    []byte
+}
+
+// NextFrame 读取下一块数据, 数据流在文件接收完整前结束时返回错误
+func (c *streamFrameSource) NextFrame() (*Frame, error) {
+	for {
+		n, err := c.reader.Read(c.buf)
+		if n > 0 {
+			return &Frame{Type: FrameData, Payload: c.buf[:n]}, nil
+		}
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// checkFailureMessage 检查是否为服务端返回的失败响应
+// 旧版服务器的失败响应不带错误代码, 只能返回服务器的错误消息
+func checkFailureMessage(msg *interfaces.Message) error {
+	if err := ParseError(msg); err != nil {
+		return err
+	}
+	if msg.Type != "data" {
+		return nil
+	}
+	var response struct {
+		Success bool   `json:"success"`
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(msg.Payload, &response); err != nil {
+		return fmt.Errorf("解析服务器响应失败: %v", err)
+	}
+	if response.Success {
+		return fmt.Errorf("收到意外的消息类型: %s", msg.Type)
+	}
+	return fmt.Errorf("服务器返回错误: %s", response.Message)
+}
+
+// ReplaceFile 用临时文件替换目标文件
+func ReplaceFile(tempPath, destPath string) error {
+	if err := os.Rename(tempPath, destPath); err != nil {
+		// Windows下目标文件存在时重命名可能失败, 先删除再重试
+		if removeErr := os.Remove(destPath); removeErr != nil && !os.IsNotExist(removeErr) {
+			return err
+		}
+		return os.Rename(tempPath, destPath)
+	}
+	return nil
+}
+
 // FormatPayload 格式化消息内容预览
 func (s *MessageSender) FormatPayload(payload []byte) string {
 	if len(payload) == 0 {
@@ -303,3 +626,62 @@ func (s *MessageSender) FormatFileSize(size int64) string {
 		return fmt.Sprintf("%dB", size)
 	}
 }
+
+// progressTracker 文件传输进度统计
+type progressTracker struct {
+	ch        chan<- interfaces.Progress
+	fileName  string
+	total     int64
+	current   int64
+	startSize int64
+	startTime time.Time
+}
+
+// newProgressTracker 创建进度统计, start为已完成的字节数
+func newProgressTracker(fileName string, total, start int64, ch chan<- interfaces.Progress) *progressTracker {
+	return &progressTracker{
+		ch:        ch,
+		fileName:  fileName,
+		total:     total,
+		current:   start,
+		startSize: start,
+		startTime: time.Now(),
+	}
+}
+
+// add 累加已传输字节数并报告进度
+func (t *progressTracker) add(n int64) {
+	t.current += n
+	t.report()
+}
+
+// report 报告当前进度
+func (t *progressTracker) report() {
+	if t.ch == nil {
+		return
+	}
+
+	var speed float64
+	if elapsed := time.Since(t.startTime).Seconds(); elapsed > 0 {
+		speed = float64(t.current-t.startSize) / elapsed
+	}
+
+	var remaining int64
+	if speed > 0 {
+		remaining = int64(float64(t.total-t.current) / speed)
+	}
+
+	status := "传输中"
+	if t.current >= t.total {
+		status = "传输完成"
+	}
+
+	t.ch <- interfaces.Progress{
+		Total:     t.total,
+		Current:   t.current,
+		Speed:     speed,
+		Remaining: remaining,
+		FileName:  t.fileName,
+		Status:    status,
+	}
+}
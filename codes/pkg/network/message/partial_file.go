@@ -0,0 +1,140 @@
+package message
+
+import (
+	"crypto/md5"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"synctools/codes/internal/interfaces"
+)
+
+const (
+	// PartFileSuffix 未完成下载的数据文件后缀
+	PartFileSuffix = ".part"
+	// PartMetaSuffix 未完成下载的元数据文件后缀
+	PartMetaSuffix = ".part.meta"
+)
+
+// partialMeta 未完成下载的元数据
+// 已接收的偏移量即.part文件的大小, 元数据只记录所属的服务端文件版本
+type partialMeta struct {
+	Path string `json:"path"` // 服务端文件路径
+	MD5  string `json:"md5"`  // 服务端文件MD5
+	Size int64  `json:"size"` // 服务端文件大小
+}
+
+// PrepareResume 根据本地未完成的下载填充续传偏移量
+// 没有可续传的数据时偏移量为0, 元数据损坏时删除未完成的下载
+func PrepareResume(destPath string, req *interfaces.FileTransferRequest) {
+	req.Offset = 0
+	req.MD5 = ""
+
+	meta, err := loadPartialMeta(destPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			removePartial(destPath)
+		}
+		return
+	}
+	if meta.Path != req.FilePath {
+		return
+	}
+
+	info, err := os.Stat(destPath + PartFileSuffix)
+	if err != nil || info.Size() <= 0 || info.Size() > meta.Size {
+		return
+	}
+
+	req.Offset = info.Size()
+	req.MD5 = meta.MD5
+}
+
+// IsPartialFile 检查路径是否为未完成下载产生的临时文件
+func IsPartialFile(path string) bool {
+	if strings.HasSuffix(path, PartMetaSuffix) {
+		return true
+	}
+	if strings.HasSuffix(path, PartFileSuffix) {
+		_, err := os.Stat(path + ".meta")
+		return err == nil
+	}
+	return false
+}
+
+// loadPartialMeta 读取未完成下载的元数据, 没有未完成的下载时返回os.ErrNotExist
+func loadPartialMeta(destPath string) (*partialMeta, error) {
+	data, err := os.ReadFile(destPath + PartMetaSuffix)
+	if err != nil {
+		return nil, err
+	}
+	var meta partialMeta
+	if err := json.Unmarshal(data, &meta); err != nil {
+		return nil, fmt.Errorf("解析续传信息失败: %v", err)
+	}
+	return &meta, nil
+}
+
+// savePartialMeta 保存未完成下载的元数据
+func savePartialMeta(destPath string, meta *partialMeta) error {
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := rejectSymlink(destPath + PartMetaSuffix); err != nil {
+		return err
+	}
+	return os.WriteFile(destPath+PartMetaSuffix, data, 0644)
+}
+
+// removePartial 删除未完成下载的数据和元数据
+func removePartial(destPath string) {
+	os.Remove(destPath + PartFileSuffix)
+	os.Remove(destPath + PartMetaSuffix)
+}
+
+// openPartFile 打开.part文件并定位到续传偏移量
+// 返回的哈希已包含偏移量之前的数据, .part文件是符号链接时拒绝写入
+func openPartFile(destPath string, offset int64) (*os.File, hash.Hash, error) {
+	partPath := destPath + PartFileSuffix
+	h := md5.New()
+	if err := rejectSymlink(partPath); err != nil {
+		return nil, nil, err
+	}
+
+	if offset == 0 {
+		file, err := os.OpenFile(partPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("创建临时文件失败: %v", err)
+		}
+		return file, h, nil
+	}
+
+	file, err := os.OpenFile(partPath, os.O_RDWR, 0644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("打开续传文件失败: %v", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil || info.Size() < offset {
+		file.Close()
+		return nil, nil, fmt.Errorf("续传文件与服务端偏移量不一致: %d", offset)
+	}
+
+	if _, err := io.CopyN(h, file, offset); err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("读取续传文件失败: %v", err)
+	}
+	if err := file.Truncate(offset); err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("截断续传文件失败: %v", err)
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, nil, fmt.Errorf("定位续传文件失败: %v", err)
+	}
+	return file, h, nil
+}
@@ -0,0 +1,85 @@
+package message
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/internal/testutil"
+)
+
+// cancelReader 返回一段数据后取消上下文, 模拟下载中途停止同步
+type cancelReader struct {
+	data   []byte
+	cancel context.CancelFunc
+}
+
+func (r *cancelReader) Read(p []byte) (int, error) {
+	if len(r.data) == 0 {
+		r.cancel()
+		return 0, context.Canceled
+	}
+	n := copy(p, r.data)
+	r.data = r.data[n:]
+	return n, nil
+}
+
+// TestCancelKeepsPartial 取消的下载保留.part文件, 下次下载从已接收的位置续传
+func TestCancelKeepsPartial(t *testing.T) {
+	data := []byte("0123456789abcdef")
+	sum := md5.Sum(data)
+	info := &interfaces.FileMessageInfo{Name: "a.bin", Path: "mods/a.bin", Size: int64(len(data)), MD5: hex.EncodeToString(sum[:])}
+	destPath := filepath.Join(t.TempDir(), "a.bin")
+	sender := NewMessageSender(testutil.NewNopLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	reader := &cancelReader{data: data[:6], cancel: cancel}
+	if err := sender.ReceiveFileStream(ctx, reader, info, destPath, nil); err != context.Canceled {
+		t.Fatalf("期望取消, 实际 %v", err)
+	}
+
+	req := &interfaces.FileTransferRequest{FilePath: info.Path}
+	PrepareResume(destPath, req)
+	if req.Offset != 6 || req.MD5 != info.MD5 {
+		t.Fatalf("续传信息错误: offset %d, md5 %s", req.Offset, req.MD5)
+	}
+
+	resumed := *info
+	resumed.Offset = req.Offset
+	reader = &cancelReader{data: data[6:], cancel: func() {}}
+	if err := sender.ReceiveFileStream(context.Background(), reader, &resumed, destPath, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(destPath); err != nil || string(got) != string(data) {
+		t.Fatalf("续传后的文件错误: %q, %v", got, err)
+	}
+	if _, err := os.Stat(destPath + PartMetaSuffix); !os.IsNotExist(err) {
+		t.Errorf("完成后应删除续传信息: %v", err)
+	}
+}
+
+// TestCorruptPartialMeta 续传信息损坏时删除未完成的下载, 从头下载
+func TestCorruptPartialMeta(t *testing.T) {
+	destPath := filepath.Join(t.TempDir(), "a.bin")
+	if err := os.WriteFile(destPath+PartFileSuffix, []byte("012345"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(destPath+PartMetaSuffix, []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	req := &interfaces.FileTransferRequest{FilePath: "a.bin"}
+	PrepareResume(destPath, req)
+	if req.Offset != 0 {
+		t.Errorf("续传信息损坏时不应续传: offset %d", req.Offset)
+	}
+	for _, p := range []string{destPath + PartFileSuffix, destPath + PartMetaSuffix} {
+		if _, err := os.Stat(p); !os.IsNotExist(err) {
+			t.Errorf("%s 应被删除: %v", filepath.Base(p), err)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
+const (
+	// ProtocolVersion 当前协议版本
+	ProtocolVersion = 1
+	// MinProtocolVersion 兼容的最低协议版本
+	MinProtocolVersion = 1
+)
+
+// 功能标识, 在握手时交换并取双方共同支持的部分
+const (
+	CapChunkedTransfer = "chunked_transfer" // 分块流式传输
+	CapResume          = "resume"           // 断点续传
+	CapMultiplex       = "multiplex"        // 单连接并发请求
+	CapHashMD5         = "hash_md5"         // MD5校验
+	CapCompressDeflate = "compress_deflate" // DEFLATE压缩
+	CapManifestNotify  = "manifest_notify"  // 文件清单变化通知
+	CapCancel          = "cancel"           // 取消进行中的请求
+)
+
+// 握手拒绝原因
+const (
+	RejectProtocolVersion = "protocol_version" // 协议版本不兼容
+	RejectCapabilities    = "capabilities"     // 缺少必需的功能
+	RejectHandshake       = "handshake"        // 未完成握手
+)
+
+// SupportedCapabilities 本端支持的功能, 按优先级排列
+func SupportedCapabilities() []string {
+	return []string{
+		CapChunkedTransfer,
+		CapResume,
+		CapMultiplex,
+		CapHashMD5,
+		CapCompressDeflate,
+		CapManifestNotify,
+		CapCancel,
+	}
+}
+
+// RequiredCapabilities 连接必须协商成功的功能
+func RequiredCapabilities() []string {
+	return []string{
+		CapChunkedTransfer,
+		CapHashMD5,
+	}
+}
+
+// hashCapabilities 支持的校验算法, 越靠前越优先
+var hashCapabilities = []string{
+	CapHashMD5,
+}
+
+// NegotiateCapabilities 取本端与对端共同支持的功能, 保持本端的优先级顺序
+func NegotiateCapabilities(local, remote []string) []string {
+	remoteSet := make(map[string]struct{}, len(remote))
+	for _, c := range remote {
+		remoteSet[c] = struct{}{}
+	}
+
+	var shared []string
+	for _, c := range local {
+		if _, ok := remoteSet[c]; ok {
+			shared = append(shared, c)
+		}
+	}
+	return shared
+}
+
+// MissingCapabilities 返回协商结果中缺少的必需功能
+func MissingCapabilities(negotiated []string) []string {
+	var missing []string
+	for _, c := range RequiredCapabilities() {
+		if !HasCapability(negotiated, c) {
+			missing = append(missing, c)
+		}
+	}
+	return missing
+}
+
+// HasCapability 检查功能列表中是否包含指定功能
+func HasCapability(capabilities []string, capability string) bool {
+	for _, c := range capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// SelectHash 选择双方共同支持的最优校验算法
+func SelectHash(negotiated []string) string {
+	for _, c := range hashCapabilities {
+		if HasCapability(negotiated, c) {
+			return c
+		}
+	}
+	return ""
+}
+
+// IsProtocolSupported 检查对端协议版本是否兼容
+func IsProtocolSupported(version int) bool {
+	return version >= MinProtocolVersion && version <= ProtocolVersion
+}
+
+// IsLegacyConn 检查对端是否使用旧版换行分隔的JSON协议
+// 旧版消息以'{'开头, 新版帧以魔数开头
+func (s *MessageSender) IsLegacyConn(conn net.Conn) (bool, error) {
+	st := s.state(conn)
+	st.readMu.Lock()
+	defer st.readMu.Unlock()
+
+	if s.readTimeout > 0 {
+		if err := conn.SetReadDeadline(time.Now().Add(s.readTimeout)); err != nil {
+			return false, fmt.Errorf("设置读取超时失败: %v", err)
+		}
+		defer conn.SetReadDeadline(time.Time{})
+	}
+
+	first, err := st.reader.Peek(1)
+	if err != nil {
+		return false, err
+	}
+	return first[0] == '{', nil
+}
+
+// SendLegacyMessage 以旧版协议格式发送消息, 仅用于告知旧版客户端升级
+func (s *MessageSender) SendLegacyMessage(conn net.Conn, msgType string, uuid string, payload interface{}) error {
+	payloadJSON, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("序列化payload失败: %v", err)
+	}
+	data, err := json.Marshal(struct {
+		Type    string          `json:"type"`
+		UUID    string          `json:"uuid"`
+		Payload json.RawMessage `json:"payload"`
+	}{
+		Type:    msgType,
+		UUID:    uuid,
+		Payload: payloadJSON,
+	})
+	if err != nil {
+		return fmt.Errorf("序列化消息失败: %v", err)
+	}
+
+	st := s.state(conn)
+	st.writeMu.Lock()
+	defer st.writeMu.Unlock()
+	_, err = conn.Write(append(data, '\n'))
+	return err
+}
@@ -0,0 +1,159 @@
+package message
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// rateWaitSlice 限速等待的分段时长
+	rateWaitSlice = 200 * time.Millisecond
+	// minRateStep 限速时单次取得额度的最少字节数
+	minRateStep = 256
+)
+
+// RateLimiter 令牌桶限速器, 速率为0时不限速
+// 速率可在运行中修改, 多个协程共享时按请求顺序分配带宽
+type RateLimiter struct {
+	mu     sync.Mutex
+	rate   float64 // 每秒字节数
+	tokens float64 // 可用字节数, 为负表示已预支
+	last   time.Time
+}
+
+// NewRateLimiter 创建限速器, bytesPerSec为0时不限速
+func NewRateLimiter(bytesPerSec int64) *RateLimiter {
+	l := &RateLimiter{}
+	l.SetRate(bytesPerSec)
+	return l
+}
+
+// SetRate 修改速率, 立即生效
+func (l *RateLimiter) SetRate(bytesPerSec int64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if bytesPerSec < 0 {
+		bytesPerSec = 0
+	}
+	l.rate = float64(bytesPerSec)
+	l.last = time.Now()
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+}
+
+// Rate 获取当前速率
+func (l *RateLimiter) Rate() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int64(l.rate)
+}
+
+// Step 获取单次应取得的最多字节数, 不限速时返回0
+// 为一个等待分段内可以传输的字节数, 低速时数据按小块持续传输, 接收方不会长时间收不到数据
+func (l *RateLimiter) Step() int {
+	rate := l.Rate()
+	if rate <= 0 {
+		return 0
+	}
+	step := int(float64(rate) * rateWaitSlice.Seconds())
+	if step < minRateStep {
+		step = minRateStep
+	}
+	return step
+}
+
+// Wait 等待直到允许传输n个字节, 上下文取消时返回取消原因
+// 最多积累一秒的突发流量, 超出部分预支并等待补足
+// 等待按短时间分段进行, 期间速率被修改为不限速时立即返回
+func (l *RateLimiter) Wait(ctx context.Context, n int) error {
+	l.mu.Lock()
+	if l.rate <= 0 {
+		l.mu.Unlock()
+		return nil
+	}
+
+	now := time.Now()
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.rate {
+		l.tokens = l.rate
+	}
+	l.last = now
+	l.tokens -= float64(n)
+
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.mu.Unlock()
+
+	for wait > 0 {
+		step := wait
+		if step > rateWaitSlice {
+			step = rateWaitSlice
+		}
+		timer := time.NewTimer(step)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		wait -= step
+		if l.Rate() == 0 {
+			return nil
+		}
+	}
+	return nil
+}
+
+// LimitWrite 设置连接发送数据帧的限速器, 按网络字节数计算
+func (s *MessageSender) LimitWrite(conn net.Conn, limiters ...*RateLimiter) {
+	st := s.state(conn)
+	st.limitMu.Lock()
+	defer st.limitMu.Unlock()
+	st.writeLimiters = limiters
+}
+
+// chunkLimit 按连接的发送限速调整数据帧的负载大小, 不超过各限速器的单次额度
+func (st *connState) chunkLimit(n int) int {
+	st.limitMu.Lock()
+	limiters := st.writeLimiters
+	st.limitMu.Unlock()
+
+	for _, l := range limiters {
+		if step := l.Step() - FrameHeaderSize; step > 0 && step < n {
+			n = step
+		}
+	}
+	return n
+}
+
+// throttle 依次等待连接的发送限速器, 上下文取消或连接释放时停止等待
+func (st *connState) throttle(ctx context.Context, n int) error {
+	st.limitMu.Lock()
+	limiters := st.writeLimiters
+	st.limitMu.Unlock()
+	if len(limiters) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stop := context.AfterFunc(st.ctx, cancel)
+	defer stop()
+
+	for _, l := range limiters {
+		if err := l.Wait(ctx, n); err != nil {
+			if st.ctx.Err() != nil {
+				return fmt.Errorf("连接已关闭")
+			}
+			return err
+		}
+	}
+	return nil
+}
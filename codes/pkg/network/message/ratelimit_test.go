@@ -0,0 +1,55 @@
+package message
+
+import (
+	"context"
+	"crypto/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/internal/testutil"
+)
+
+// TestThrottledChunkSize 限速时数据帧不超过限速器的单次额度, 接收方持续收到数据
+func TestThrottledChunkSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "a.bin")
+	data := make([]byte, 4<<10)
+	rand.Read(data)
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	limiter := NewRateLimiter(8 << 10)
+	sender := NewMessageSender(testutil.NewNopLogger())
+	sender.LimitWrite(server, limiter)
+	done := make(chan error, 1)
+	go func() {
+		req := &interfaces.FileTransferRequest{FilePath: "a.bin", ChunkSize: MaxChunkSize}
+		done <- sender.SendFileChunked(context.Background(), server, 1, "", path, req, nil)
+	}()
+
+	receiver := NewMessageSender(testutil.NewNopLogger())
+	received := 0
+	for received < len(data) {
+		frame, err := receiver.ReadFrame(client)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if frame.Type != FrameData {
+			continue
+		}
+		if size := FrameHeaderSize + len(frame.Payload); size > limiter.Step() {
+			t.Fatalf("数据帧 %d 字节, 超过限速器的单次额度 %d 字节", size, limiter.Step())
+		}
+		received += len(frame.Payload)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
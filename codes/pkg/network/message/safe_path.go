@@ -0,0 +1,81 @@
+package message
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// SafeJoin 将不可信的相对路径拼接到目录下, 用于服务器或压缩包提供的路径
+// 拒绝绝对路径、带盘符的路径、包含..的路径和通过符号链接跳出目录的路径, 路径可以使用/或\分隔
+func SafeJoin(root, name string) (string, error) {
+	slashed := strings.ReplaceAll(name, "\\", "/")
+	if slashed == "" || strings.ContainsAny(slashed, ":\x00") || path.IsAbs(slashed) || filepath.IsAbs(name) {
+		return "", fmt.Errorf("无效的路径: %s", name)
+	}
+	for _, part := range strings.Split(slashed, "/") {
+		if part == ".." {
+			return "", fmt.Errorf("路径包含上级目录: %s", name)
+		}
+	}
+
+	target := filepath.Join(root, filepath.FromSlash(slashed))
+	if err := WithinDir(root, target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// WithinDir 检查路径位于目录中, 解析符号链接后也不能跳出该目录
+// 路径不存在时检查已存在的最深一级上级目录, 目录本身可以是符号链接
+func WithinDir(root, target string) error {
+	if !pathInside(root, target) {
+		return fmt.Errorf("路径不在目录 %s 中: %s", root, target)
+	}
+
+	realRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		// 目录不存在时其中也没有符号链接
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for existing := target; ; {
+		real, err := filepath.EvalSymlinks(existing)
+		if err == nil {
+			if !pathInside(realRoot, real) {
+				return fmt.Errorf("符号链接指向目录之外: %s", existing)
+			}
+			return nil
+		}
+		if !os.IsNotExist(err) {
+			return err
+		}
+		parent := filepath.Dir(existing)
+		if parent == existing {
+			return nil
+		}
+		existing = parent
+	}
+}
+
+// pathInside 检查路径是否为指定目录或位于其中, 只比较路径本身
+func pathInside(dir, target string) bool {
+	rel, err := filepath.Rel(dir, target)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
+// rejectSymlink 路径已存在且是符号链接时返回错误, 避免通过链接写入其他位置
+func rejectSymlink(path string) error {
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		return fmt.Errorf("拒绝写入符号链接: %s", path)
+	}
+	return nil
+}
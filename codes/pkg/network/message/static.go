@@ -0,0 +1,33 @@
+package message
+
+import (
+	"path"
+	"regexp"
+)
+
+const (
+	// StaticFormatVersion 静态导出的清单格式版本
+	StaticFormatVersion = 1
+	// StaticManifestFile 静态导出目录中的清单文件名
+	StaticManifestFile = "manifest.json"
+	// StaticBlobDir 静态导出目录中按内容命名的文件目录
+	StaticBlobDir = "blobs"
+)
+
+// staticBlobName 内容文件名, 小写十六进制的MD5
+var staticBlobName = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+// ValidStaticBlobName 检查清单中的MD5能否作为内容文件名, 不合格的MD5不能用于拼接内容文件路径
+func ValidStaticBlobName(md5sum string) bool {
+	return staticBlobName.MatchString(md5sum)
+}
+
+// StaticBlobPath 获取内容文件在静态导出目录中的相对路径
+// 按MD5前两位分目录, 避免单个目录下文件过多
+func StaticBlobPath(md5sum string) string {
+	prefix := md5sum
+	if len(prefix) > 2 {
+		prefix = prefix[:2]
+	}
+	return path.Join(StaticBlobDir, prefix, md5sum)
+}
@@ -0,0 +1,24 @@
+package message
+
+import "testing"
+
+// TestValidStaticBlobName 只有小写十六进制的MD5可以作为内容文件名
+func TestValidStaticBlobName(t *testing.T) {
+	tests := []struct {
+		name string
+		ok   bool
+	}{
+		{"0cc175b9c0f1b6a831c399e269772661", true},
+		{"0CC175B9C0F1B6A831C399E269772661", false},
+		{"0cc175b9c0f1b6a831c399e26977266", false},
+		{"0cc175b9c0f1b6a831c399e2697726611", false},
+		{"../../../../etc/passwd", false},
+		{"..\\..\\0cc175b9c0f1b6a831c399e269", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := ValidStaticBlobName(tt.name); got != tt.ok {
+			t.Errorf("ValidStaticBlobName(%q) = %v, 期望 %v", tt.name, got, tt.ok)
+		}
+	}
+}
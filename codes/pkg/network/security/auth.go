@@ -0,0 +1,59 @@
+package security
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
+
+const (
+	// nonceSize 认证随机数长度
+	nonceSize = 32
+	// authContext 参与HMAC计算的固定前缀, 避免与其他用途的签名混淆
+	authContext = "synctools-auth-v1"
+)
+
+// NewNonce 生成认证随机数
+func NewNonce() (string, error) {
+	buf := make([]byte, nonceSize)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("生成随机数失败: %v", err)
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// ComputeAuthMAC 计算认证应答, 密钥本身不在网络上传输
+func ComputeAuthMAC(secret, nonce, uuid string) string {
+	return computeMAC(secret, authContext, nonce, uuid)
+}
+
+// VerifyAuthMAC 校验认证应答, 使用常量时间比较
+func VerifyAuthMAC(secret, nonce, uuid, answer string) bool {
+	return verifyMAC(ComputeAuthMAC(secret, nonce, uuid), answer)
+}
+
+// computeMAC 以固定前缀和各字段计算HMAC, 字段之间以0分隔
+func computeMAC(secret, context string, fields ...string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(context))
+	for _, field := range fields {
+		mac.Write([]byte{0})
+		mac.Write([]byte(field))
+	}
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verifyMAC 使用常量时间比较两个十六进制编码的HMAC
+func verifyMAC(expectedHex, answer string) bool {
+	expected, err := hex.DecodeString(expectedHex)
+	if err != nil {
+		return false
+	}
+	actual, err := hex.DecodeString(answer)
+	if err != nil {
+		return false
+	}
+	return hmac.Equal(expected, actual)
+}
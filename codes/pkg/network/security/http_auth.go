@@ -0,0 +1,130 @@
+package security
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// RequestAuthScheme HTTP请求签名使用的Authorization方案名
+	RequestAuthScheme = "SyncTools"
+	// requestAuthContext 参与HTTP请求签名计算的固定前缀
+	requestAuthContext = "synctools-http-v2"
+	// MaxRequestClockSkew 请求时间戳与服务器时间允许的最大偏差
+	MaxRequestClockSkew = 5 * time.Minute
+)
+
+// RequestAuth HTTP请求携带的签名
+// HTTP传输没有握手, 每个请求对请求路径、时间戳和随机数签名, 密钥本身不在网络上传输
+type RequestAuth struct {
+	Token     string // 访问令牌名称, 为空时使用认证密钥
+	UUID      string // 客户端UUID
+	Timestamp int64  // 签名时间(Unix秒)
+	Nonce     string // 每个请求不同的随机数, 用于拒绝重放的请求
+	MAC       string // 签名
+}
+
+// SignRequest 生成HTTP请求的Authorization头
+func SignRequest(secret, token, uuid, path string, now time.Time) (string, error) {
+	nonce, err := NewNonce()
+	if err != nil {
+		return "", err
+	}
+	ts := strconv.FormatInt(now.Unix(), 10)
+	mac := computeMAC(secret, requestAuthContext, ts, nonce, path, uuid)
+	return fmt.Sprintf("%s token=%s,uuid=%s,ts=%s,nonce=%s,mac=%s",
+		RequestAuthScheme, url.QueryEscape(token), url.QueryEscape(uuid), ts, nonce, mac), nil
+}
+
+// ParseRequestAuth 解析HTTP请求的Authorization头
+func ParseRequestAuth(header string) (*RequestAuth, error) {
+	params, ok := strings.CutPrefix(header, RequestAuthScheme+" ")
+	if !ok {
+		return nil, fmt.Errorf("不支持的认证方式")
+	}
+
+	auth := &RequestAuth{}
+	for _, part := range strings.Split(params, ",") {
+		key, value, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			return nil, fmt.Errorf("认证参数格式错误: %s", part)
+		}
+		value, err := url.QueryUnescape(value)
+		if err != nil {
+			return nil, fmt.Errorf("认证参数格式错误: %v", err)
+		}
+		switch key {
+		case "token":
+			auth.Token = value
+		case "uuid":
+			auth.UUID = value
+		case "ts":
+			ts, err := strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("认证时间戳格式错误: %v", err)
+			}
+			auth.Timestamp = ts
+		case "nonce":
+			auth.Nonce = value
+		case "mac":
+			auth.MAC = value
+		}
+	}
+	if auth.MAC == "" || auth.Nonce == "" || auth.Timestamp == 0 {
+		return nil, fmt.Errorf("缺少认证签名")
+	}
+	return auth, nil
+}
+
+// Verify 校验请求签名和时间戳, 超出允许偏差的签名视为过期
+func (a *RequestAuth) Verify(secret, path string, now time.Time) error {
+	skew := now.Sub(time.Unix(a.Timestamp, 0))
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > MaxRequestClockSkew {
+		return fmt.Errorf("请求签名已过期, 请检查系统时间")
+	}
+
+	expected := computeMAC(secret, requestAuthContext, strconv.FormatInt(a.Timestamp, 10), a.Nonce, path, a.UUID)
+	if !verifyMAC(expected, a.MAC) {
+		return fmt.Errorf("认证密钥不匹配")
+	}
+	return nil
+}
+
+// ReplayGuard 记录有效期内已使用的请求签名, 拒绝重放的请求
+// 签名超出时间偏差后由Verify拒绝, 因此只需记录到签名过期为止; 零值可直接使用
+type ReplayGuard struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time // 签名到过期时间
+	lastPrune time.Time
+}
+
+// Check 记录已通过校验的请求签名, 签名在有效期内重复出现时返回错误
+func (g *ReplayGuard) Check(auth *RequestAuth, now time.Time) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.seen == nil {
+		g.seen = make(map[string]time.Time)
+	}
+	if now.Sub(g.lastPrune) > time.Minute {
+		for mac, expires := range g.seen {
+			if now.After(expires) {
+				delete(g.seen, mac)
+			}
+		}
+		g.lastPrune = now
+	}
+
+	if expires, ok := g.seen[auth.MAC]; ok && !now.After(expires) {
+		return fmt.Errorf("请求签名已使用")
+	}
+	g.seen[auth.MAC] = time.Unix(auth.Timestamp, 0).Add(MaxRequestClockSkew)
+	return nil
+}
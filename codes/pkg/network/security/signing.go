@@ -0,0 +1,98 @@
+package security
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// DefaultSigningKeyFile 自动生成的清单签名私钥文件名
+const DefaultSigningKeyFile = "manifest_signing.key"
+
+// LoadOrCreateSigningKey 加载清单签名私钥, 文件不存在时生成新的Ed25519私钥
+// 客户端固定签名公钥, 更换私钥后已同步过的客户端需要清除记录的公钥
+func LoadOrCreateSigningKey(keyFile string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(keyFile)
+	if os.IsNotExist(err) {
+		return generateSigningKey(keyFile)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取签名私钥失败: %v", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("签名私钥格式错误: %s", keyFile)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("解析签名私钥失败: %v", err)
+	}
+	key, ok := parsed.(ed25519.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("签名私钥不是Ed25519私钥: %s", keyFile)
+	}
+	return key, nil
+}
+
+// generateSigningKey 生成并保存清单签名私钥
+func generateSigningKey(keyFile string) (ed25519.PrivateKey, error) {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("生成签名私钥失败: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("序列化签名私钥失败: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return nil, fmt.Errorf("创建私钥目录失败: %v", err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600); err != nil {
+		return nil, fmt.Errorf("保存签名私钥失败: %v", err)
+	}
+	return key, nil
+}
+
+// SignManifest 对清单内容签名, 返回十六进制编码的公钥和签名
+func SignManifest(key ed25519.PrivateKey, payload []byte) (publicKey, signature string) {
+	publicKey = hex.EncodeToString(key.Public().(ed25519.PublicKey))
+	signature = hex.EncodeToString(ed25519.Sign(key, payload))
+	return publicKey, signature
+}
+
+// VerifyManifest 校验清单签名
+// pinned为客户端固定的公钥, 为空时只校验签名与清单附带的公钥一致, 由调用方在校验后记录公钥
+func VerifyManifest(pinned, publicKey, signature string, payload []byte) error {
+	pinned = NormalizeFingerprint(pinned)
+	publicKey = NormalizeFingerprint(publicKey)
+	if pinned != "" && pinned != publicKey {
+		return &SigningKeyMismatchError{Expected: pinned, Actual: publicKey}
+	}
+
+	key, err := hex.DecodeString(publicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("清单签名公钥格式错误")
+	}
+	sig, err := hex.DecodeString(signature)
+	if err != nil || !ed25519.Verify(ed25519.PublicKey(key), payload, sig) {
+		return fmt.Errorf("清单签名校验失败, 清单可能已被篡改")
+	}
+	return nil
+}
+
+// SigningKeyMismatchError 清单签名公钥与固定的公钥不一致
+type SigningKeyMismatchError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *SigningKeyMismatchError) Error() string {
+	return fmt.Sprintf("清单签名公钥不匹配, 期望 %s, 实际 %s", e.Expected, e.Actual)
+}
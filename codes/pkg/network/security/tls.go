@@ -0,0 +1,168 @@
+package security
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultCertFile 自动生成的证书文件名
+	DefaultCertFile = "server.crt"
+	// DefaultKeyFile 自动生成的私钥文件名
+	DefaultKeyFile = "server.key"
+
+	// 自签名证书有效期
+	selfSignedValidity = 10 * 365 * 24 * time.Hour
+)
+
+// LoadOrCreateCertificate 加载服务器证书, 文件不存在时生成自签名证书
+// 返回证书和证书指纹
+func LoadOrCreateCertificate(certFile, keyFile string) (tls.Certificate, string, error) {
+	_, certErr := os.Stat(certFile)
+	_, keyErr := os.Stat(keyFile)
+	if os.IsNotExist(certErr) && os.IsNotExist(keyErr) {
+		if err := generateSelfSigned(certFile, keyFile); err != nil {
+			return tls.Certificate{}, "", err
+		}
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return tls.Certificate{}, "", fmt.Errorf("加载证书失败: %v", err)
+	}
+	if len(cert.Certificate) == 0 {
+		return tls.Certificate{}, "", fmt.Errorf("证书文件为空: %s", certFile)
+	}
+	return cert, Fingerprint(cert.Certificate[0]), nil
+}
+
+// generateSelfSigned 生成自签名证书和私钥
+func generateSelfSigned(certFile, keyFile string) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return fmt.Errorf("生成私钥失败: %v", err)
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return fmt.Errorf("生成证书序列号失败: %v", err)
+	}
+
+	hostname, _ := os.Hostname()
+	if hostname == "" {
+		hostname = "synctools"
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hostname, Organization: []string{"SyncTools"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{hostname},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return fmt.Errorf("生成证书失败: %v", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return fmt.Errorf("序列化私钥失败: %v", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(certFile), 0755); err != nil {
+		return fmt.Errorf("创建证书目录失败: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(keyFile), 0700); err != nil {
+		return fmt.Errorf("创建私钥目录失败: %v", err)
+	}
+
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		return fmt.Errorf("保存私钥失败: %v", err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0644); err != nil {
+		os.Remove(keyFile)
+		return fmt.Errorf("保存证书失败: %v", err)
+	}
+	return nil
+}
+
+// ServerTLSConfig 创建服务端TLS配置
+func ServerTLSConfig(cert tls.Certificate) *tls.Config {
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+}
+
+// ClientTLSConfig 创建客户端TLS配置
+// 服务器使用自签名证书, 不校验证书链, 改为校验证书指纹;
+// pinned为空时接受任意证书, 由调用方在连接后记录指纹
+func ClientTLSConfig(pinned string) *tls.Config {
+	pinned = NormalizeFingerprint(pinned)
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true,
+		VerifyPeerCertificate: func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return fmt.Errorf("服务器未提供证书")
+			}
+			if pinned == "" {
+				return nil
+			}
+			if actual := Fingerprint(rawCerts[0]); actual != pinned {
+				return &FingerprintMismatchError{Expected: pinned, Actual: actual}
+			}
+			return nil
+		},
+	}
+}
+
+// PeerFingerprint 获取TLS连接对端证书的指纹
+func PeerFingerprint(conn *tls.Conn) string {
+	certs := conn.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return ""
+	}
+	return Fingerprint(certs[0].Raw)
+}
+
+// Fingerprint 计算证书的SHA256指纹
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// NormalizeFingerprint 统一指纹格式, 允许配置中使用冒号分隔和大写
+func NormalizeFingerprint(fingerprint string) string {
+	fingerprint = strings.ReplaceAll(fingerprint, ":", "")
+	fingerprint = strings.ReplaceAll(fingerprint, " ", "")
+	return strings.ToLower(strings.TrimSpace(fingerprint))
+}
+
+// FingerprintMismatchError 服务器证书与固定的指纹不一致
+type FingerprintMismatchError struct {
+	Expected string
+	Actual   string
+}
+
+func (e *FingerprintMismatchError) Error() string {
+	return fmt.Sprintf("服务器证书指纹不匹配, 期望 %s, 实际 %s", e.Expected, e.Actual)
+}
@@ -0,0 +1,178 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/errors"
+	"synctools/codes/pkg/network/message"
+)
+
+// SetAccessTokens 更新访问令牌, 运行中即时生效
+// 令牌被删除或吊销时, 使用该令牌的连接立即断开
+func (s *Server) SetAccessTokens(tokens []interfaces.AccessToken) {
+	s.tokensMu.Lock()
+	s.tokens = make(map[string]interfaces.AccessToken, len(tokens))
+	for _, token := range tokens {
+		if token.Name == "" {
+			continue
+		}
+		s.tokens[token.Name] = token
+	}
+	s.tokensMu.Unlock()
+
+	s.clientsMux.RLock()
+	defer s.clientsMux.RUnlock()
+	for _, client := range s.clients {
+		if client.token == "" {
+			continue
+		}
+		if _, ok := s.lookupToken(client.token); !ok {
+			s.logger.Warn("访问令牌已失效, 断开客户端", interfaces.Fields{
+				"client": client.ID,
+				"addr":   client.conn.RemoteAddr(),
+				"token":  client.token,
+			})
+			client.conn.Close()
+		}
+	}
+}
+
+// hasTokens 检查是否定义了访问令牌
+func (s *Server) hasTokens() bool {
+	s.tokensMu.RLock()
+	defer s.tokensMu.RUnlock()
+	return len(s.tokens) > 0
+}
+
+// lookupToken 查找有效的访问令牌, 已吊销的令牌视为不存在
+func (s *Server) lookupToken(name string) (interfaces.AccessToken, bool) {
+	s.tokensMu.RLock()
+	defer s.tokensMu.RUnlock()
+	token, ok := s.tokens[name]
+	if !ok || token.Revoked {
+		return interfaces.AccessToken{}, false
+	}
+	return token, true
+}
+
+// clientToken 获取客户端当前的访问权限
+// 使用认证密钥或服务器未启用认证的客户端返回nil, 表示拥有全部权限
+func (s *Server) clientToken(client *Client) (*interfaces.AccessToken, error) {
+	if client.token == "" {
+		return nil, nil
+	}
+	token, ok := s.lookupToken(client.token)
+	if !ok {
+		return nil, errors.NewError(errors.CodeForbidden, fmt.Sprintf("访问令牌已失效: %s", client.token), nil)
+	}
+	return &token, nil
+}
+
+// canAccessPath 检查令牌是否允许访问指定路径
+func canAccessPath(token *interfaces.AccessToken, requestPath string) bool {
+	if token == nil || len(token.Folders) == 0 {
+		return true
+	}
+
+	for _, folder := range token.Folders {
+		if pathWithin(requestPath, folder) {
+			return true
+		}
+	}
+	return false
+}
+
+// pathWithin 检查路径是否为指定文件夹或位于其中
+func pathWithin(requestPath, folder string) bool {
+	p := path.Clean(filepath.ToSlash(requestPath))
+	f := path.Clean(filepath.ToSlash(folder))
+	return p == f || strings.HasPrefix(p, f+"/")
+}
+
+// authorize 检查客户端是否有权执行消息对应的操作
+// 返回的错误说明拒绝原因, closeConn为true表示令牌已失效需要断开连接
+// 使用访问令牌的客户端默认拒绝, 只允许下面列出的请求, 请求内容无法解析时同样拒绝
+func (s *Server) authorize(client *Client, msg *interfaces.Message) (closeConn bool, err error) {
+	if isHandshakeMessage(msg.Type) {
+		return false, nil
+	}
+
+	token, err := s.clientToken(client)
+	if err != nil {
+		return true, err
+	}
+	if token == nil {
+		return false, nil
+	}
+
+	var requestPath string
+	var mutating bool
+	switch msg.Type {
+	case message.MsgCancelRequest, message.MsgManifestRequest:
+		// 取消只作用于客户端自己的请求, 清单按令牌过滤
+		return false, nil
+
+	case "file_request":
+		var req interfaces.FileTransferRequest
+		if err := json.Unmarshal(msg.Payload, &req); err != nil {
+			return false, errors.NewError(errors.CodeInvalid, "解析请求失败", err)
+		}
+		requestPath = req.FilePath
+
+	case "sync_request", "data", "list_request", "delete_request":
+		var req interfaces.SyncRequest
+		if err := json.Unmarshal(msg.Payload, &req); err != nil {
+			return false, errors.NewError(errors.CodeInvalid, "解析请求失败", err)
+		}
+		requestPath = req.Path
+		// 同步请求由服务端同步服务处理, 会在服务器上复制和写入文件, 与删除一样需要修改权限
+		mutating = msg.Type != "list_request"
+
+	default:
+		return false, errors.NewError(errors.CodeForbidden, fmt.Sprintf("令牌 %s 无权执行: %s", token.Name, msg.Type), nil)
+	}
+
+	if mutating && !token.CanWrite {
+		return false, errors.NewError(errors.CodeForbidden, fmt.Sprintf("令牌 %s 无权执行修改操作", token.Name), nil)
+	}
+	if !canAccessPath(token, requestPath) {
+		return false, errors.NewError(errors.CodeForbidden, fmt.Sprintf("令牌 %s 无权访问: %s", token.Name, requestPath), nil)
+	}
+	return false, nil
+}
+
+// denyRequest 拒绝无权限的请求
+func (s *Server) denyRequest(client *Client, msg *interfaces.Message, err error) {
+	s.logger.Warn("拒绝无权限的请求", interfaces.Fields{
+		"client": client.ID,
+		"addr":   client.conn.RemoteAddr(),
+		"type":   msg.Type,
+		"error":  err,
+	})
+
+	responseType := "data"
+	if msg.Type == "sync_request" {
+		responseType = "sync_response"
+	}
+	client.replyError(msg, responseType, err)
+}
+
+// filterFolders 过滤出令牌可见的同步文件夹
+func filterFolders(token *interfaces.AccessToken, folders []interfaces.SyncFolder) []interfaces.SyncFolder {
+	if token == nil || len(token.Folders) == 0 {
+		return folders
+	}
+
+	visible := make([]interfaces.SyncFolder, 0, len(folders))
+	for _, folder := range folders {
+		if canAccessPath(token, folder.Path) {
+			visible = append(visible, folder)
+		}
+	}
+	return visible
+}
@@ -0,0 +1,55 @@
+package network
+
+import (
+	"testing"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/internal/testutil"
+	"synctools/codes/pkg/errors"
+	"synctools/codes/pkg/network/message"
+)
+
+// TestAuthorizeToken 使用访问令牌的客户端只能访问令牌允许的文件夹, 只读令牌不能发起修改服务器文件的请求, 无法解析和未知的请求一律拒绝
+func TestAuthorizeToken(t *testing.T) {
+	s := NewServer(&interfaces.Config{}, testSyncService{}, testutil.NewNopLogger())
+	s.SetAccessTokens([]interfaces.AccessToken{
+		{Name: "reader", Secret: "secret", Folders: []string{"mods"}},
+		{Name: "writer", Secret: "secret", Folders: []string{"mods"}, CanWrite: true},
+	})
+
+	tests := []struct {
+		token   string
+		msgType string
+		payload string
+		want    *errors.Error // 为nil时允许
+	}{
+		{"reader", "list_request", `{"path": "mods"}`, nil},
+		{"reader", "file_request", `{"file_path": "mods/a.jar"}`, nil},
+		{"reader", message.MsgManifestRequest, `{}`, nil},
+		{"reader", message.MsgCancelRequest, `{"id": 1}`, nil},
+		{"reader", "list_request", `{"path": "config"}`, errors.ErrForbidden},
+		{"reader", "delete_request", `{"path": "mods/a.jar"}`, errors.ErrForbidden},
+		{"reader", "list_request", `"mods"`, errors.ErrInvalid},
+		{"reader", "file_request", `[1]`, errors.ErrInvalid},
+		{"reader", "unknown_request", `{"path": "mods"}`, errors.ErrForbidden},
+		{"reader", "sync_request", `{"path": "mods", "direction": "pull"}`, errors.ErrForbidden},
+		{"reader", "data", `{"path": "mods"}`, errors.ErrForbidden},
+		{"writer", "sync_request", `{"path": "mods", "direction": "pull"}`, nil},
+		{"writer", "delete_request", `{"path": "mods/a.jar"}`, nil},
+		{"writer", "sync_request", `{"path": "config"}`, errors.ErrForbidden},
+	}
+	for _, tt := range tests {
+		client := &Client{ID: "test", token: tt.token}
+		msg := &interfaces.Message{Type: tt.msgType, Payload: []byte(tt.payload)}
+		closeConn, err := s.authorize(client, msg)
+		if closeConn {
+			t.Errorf("%s %s: 令牌有效时不应断开连接", tt.msgType, tt.payload)
+		}
+		if tt.want == nil && err != nil {
+			t.Errorf("%s %s: 期望允许, 实际 %v", tt.msgType, tt.payload, err)
+		}
+		if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s %s: 期望 %v, 实际 %v", tt.msgType, tt.payload, tt.want, err)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/network/security"
+)
+
+// authRequired 检查服务器是否要求客户端认证
+func (s *Server) authRequired() bool {
+	return s.currentConfig().AuthSecret != "" || s.hasTokens()
+}
+
+// handleAuthChallenge 生成随机数发送给客户端
+// 每个连接只允许一次认证, 返回false时应关闭连接
+func (s *Server) handleAuthChallenge(client *Client, msg *interfaces.Message) bool {
+	if client.nonce != "" || client.authAttempted {
+		s.logAuthFailure(client, "重复请求认证")
+		return false
+	}
+
+	challenge := interfaces.AuthChallenge{Required: s.clientAuthRequired(client)}
+	if challenge.Required {
+		nonce, err := security.NewNonce()
+		if err != nil {
+			s.logger.Error("生成认证随机数失败", interfaces.Fields{
+				"client": client.ID,
+				"error":  err,
+			})
+			return false
+		}
+		client.nonce = nonce
+		challenge.Nonce = nonce
+	}
+
+	if err := client.reply(msg, "auth_challenge", challenge); err != nil {
+		s.logger.Error("发送认证请求失败", interfaces.Fields{
+			"client": client.ID,
+			"error":  err,
+		})
+		return false
+	}
+	return true
+}
+
+// handleAuthResponse 校验客户端的认证应答
+// 认证失败时不返回结果, 直接关闭连接
+func (s *Server) handleAuthResponse(client *Client, msg *interfaces.Message) bool {
+	if !s.clientAuthRequired(client) {
+		client.authenticated = true
+		return client.reply(msg, "auth_result", interfaces.AuthResult{Success: true, Message: "服务器未启用认证"}) == nil
+	}
+
+	if client.nonce == "" || client.authAttempted {
+		s.logAuthFailure(client, "未请求认证随机数")
+		return false
+	}
+	// 随机数只能使用一次
+	nonce := client.nonce
+	client.authAttempted = true
+
+	var response interfaces.AuthResponse
+	if err := json.Unmarshal(msg.Payload, &response); err != nil {
+		s.logAuthFailure(client, "认证应答格式错误")
+		return false
+	}
+
+	// 未指定令牌时使用认证密钥, 拥有全部权限
+	secret := s.currentConfig().AuthSecret
+	if response.Token != "" {
+		if !s.tokenAllowed(client) {
+			s.logAuthFailure(client, fmt.Sprintf("该监听地址不接受访问令牌: %s", response.Token))
+			return false
+		}
+		token, ok := s.lookupToken(response.Token)
+		if !ok {
+			s.logAuthFailure(client, fmt.Sprintf("访问令牌不存在或已吊销: %s", response.Token))
+			return false
+		}
+		secret = token.Secret
+	}
+
+	if secret == "" || !security.VerifyAuthMAC(secret, nonce, msg.UUID, response.MAC) {
+		s.logAuthFailure(client, "认证密钥不匹配")
+		return false
+	}
+
+	// 令牌名称在更新令牌时会被并发读取
+	s.clientsMux.Lock()
+	client.authenticated = true
+	client.token = response.Token
+	s.clientsMux.Unlock()
+
+	s.logger.Info("客户端认证成功", interfaces.Fields{
+		"client": client.ID,
+		"addr":   client.conn.RemoteAddr(),
+		"uuid":   msg.UUID,
+		"token":  response.Token,
+	})
+	return client.reply(msg, "auth_result", interfaces.AuthResult{Success: true, Message: "认证成功"}) == nil
+}
+
+// checkAuthenticated 检查客户端是否已通过认证, 未通过时记录失败
+func (s *Server) checkAuthenticated(client *Client, msgType string) bool {
+	if !s.clientAuthRequired(client) || client.authenticated {
+		return true
+	}
+	s.logAuthFailure(client, fmt.Sprintf("未认证的客户端发送消息: %s", msgType))
+	return false
+}
+
+// logAuthFailure 记录认证失败
+func (s *Server) logAuthFailure(client *Client, reason string) {
+	s.logger.Warn("客户端认证失败", interfaces.Fields{
+		"client": client.ID,
+		"addr":   client.conn.RemoteAddr(),
+		"reason": reason,
+	})
+}
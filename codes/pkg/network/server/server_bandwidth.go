@@ -0,0 +1,52 @@
+package network
+
+import (
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/network/message"
+)
+
+// SetBandwidthLimits 设置总上传速率和单个客户端的上传速率上限(KB/s), 0表示不限速
+// 运行中修改立即对所有连接生效
+func (s *Server) SetBandwidthLimits(total, perClient int) {
+	s.uploadLimiter.SetRate(int64(total) * 1024)
+
+	s.clientsMux.Lock()
+	s.clientUploadLimit = perClient
+	for _, client := range s.clients {
+		client.uploadLimiter.SetRate(int64(perClient) * 1024)
+	}
+	for _, peer := range s.httpPeers {
+		peer.limiter.SetRate(int64(perClient) * 1024)
+	}
+	s.clientsMux.Unlock()
+
+	s.logger.Info("更新带宽限制", interfaces.Fields{
+		"total_kbps":      total,
+		"per_client_kbps": perClient,
+	})
+}
+
+// ApplyConfig 在运行中应用可热更新的配置: 同步文件夹、访问令牌、带宽限制和连接限制
+// 之后的文件清单、请求路径检查和文件变化检查使用新配置, 客户端可见的配置变化时通知客户端重新获取文件清单
+func (s *Server) ApplyConfig(config *interfaces.Config) {
+	view := clientView(config)
+	s.configMu.Lock()
+	s.config = config
+	changed := view != s.appliedView
+	s.appliedView = view
+	s.configMu.Unlock()
+
+	s.SetAccessTokens(config.AccessTokens)
+	s.SetBandwidthLimits(config.UploadLimit, config.ClientUploadLimit)
+	s.SetConnectionLimits(config)
+	if changed && s.running.Load() {
+		s.NotifyManifestChanged("服务器配置已更新")
+	}
+}
+
+// newClientLimiter 为新连接创建单独的限速器
+func (s *Server) newClientLimiter() *message.RateLimiter {
+	s.clientsMux.RLock()
+	defer s.clientsMux.RUnlock()
+	return message.NewRateLimiter(int64(s.clientUploadLimit) * 1024)
+}
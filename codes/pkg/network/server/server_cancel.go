@@ -0,0 +1,43 @@
+package network
+
+import (
+	"context"
+
+	"synctools/codes/internal/interfaces"
+)
+
+// trackRequest 为请求创建上下文, 连接关闭或客户端取消请求时取消
+// 未携带请求ID的请求无法被单独取消, 只随连接关闭取消
+func (c *Client) trackRequest(id uint32) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(c.ctx)
+	if id == 0 {
+		return ctx, cancel
+	}
+
+	c.cancelsMu.Lock()
+	c.cancels[id] = cancel
+	c.cancelsMu.Unlock()
+
+	return ctx, func() {
+		c.cancelsMu.Lock()
+		delete(c.cancels, id)
+		c.cancelsMu.Unlock()
+		cancel()
+	}
+}
+
+// handleCancelRequest 取消客户端进行中或排队中的请求, 请求已结束时忽略
+func (s *Server) handleCancelRequest(client *Client, msg *interfaces.Message) {
+	client.cancelsMu.Lock()
+	cancel, ok := client.cancels[msg.ID]
+	client.cancelsMu.Unlock()
+	if !ok {
+		return
+	}
+
+	s.logger.Debug("客户端取消请求", interfaces.Fields{
+		"client": client.ID,
+		"id":     msg.ID,
+	})
+	cancel()
+}
@@ -0,0 +1,123 @@
+package network
+
+import (
+	"net"
+	"os"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/network/message"
+)
+
+// startDiscovery 启动局域网发现, 未启用时不广播
+// 定期向局域网广播信标, 并回复客户端的探测, 服务器关闭时停止
+func (s *Server) startDiscovery(stop <-chan struct{}) {
+	if !s.currentConfig().Discovery {
+		return
+	}
+
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{Port: message.DiscoveryPort})
+	if err != nil {
+		// 同一台机器上已有服务器占用发现端口, 只广播信标
+		s.logger.Warn("监听局域网发现端口失败, 不回复客户端探测", interfaces.Fields{
+			"port":  message.DiscoveryPort,
+			"error": err,
+		})
+		conn, err = net.ListenUDP("udp4", nil)
+		if err != nil {
+			s.logger.Error("启动局域网发现失败", interfaces.Fields{
+				"error": err,
+			})
+			return
+		}
+	} else {
+		go s.answerProbes(conn)
+	}
+
+	s.logger.Info("局域网发现已启动", interfaces.Fields{
+		"port":     message.DiscoveryPort,
+		"interval": message.DiscoveryInterval.String(),
+	})
+
+	go func() {
+		defer conn.Close()
+		ticker := time.NewTicker(message.DiscoveryInterval)
+		defer ticker.Stop()
+
+		for {
+			s.broadcastBeacon(conn)
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// broadcastBeacon 向所有网卡的广播地址发送信标
+func (s *Server) broadcastBeacon(conn *net.UDPConn) {
+	data, err := message.EncodeBeacon(s.beacon())
+	if err != nil {
+		s.logger.Error("编码信标失败", interfaces.Fields{
+			"error": err,
+		})
+		return
+	}
+
+	for _, addr := range message.BroadcastAddrs(message.DiscoveryPort) {
+		if _, err := conn.WriteToUDP(data, addr); err != nil {
+			s.logger.Debug("发送信标失败", interfaces.Fields{
+				"addr":  addr.String(),
+				"error": err,
+			})
+		}
+	}
+}
+
+// answerProbes 回复客户端的探测, 连接关闭时退出
+// 只回复局域网地址, 避免伪造来源地址的探测把服务器用作放大攻击
+func (s *Server) answerProbes(conn *net.UDPConn) {
+	buf := make([]byte, message.MaxDiscoveryPacket)
+	for {
+		n, from, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return
+		}
+		kind, _, err := message.DecodeDiscovery(buf[:n])
+		if err != nil || kind != message.DiscoveryProbe {
+			continue
+		}
+		if !from.IP.IsPrivate() && !from.IP.IsLoopback() && !from.IP.IsLinkLocalUnicast() {
+			continue
+		}
+
+		data, err := message.EncodeBeacon(s.beacon())
+		if err != nil {
+			continue
+		}
+		conn.WriteToUDP(data, from)
+	}
+}
+
+// beacon 生成当前的服务器信标
+func (s *Server) beacon() *interfaces.ServerBeacon {
+	config := s.currentConfig()
+	hostname, _ := os.Hostname()
+	port := config.Port
+	if addr, ok := s.mainAddr().(*net.TCPAddr); ok {
+		port = addr.Port
+	}
+
+	return &interfaces.ServerBeacon{
+		UUID:            config.UUID,
+		ServerName:      hostname,
+		Name:            config.Name,
+		Version:         config.Version,
+		Port:            port,
+		HTTPPort:        config.HTTPPort,
+		TLS:             config.TLS.Enabled,
+		Fingerprint:     s.fingerprint,
+		ProtocolVersion: message.ProtocolVersion,
+	}
+}
@@ -0,0 +1,123 @@
+package network
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/network/message"
+)
+
+// handleInit 处理初始化握手, 协商协议版本和功能
+// 返回false表示握手失败, 调用方应关闭连接
+func (s *Server) handleInit(client *Client, msg *interfaces.Message) bool {
+	var initRequest interfaces.InitRequest
+	if err := json.Unmarshal(msg.Payload, &initRequest); err != nil {
+		s.logger.Error("解析初始化请求失败", interfaces.Fields{
+			"error": err,
+			"uuid":  msg.UUID,
+		})
+		return false
+	}
+
+	// 检查协议版本
+	if !message.IsProtocolSupported(initRequest.ProtocolVersion) {
+		s.rejectClient(client, msg, &interfaces.HandshakeReject{
+			Reason:     message.RejectProtocolVersion,
+			MinVersion: message.MinProtocolVersion,
+			MaxVersion: message.ProtocolVersion,
+		}, fmt.Sprintf("协议版本不兼容: 客户端 %d, 服务器支持 %d-%d",
+			initRequest.ProtocolVersion, message.MinProtocolVersion, message.ProtocolVersion))
+		return false
+	}
+
+	// 协商功能
+	capabilities := message.NegotiateCapabilities(message.SupportedCapabilities(), initRequest.Capabilities)
+	if missing := message.MissingCapabilities(capabilities); len(missing) > 0 {
+		s.rejectClient(client, msg, &interfaces.HandshakeReject{
+			Reason:     message.RejectCapabilities,
+			MinVersion: message.MinProtocolVersion,
+			MaxVersion: message.ProtocolVersion,
+			Missing:    missing,
+		}, fmt.Sprintf("客户端缺少必需的功能: %v", missing))
+		return false
+	}
+
+	client.UUID = initRequest.UUID
+	client.ProtocolVersion = initRequest.ProtocolVersion
+
+	// 只返回访问令牌可见的同步文件夹
+	serverConfig, serverMD5Map, err := s.clientManifest(client.ctx, client)
+	if err != nil {
+		s.logAuthFailure(client, err.Error())
+		return false
+	}
+
+	response := interfaces.InitResponse{
+		Success:         true,
+		Message:         "初始化成功",
+		Config:          serverConfig,
+		MD5Map:          serverMD5Map,
+		ProtocolVersion: message.ProtocolVersion,
+		Capabilities:    capabilities,
+	}
+
+	if err := client.reply(msg, "init_response", response); err != nil {
+		s.logger.Error("发送初始化响应失败", interfaces.Fields{
+			"error": err,
+			"uuid":  msg.UUID,
+		})
+		return false
+	}
+
+	// 初始化响应以未压缩格式发出, 之后的帧按协商结果压缩
+	client.msgSender.SetCompression(client.conn, message.HasCapability(capabilities, message.CapCompressDeflate))
+	s.clientsMux.Lock()
+	client.Capabilities = capabilities
+	client.handshaked = true
+	s.clientsMux.Unlock()
+	s.logger.Info("客户端握手完成", interfaces.Fields{
+		"client":       client.ID,
+		"protocol":     initRequest.ProtocolVersion,
+		"capabilities": capabilities,
+	})
+	return true
+}
+
+// isHandshakeMessage 检查是否为握手阶段允许的消息
+func isHandshakeMessage(msgType string) bool {
+	switch msgType {
+	case "auth_challenge", "auth_response", "init", message.MsgPing, message.MsgPong:
+		return true
+	}
+	return false
+}
+
+// rejectClient 拒绝客户端握手, 返回结构化的拒绝原因
+func (s *Server) rejectClient(client *Client, msg *interfaces.Message, reject *interfaces.HandshakeReject, reason string) {
+	s.logger.Warn("拒绝客户端连接", interfaces.Fields{
+		"client": client.ID,
+		"reason": reject.Reason,
+		"detail": reason,
+	})
+
+	client.reply(msg, "init_response", interfaces.InitResponse{
+		Success:         false,
+		Message:         reason,
+		ProtocolVersion: message.ProtocolVersion,
+		Reject:          reject,
+	})
+}
+
+// rejectLegacyClient 拒绝使用旧版协议的客户端
+// 以旧版格式回复, 让旧客户端能够显示需要升级的原因
+func (s *Server) rejectLegacyClient(client *Client) {
+	s.logger.Warn("拒绝旧版客户端连接", interfaces.Fields{
+		"client": client.ID,
+	})
+
+	client.msgSender.SendLegacyMessage(client.conn, "init_response", "", map[string]interface{}{
+		"success": false,
+		"message": fmt.Sprintf("客户端版本过旧, 请更新客户端 (服务器协议版本 %d)", message.ProtocolVersion),
+	})
+}
@@ -0,0 +1,154 @@
+package network
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/internal/testutil"
+	"synctools/codes/pkg/network/message"
+)
+
+// TestHandshakeNegotiation 握手时校验协议版本并协商功能, 版本不兼容或缺少必需功能时返回结构化的拒绝原因
+func TestHandshakeNegotiation(t *testing.T) {
+	s := NewServer(&interfaces.Config{Host: "127.0.0.1", SyncDir: t.TempDir()}, testSyncService{}, testutil.NewNopLogger())
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	tests := []struct {
+		name         string
+		version      int
+		capabilities []string
+		reject       string   // 为空时期望握手成功
+		negotiated   []string // 握手成功时协商的功能, 按服务器的优先级排列
+	}{
+		{"negotiated", message.ProtocolVersion,
+			[]string{"future_feature", message.CapCancel, message.CapHashMD5, message.CapChunkedTransfer}, "",
+			[]string{message.CapChunkedTransfer, message.CapHashMD5, message.CapCancel}},
+		{"new version", message.ProtocolVersion + 1, message.SupportedCapabilities(), message.RejectProtocolVersion, nil},
+		{"old version", message.MinProtocolVersion - 1, message.SupportedCapabilities(), message.RejectProtocolVersion, nil},
+		{"missing required", message.ProtocolVersion, []string{message.CapChunkedTransfer, message.CapResume}, message.RejectCapabilities, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.Dial("tcp", s.mainAddr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			sender := message.NewMessageSender(testutil.NewNopLogger())
+			if err := sender.SendMessageWithID(conn, 1, "init", "uuid", interfaces.InitRequest{
+				UUID:            "uuid",
+				ProtocolVersion: tt.version,
+				Capabilities:    tt.capabilities,
+			}); err != nil {
+				t.Fatal(err)
+			}
+			msg, err := sender.ReceiveMessage(conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var response interfaces.InitResponse
+			if err := json.Unmarshal(msg.Payload, &response); err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.reject == "" {
+				if !response.Success || !reflect.DeepEqual(response.Capabilities, tt.negotiated) {
+					t.Errorf("期望握手成功并协商 %v, 实际 %+v", tt.negotiated, response)
+				}
+				return
+			}
+			if response.Success || response.Reject == nil || response.Reject.Reason != tt.reject {
+				t.Fatalf("期望拒绝原因 %s, 实际 %+v", tt.reject, response)
+			}
+			if response.Reject.MinVersion != message.MinProtocolVersion || response.Reject.MaxVersion != message.ProtocolVersion {
+				t.Errorf("拒绝响应中的版本范围错误: %+v", response.Reject)
+			}
+			if tt.reject == message.RejectCapabilities && !reflect.DeepEqual(response.Reject.Missing, []string{message.CapHashMD5}) {
+				t.Errorf("缺少的功能错误: %v", response.Reject.Missing)
+			}
+		})
+	}
+}
+
+// TestLegacyClientRejected 旧版客户端收到旧版格式的升级提示
+func TestLegacyClientRejected(t *testing.T) {
+	s := NewServer(&interfaces.Config{Host: "127.0.0.1"}, testSyncService{}, testutil.NewNopLogger())
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	conn, err := net.Dial("tcp", s.mainAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte(`{"type":"init","uuid":"uuid","payload":{}}` + "\n")); err != nil {
+		t.Fatal(err)
+	}
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg struct {
+		Type    string `json:"type"`
+		Payload struct {
+			Success bool   `json:"success"`
+			Message string `json:"message"`
+		} `json:"payload"`
+	}
+	if err := json.Unmarshal([]byte(line), &msg); err != nil {
+		t.Fatal(err)
+	}
+	if msg.Type != "init_response" || msg.Payload.Success || !strings.Contains(msg.Payload.Message, "请更新客户端") {
+		t.Errorf("期望旧版格式的升级提示, 实际 %s", line)
+	}
+}
+
+// TestHandshakeTimeout 连接后在时限内未完成认证和初始化握手时断开, 只回复心跳不能保持连接
+func TestHandshakeTimeout(t *testing.T) {
+	s := NewServer(&interfaces.Config{Host: "127.0.0.1", SyncDir: t.TempDir(), AuthSecret: "secret"}, testSyncService{}, testutil.NewNopLogger())
+	s.authTimeout = 200 * time.Millisecond
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	conn, err := net.Dial("tcp", s.mainAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	sender := message.NewMessageSender(testutil.NewNopLogger())
+	deadline := time.Now().Add(5 * time.Second)
+	conn.SetDeadline(deadline)
+	for time.Now().Before(deadline) {
+		if err := sender.SendMessageWithID(conn, 1, message.MsgPing, "uuid", nil); err != nil {
+			break
+		}
+		if _, err := sender.ReceiveMessage(conn); err != nil {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	if !time.Now().Before(deadline) {
+		t.Fatal("未完成握手的连接没有断开")
+	}
+	waitFor(t, func() bool {
+		s.clientsMux.RLock()
+		defer s.clientsMux.RUnlock()
+		return len(s.clients) == 0
+	})
+}
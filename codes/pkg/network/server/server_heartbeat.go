@@ -0,0 +1,72 @@
+package network
+
+import (
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/network/message"
+)
+
+// defaultAuthTimeout 连接后完成认证和初始化握手的时限
+const defaultAuthTimeout = 30 * time.Second
+
+// touch 记录收到客户端数据的时间
+func (c *Client) touch() {
+	c.lastRecv.Store(time.Now().UnixNano())
+}
+
+// idle 距离上次收到客户端数据的时长
+func (c *Client) idle() time.Duration {
+	return time.Since(time.Unix(0, c.lastRecv.Load()))
+}
+
+// monitorClient 定期发送心跳, 连续多次未收到客户端数据时断开连接
+// 连接上的任何数据都视为存活, 传输大文件时不会被误判
+func (s *Server) monitorClient(client *Client, done <-chan struct{}) {
+	interval, misses := message.HeartbeatSettings(s.currentConfig())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		if idle := client.idle(); idle > interval*time.Duration(misses) {
+			s.logger.Warn("客户端心跳超时, 断开连接", interfaces.Fields{
+				"client": client.ID,
+				"addr":   client.conn.RemoteAddr(),
+				"idle":   idle.Round(time.Second).String(),
+			})
+			client.conn.Close()
+			return
+		}
+
+		if err := client.msgSender.SendMessageWithID(client.conn, 0, message.MsgPing, "", nil); err != nil {
+			s.logger.Debug("发送心跳失败", interfaces.Fields{
+				"client": client.ID,
+				"error":  err,
+			})
+		}
+	}
+}
+
+// expireHandshake 连接后在时限内未完成认证和初始化握手时断开连接
+// 未认证的连接只回复心跳也不会被判定断开, 不能一直占用连接数
+func (s *Server) expireHandshake(client *Client) {
+	s.clientsMux.RLock()
+	handshaked := client.handshaked
+	s.clientsMux.RUnlock()
+	if handshaked {
+		return
+	}
+
+	s.logger.Warn("客户端未在时限内完成握手, 断开连接", interfaces.Fields{
+		"client":  client.ID,
+		"addr":    client.conn.RemoteAddr(),
+		"timeout": s.authTimeout.String(),
+	})
+	client.conn.Close()
+}
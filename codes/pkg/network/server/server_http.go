@@ -0,0 +1,339 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/errors"
+	"synctools/codes/pkg/network/message"
+	"synctools/codes/pkg/network/security"
+)
+
+// httpReadHeaderTimeout 读取HTTP请求头的超时时间
+const httpReadHeaderTimeout = 10 * time.Second
+
+// serveHTTP 在监听地址上提供HTTP传输, 调用方需持有statusMu
+// 监听地址的TLS、只接受本机连接和认证策略与TCP监听地址的处理方式相同
+func (s *Server) serveHTTP(l *serverListener) {
+	mux := http.NewServeMux()
+	mux.HandleFunc(message.HTTPManifestPath, func(w http.ResponseWriter, r *http.Request) {
+		s.handleHTTPManifest(w, r, l)
+	})
+	mux.HandleFunc(message.HTTPFilesPath, func(w http.ResponseWriter, r *http.Request) {
+		s.handleHTTPFile(w, r, l)
+	})
+
+	server := &http.Server{
+		Handler:           mux,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+	}
+	s.httpServers = append(s.httpServers, server)
+
+	go func() {
+		if err := server.Serve(l.listener); err != nil && err != http.ErrServerClosed && s.running.Load() {
+			s.logger.Error("HTTP传输异常退出", interfaces.Fields{
+				"listener": l.config.Name,
+				"error":    err,
+			})
+		}
+	}()
+}
+
+// shutdownHTTP 关闭HTTP传输, 在截止时间前等待进行中的下载完成, 超时后强制关闭
+// 返回的通道在所有监听地址上的HTTP传输关闭完成后关闭
+func (s *Server) shutdownHTTP(deadline time.Time) <-chan struct{} {
+	s.statusMu.RLock()
+	servers := s.httpServers
+	s.statusMu.RUnlock()
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for _, server := range servers {
+		wg.Add(1)
+		go func(server *http.Server) {
+			defer wg.Done()
+			ctx, cancel := context.WithDeadline(context.Background(), deadline)
+			defer cancel()
+			if err := server.Shutdown(ctx); err != nil {
+				s.logger.Warn("等待HTTP下载完成超时, 强制关闭", interfaces.Fields{
+					"error": err,
+				})
+				server.Close()
+			}
+		}(server)
+	}
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
+
+// handleHTTPManifest 返回客户端可见的服务器配置和文件清单
+// 忽略规则和重定向随配置下发, 由客户端按与TCP传输相同的方式处理
+func (s *Server) handleHTTPManifest(w http.ResponseWriter, r *http.Request, l *serverListener) {
+	client, ok := s.authorizeHTTP(w, r, l)
+	if !ok {
+		return
+	}
+	defer s.releaseHTTP(client)
+
+	config, md5Map, err := s.clientManifest(r.Context(), client)
+	if err != nil {
+		httpError(w, http.StatusForbidden, err)
+		return
+	}
+
+	// 清单随文件变化, 不允许代理缓存
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(interfaces.ManifestResponse{
+		Success: true,
+		Message: "获取文件清单成功",
+		Config:  config,
+		MD5Map:  md5Map,
+		Version: s.manifestVersion.Load(),
+	})
+}
+
+// handleHTTPFile 下载同步文件夹中的文件, 支持Range续传
+// ETag为文件MD5, 代理可以据此缓存并在文件变化后重新获取, 客户端据此校验下载的文件
+func (s *Server) handleHTTPFile(w http.ResponseWriter, r *http.Request, l *serverListener) {
+	client, ok := s.authorizeHTTP(w, r, l)
+	if !ok {
+		return
+	}
+	defer s.releaseHTTP(client)
+
+	// 只提供令牌可见的同步文件夹中的文件, 拒绝的请求与文件不存在时的响应相同
+	token, err := s.clientToken(client)
+	if err != nil {
+		httpError(w, http.StatusForbidden, err)
+		return
+	}
+	requestPath := strings.TrimPrefix(r.URL.Path, message.HTTPFilesPath)
+	sp, err := s.sandboxRequest(client, "http_file", requestPath, filterFolders(token, s.currentConfig().SyncFolders))
+	if err != nil {
+		httpError(w, http.StatusNotFound, errors.NewError(errors.CodeStorageNotFound, "文件不存在", nil))
+		return
+	}
+
+	filePath := sp.local
+	file, err := os.Open(filePath)
+	if err != nil {
+		httpError(w, http.StatusNotFound, errors.NewError(errors.CodeStorageNotFound, "文件不存在", nil))
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		httpError(w, http.StatusNotFound, errors.NewError(errors.CodeStorageNotFound, "文件不存在", nil))
+		return
+	}
+
+	md5sum, err := s.md5Cache.Get(r.Context(), file, info)
+	if err != nil {
+		s.logger.Error("计算文件MD5失败", interfaces.Fields{
+			"file":  filePath,
+			"error": err,
+		})
+		httpError(w, http.StatusInternalServerError, errors.NewError(errors.CodeStorageLoad, "计算文件MD5失败", nil))
+		return
+	}
+
+	w.Header().Set("ETag", strconv.Quote(md5sum))
+	// 需要认证时只允许客户端自己缓存, 否则允许代理缓存, 使用前按ETag重新验证
+	if s.clientAuthRequired(client) {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	} else {
+		w.Header().Set("Cache-Control", "public, no-cache")
+	}
+
+	s.logger.Debug("处理HTTP文件请求", interfaces.Fields{
+		"addr":  r.RemoteAddr,
+		"file":  filePath,
+		"range": r.Header.Get("Range"),
+	})
+
+	// 文件数据先受单个客户端限速, 再受总带宽限速, 同一IP的并发请求共用单个客户端的限速
+	writer := &throttledWriter{
+		ResponseWriter: w,
+		ctx:            r.Context(),
+		limiters:       []*message.RateLimiter{client.uploadLimiter, s.uploadLimiter},
+	}
+	http.ServeContent(writer, r, info.Name(), info.ModTime(), file)
+}
+
+// authorizeHTTP 检查请求方法、连接数限制和请求签名, 返回代表本次请求的客户端
+// 连接数限制和认证策略与TCP连接相同: 按所属监听地址决定是否要求认证和是否接受访问令牌,
+// 服务器关闭或超出连接数限制时返回繁忙, 重复使用的签名视为重放; 检查失败时已写入错误响应
+// 检查通过的请求处理完成后需要调用 releaseHTTP
+func (s *Server) authorizeHTTP(w http.ResponseWriter, r *http.Request, l *serverListener) (*Client, bool) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		httpError(w, http.StatusMethodNotAllowed, errors.NewError(errors.CodeInvalid, "不支持的请求方法", nil))
+		return nil, false
+	}
+
+	client := &Client{
+		ID:       fmt.Sprintf("http-%s-%s", l.name(), r.RemoteAddr),
+		ip:       httpRemoteIP(r, l),
+		listener: l,
+	}
+	if ok, reason := s.admitHTTP(client); !ok {
+		s.logger.Warn("拒绝客户端连接", interfaces.Fields{
+			"listener": l.name(),
+			"addr":     r.RemoteAddr,
+			"reason":   reason,
+		})
+		httpError(w, http.StatusServiceUnavailable, errors.NewRetryableError(errors.CodeServiceBusy, reason, connBusyRetryAfter, nil))
+		return nil, false
+	}
+	if !s.clientAuthRequired(client) {
+		return client, true
+	}
+
+	auth, err := security.ParseRequestAuth(r.Header.Get("Authorization"))
+	if err == nil && auth.Token != "" && !s.tokenAllowed(client) {
+		err = fmt.Errorf("该监听地址不接受访问令牌: %s", auth.Token)
+	}
+	if err == nil {
+		err = s.verifyRequestAuth(auth, r.URL.Path)
+	}
+	if err != nil {
+		s.logger.Warn("客户端认证失败", interfaces.Fields{
+			"client": client.ID,
+			"addr":   r.RemoteAddr,
+			"reason": err.Error(),
+		})
+		s.releaseHTTP(client)
+		w.Header().Set("WWW-Authenticate", security.RequestAuthScheme)
+		httpError(w, http.StatusUnauthorized, errors.NewError(errors.CodeForbidden, "认证失败", nil))
+		return nil, false
+	}
+
+	client.UUID = auth.UUID
+	client.token = auth.Token
+	return client, true
+}
+
+// httpRemoteIP 获取HTTP请求的对端IP, Unix套接字上的请求返回空
+func httpRemoteIP(r *http.Request, l *serverListener) string {
+	if l.config.Network == networkUnix {
+		return ""
+	}
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
+
+// httpPeer 同一IP的HTTP客户端, 并发的请求共用单个客户端的上传限速
+type httpPeer struct {
+	requests int                  // 进行中的请求数
+	limiter  *message.RateLimiter // 上传限速
+}
+
+// admitHTTP 检查连接数限制并登记HTTP请求, 超出限制时返回拒绝原因
+// 每个进行中的请求与TCP连接一样计入总连接数和单个IP连接数
+func (s *Server) admitHTTP(client *Client) (bool, string) {
+	s.clientsMux.Lock()
+	defer s.clientsMux.Unlock()
+
+	if ok, reason := s.checkAdmission(client); !ok {
+		return false, reason
+	}
+
+	peer, ok := s.httpPeers[client.ip]
+	if !ok {
+		peer = &httpPeer{limiter: message.NewRateLimiter(int64(s.clientUploadLimit) * 1024)}
+		s.httpPeers[client.ip] = peer
+	}
+	peer.requests++
+	s.httpRequests++
+	if client.ip != "" {
+		s.ipConns[client.ip]++
+	}
+	client.uploadLimiter = peer.limiter
+	return true, ""
+}
+
+// releaseHTTP 释放HTTP请求占用的连接数
+func (s *Server) releaseHTTP(client *Client) {
+	s.clientsMux.Lock()
+	defer s.clientsMux.Unlock()
+
+	if peer, ok := s.httpPeers[client.ip]; ok {
+		if peer.requests--; peer.requests <= 0 {
+			delete(s.httpPeers, client.ip)
+		}
+	}
+	s.httpRequests--
+	if client.ip == "" {
+		return
+	}
+	if s.ipConns[client.ip]--; s.ipConns[client.ip] <= 0 {
+		delete(s.ipConns, client.ip)
+	}
+}
+
+// httpError 以JSON格式写入错误响应, 客户端按错误代码区分失败原因
+// 可以重试的错误同时设置Retry-After响应头
+func httpError(w http.ResponseWriter, status int, err error) {
+	response := message.NewErrorResponse(err)
+	if response.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(response.RetryAfter))
+	}
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// verifyRequestAuth 校验HTTP请求签名
+// 未指定令牌时使用认证密钥, 拥有全部权限
+func (s *Server) verifyRequestAuth(auth *security.RequestAuth, requestPath string) error {
+	secret := s.currentConfig().AuthSecret
+	if auth.Token != "" {
+		token, ok := s.lookupToken(auth.Token)
+		if !ok {
+			return fmt.Errorf("访问令牌不存在或已吊销: %s", auth.Token)
+		}
+		secret = token.Secret
+	}
+	if secret == "" {
+		return fmt.Errorf("认证密钥不匹配")
+	}
+	now := time.Now()
+	if err := auth.Verify(secret, requestPath, now); err != nil {
+		return err
+	}
+	return s.replay.Check(auth, now)
+}
+
+// throttledWriter 按限速器写入响应内容
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx      context.Context // 请求的上下文, 客户端断开或服务器关闭时停止等待
+	limiters []*message.RateLimiter
+}
+
+// Write 依次等待所有限速器后写入
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	for _, l := range w.limiters {
+		if err := l.Wait(w.ctx, len(p)); err != nil {
+			return 0, err
+		}
+	}
+	return w.ResponseWriter.Write(p)
+}
@@ -0,0 +1,62 @@
+package network
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/internal/testutil"
+	"synctools/codes/pkg/network/message"
+	"synctools/codes/pkg/network/security"
+)
+
+// TestHTTPListenerAuth HTTP传输按所属监听地址的认证策略处理请求, 重复使用的签名被拒绝
+func TestHTTPListenerAuth(t *testing.T) {
+	s := NewServer(&interfaces.Config{SyncDir: t.TempDir(), AuthSecret: "secret"}, testSyncService{}, testutil.NewNopLogger())
+	s.SetAccessTokens([]interfaces.AccessToken{{Name: "reader", Secret: "token-secret"}})
+
+	sign := func(secret, token string) string {
+		header, err := security.SignRequest(secret, token, "uuid", message.HTTPManifestPath, time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return header
+	}
+	replayed := sign("secret", "")
+
+	tests := []struct {
+		name   string
+		auth   interfaces.ListenerAuth
+		header string
+		status int
+	}{
+		{"default unsigned", interfaces.ListenerAuthDefault, "", http.StatusUnauthorized},
+		{"default secret", interfaces.ListenerAuthDefault, replayed, http.StatusOK},
+		{"default replayed", interfaces.ListenerAuthDefault, replayed, http.StatusUnauthorized},
+		{"default token", interfaces.ListenerAuthDefault, sign("token-secret", "reader"), http.StatusOK},
+		{"default wrong secret", interfaces.ListenerAuthDefault, sign("wrong", ""), http.StatusUnauthorized},
+		{"secret only token", interfaces.ListenerAuthSecret, sign("token-secret", "reader"), http.StatusUnauthorized},
+		{"secret only secret", interfaces.ListenerAuthSecret, sign("secret", ""), http.StatusOK},
+		{"none unsigned", interfaces.ListenerAuthNone, "", http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := &serverListener{config: interfaces.ListenerConfig{Name: "http", Network: networkTCP, Auth: tt.auth, HTTP: true}}
+			req := httptest.NewRequest(http.MethodGet, message.HTTPManifestPath, nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := httptest.NewRecorder()
+			s.handleHTTPManifest(w, req, l)
+			if w.Code != tt.status {
+				t.Errorf("期望状态码 %d, 实际 %d: %s", tt.status, w.Code, w.Body.String())
+			}
+		})
+	}
+
+	if s.httpRequests != 0 || len(s.ipConns) != 0 || len(s.httpPeers) != 0 {
+		t.Errorf("请求完成后应释放连接数: %d, %v, %v", s.httpRequests, s.ipConns, s.httpPeers)
+	}
+}
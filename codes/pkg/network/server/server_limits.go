@@ -0,0 +1,224 @@
+package network
+
+import (
+	"context"
+	"io"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/network/message"
+)
+
+const (
+	// 未配置时使用的默认限制
+	defaultMaxConnections       = 256
+	defaultMaxConnectionsPerIP  = 16
+	defaultMaxRequestsPerClient = 8
+	defaultRequestQueueSize     = 32
+
+	// connBusyRetryAfter 连接被拒绝时建议客户端等待的时间
+	connBusyRetryAfter = 10 * time.Second
+	// requestBusyRetryAfter 请求被拒绝时建议客户端等待的时间
+	requestBusyRetryAfter = 2 * time.Second
+	// busyDrainTimeout 拒绝连接后等待客户端读取响应的时间
+	busyDrainTimeout = time.Second
+)
+
+// connLimits 连接和请求数量限制
+type connLimits struct {
+	maxConnections int // 最大并发连接数
+	maxPerIP       int // 单个IP的最大连接数
+	maxRequests    int // 单个客户端同时处理的请求数
+	queueSize      int // 单个客户端排队等待的请求数
+}
+
+// requestLimiter 限制单个客户端同时处理和排队的请求数量
+type requestLimiter struct {
+	slots   chan struct{} // 处理中的请求占用的名额
+	pending atomic.Int32  // 处理中和排队中的请求总数
+	limit   int32         // 处理中和排队中的请求总数上限
+}
+
+// newRequestLimiter 创建请求限制器
+func newRequestLimiter(limits connLimits) *requestLimiter {
+	return &requestLimiter{
+		slots: make(chan struct{}, limits.maxRequests),
+		limit: int32(limits.maxRequests + limits.queueSize),
+	}
+}
+
+// reserve 预留一个请求名额, 处理和排队的请求都已满时返回false
+func (l *requestLimiter) reserve() bool {
+	if l.pending.Add(1) > l.limit {
+		l.pending.Add(-1)
+		return false
+	}
+	return true
+}
+
+// acquire 等待处理名额, 之前必须成功调用reserve
+func (l *requestLimiter) acquire() {
+	l.slots <- struct{}{}
+}
+
+// release 释放名额
+func (l *requestLimiter) release() {
+	<-l.slots
+	l.pending.Add(-1)
+}
+
+// SetConnectionLimits 设置连接和请求数量限制, 小于等于0的值使用默认值
+// 连接数限制立即生效, 请求数限制对新连接生效
+func (s *Server) SetConnectionLimits(config *interfaces.Config) {
+	limits := limitsFromConfig(config)
+
+	s.clientsMux.Lock()
+	s.limits = limits
+	s.clientsMux.Unlock()
+
+	s.logger.Info("更新连接限制", interfaces.Fields{
+		"max_connections":         limits.maxConnections,
+		"max_connections_per_ip":  limits.maxPerIP,
+		"max_requests_per_client": limits.maxRequests,
+		"request_queue_size":      limits.queueSize,
+	})
+}
+
+// limitsFromConfig 从配置读取连接和请求数量限制
+func limitsFromConfig(config *interfaces.Config) connLimits {
+	return connLimits{
+		maxConnections: withDefault(config.MaxConnections, defaultMaxConnections),
+		maxPerIP:       withDefault(config.MaxConnectionsPerIP, defaultMaxConnectionsPerIP),
+		maxRequests:    withDefault(config.MaxRequestsPerClient, defaultMaxRequestsPerClient),
+		queueSize:      withDefault(config.RequestQueueSize, defaultRequestQueueSize),
+	}
+}
+
+// withDefault 未配置时返回默认值
+func withDefault(value, def int) int {
+	if value <= 0 {
+		return def
+	}
+	return value
+}
+
+// admitClient 检查连接数限制并登记客户端, 超出限制时返回拒绝原因
+func (s *Server) admitClient(client *Client) (bool, string) {
+	s.clientsMux.Lock()
+	defer s.clientsMux.Unlock()
+
+	if ok, reason := s.checkAdmission(client); !ok {
+		return false, reason
+	}
+
+	client.requests = newRequestLimiter(s.limits)
+	s.clients[client.ID] = client
+	if client.ip != "" {
+		s.ipConns[client.ip]++
+	}
+	return true, ""
+}
+
+// checkAdmission 检查是否可以接受客户端的新连接或HTTP请求, 调用方需持有clientsMux
+// TCP连接和HTTP请求共用总连接数和单个IP连接数的限制
+func (s *Server) checkAdmission(client *Client) (bool, string) {
+	if s.draining.Load() {
+		return false, "服务器正在关闭"
+	}
+	// 进行中的HTTP请求同样占用连接数
+	if len(s.clients)+s.httpRequests >= s.limits.maxConnections {
+		return false, "服务器连接数已达上限"
+	}
+	// Unix套接字连接没有对端地址, 只受总连接数限制
+	if client.ip != "" && s.ipConns[client.ip] >= s.limits.maxPerIP {
+		return false, "该地址的连接数已达上限"
+	}
+	return true, ""
+}
+
+// removeClient 从客户端列表中移除客户端
+func (s *Server) removeClient(client *Client) {
+	s.clientsMux.Lock()
+	defer s.clientsMux.Unlock()
+
+	delete(s.clients, client.ID)
+	if client.ip == "" {
+		return
+	}
+	if s.ipConns[client.ip]--; s.ipConns[client.ip] <= 0 {
+		delete(s.ipConns, client.ip)
+	}
+}
+
+// rejectBusy 告知客户端服务器繁忙并关闭连接
+func (s *Server) rejectBusy(client *Client, reason string) {
+	s.logger.Warn("拒绝客户端连接", interfaces.Fields{
+		"addr":   client.conn.RemoteAddr(),
+		"reason": reason,
+	})
+
+	busy := message.NewBusyResponse(reason, connBusyRetryAfter)
+	if err := client.msgSender.SendMessageWithID(client.conn, 0, message.MsgBusy, "", busy); err != nil {
+		s.logger.Debug("发送繁忙响应失败", interfaces.Fields{
+			"addr":  client.conn.RemoteAddr(),
+			"error": err,
+		})
+	}
+	closeGracefully(client.conn)
+	client.msgSender.Release(client.conn)
+}
+
+// closeGracefully 关闭写入方向后丢弃对端已发送的数据再关闭连接
+// 直接关闭未读完的连接会发送RST, 对端可能来不及读取繁忙响应
+func closeGracefully(conn net.Conn) {
+	if cw, ok := conn.(interface{ CloseWrite() error }); ok {
+		cw.CloseWrite()
+		conn.SetReadDeadline(time.Now().Add(busyDrainTimeout))
+		io.Copy(io.Discard, io.LimitReader(conn, 64*1024))
+	}
+	conn.Close()
+}
+
+// runRequest 在客户端的请求名额内异步处理请求
+// 处理中的请求已满时排队等待, 排队也已满或服务器正在关闭时返回繁忙响应
+// 请求的上下文在客户端取消请求或连接关闭时取消, 排队期间被取消的请求不再处理
+func (s *Server) runRequest(client *Client, msg *interfaces.Message, handle func(ctx context.Context)) {
+	if s.draining.Load() {
+		client.reply(msg, message.MsgBusy, message.NewBusyResponse("服务器正在关闭", connBusyRetryAfter))
+		return
+	}
+	if !client.requests.reserve() {
+		s.logger.Warn("客户端请求过多", interfaces.Fields{
+			"client": client.ID,
+			"type":   msg.Type,
+		})
+		client.reply(msg, message.MsgBusy, message.NewBusyResponse("请求过多", requestBusyRetryAfter))
+		return
+	}
+
+	ctx, cancel := client.trackRequest(msg.ID)
+	go func() {
+		defer cancel()
+		client.requests.acquire()
+		defer client.requests.release()
+		if ctx.Err() != nil {
+			return
+		}
+		handle(ctx)
+	}()
+}
+
+// remoteIP 获取连接的对端IP, 无法解析时返回完整地址, Unix套接字连接返回空
+func remoteIP(conn net.Conn) string {
+	if isUnixConn(conn) {
+		return ""
+	}
+	addr := conn.RemoteAddr().String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
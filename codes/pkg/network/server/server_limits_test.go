@@ -0,0 +1,147 @@
+package network
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/internal/testutil"
+	"synctools/codes/pkg/errors"
+	"synctools/codes/pkg/network/message"
+)
+
+// TestAdmitClient 超出总连接数或单个IP连接数时拒绝连接, Unix套接字连接只受总连接数限制
+func TestAdmitClient(t *testing.T) {
+	s := NewServer(&interfaces.Config{MaxConnections: 3, MaxConnectionsPerIP: 1}, testSyncService{}, testutil.NewNopLogger())
+
+	steps := []struct {
+		id, ip string
+		ok     bool
+	}{
+		{"a1", "10.0.0.1", true},
+		{"a2", "10.0.0.1", false},
+		{"b1", "10.0.0.2", true},
+		{"unix1", "", true},
+		{"c1", "10.0.0.3", false},
+		{"unix2", "", false},
+	}
+	for _, step := range steps {
+		ok, reason := s.admitClient(&Client{ID: step.id, ip: step.ip})
+		if ok != step.ok {
+			t.Fatalf("%s: 期望 %v, 实际 %v (%s)", step.id, step.ok, ok, reason)
+		}
+	}
+
+	// 断开的连接释放名额
+	s.removeClient(&Client{ID: "a1", ip: "10.0.0.1"})
+	if ok, reason := s.admitClient(&Client{ID: "a3", ip: "10.0.0.1"}); !ok {
+		t.Fatalf("断开后应接受同一地址的连接: %s", reason)
+	}
+
+	s.draining.Store(true)
+	s.removeClient(&Client{ID: "b1", ip: "10.0.0.2"})
+	if ok, _ := s.admitClient(&Client{ID: "b2", ip: "10.0.0.2"}); ok {
+		t.Error("服务器正在关闭时不应接受连接")
+	}
+}
+
+// TestConnectionBusy 连接数已满时新连接收到可重试的繁忙响应, 并给出建议的等待时间
+func TestConnectionBusy(t *testing.T) {
+	s := NewServer(&interfaces.Config{Host: "127.0.0.1", MaxConnections: 1}, testSyncService{}, testutil.NewNopLogger())
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+	addr := s.mainAddr().String()
+
+	first, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	waitFor(t, func() bool {
+		s.clientsMux.RLock()
+		defer s.clientsMux.RUnlock()
+		return len(s.clients) == 1
+	})
+
+	second, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	msg, err := message.NewMessageSender(testutil.NewNopLogger()).ReceiveMessage(second)
+	if err != nil {
+		t.Fatal(err)
+	}
+	busy := message.ParseBusy(msg)
+	if !errors.Is(busy, errors.ErrServiceBusy) || !errors.IsRetryable(busy) || errors.GetRetryAfter(busy) != connBusyRetryAfter {
+		t.Errorf("期望繁忙响应并在 %v 后重试, 实际 %v", connBusyRetryAfter, busy)
+	}
+}
+
+// TestRequestLimiterBusy 处理和排队的请求都已满时, 新请求收到繁忙响应, 已排队的请求在名额释放后处理
+func TestRequestLimiterBusy(t *testing.T) {
+	s := NewServer(&interfaces.Config{MaxRequestsPerClient: 1, RequestQueueSize: 1}, testSyncService{}, testutil.NewNopLogger())
+	serverConn, clientConn := net.Pipe()
+	defer serverConn.Close()
+	defer clientConn.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	client := &Client{
+		ID:        "test",
+		conn:      serverConn,
+		server:    s,
+		msgSender: message.NewMessageSender(testutil.NewNopLogger()),
+		requests:  newRequestLimiter(s.limits),
+		ctx:       ctx,
+		cancel:    cancel,
+		cancels:   make(map[uint32]context.CancelFunc),
+	}
+
+	release := make(chan struct{})
+	handled := make(chan uint32, 2)
+	for id := uint32(1); id <= 3; id++ {
+		id := id
+		go s.runRequest(client, &interfaces.Message{ID: id, Type: "file_request"}, func(ctx context.Context) {
+			<-release
+			handled <- id
+		})
+		// 按顺序提交, 前两个请求分别占用处理和排队名额
+		waitFor(t, func() bool { return client.requests.pending.Load() == int32(min(id, 2)) })
+	}
+
+	msg, err := message.NewMessageSender(testutil.NewNopLogger()).ReceiveMessage(clientConn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	busy := message.ParseBusy(msg)
+	if msg.ID != 3 || !errors.Is(busy, errors.ErrServiceBusy) || errors.GetRetryAfter(busy) != requestBusyRetryAfter {
+		t.Errorf("第3个请求期望繁忙响应并在 %v 后重试, 实际 id %d: %v", requestBusyRetryAfter, msg.ID, busy)
+	}
+
+	close(release)
+	for i := 0; i < 2; i++ {
+		select {
+		case <-handled:
+		case <-time.After(5 * time.Second):
+			t.Fatal("排队的请求未被处理")
+		}
+	}
+}
+
+// waitFor 等待条件成立, 超时后测试失败
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("等待超时")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
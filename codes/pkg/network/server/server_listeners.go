@@ -0,0 +1,362 @@
+package network
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/errors"
+)
+
+const (
+	// mainListenerName 由Host和Port组成的主监听地址的名称
+	mainListenerName = "main"
+	// httpListenerName 由Host和HTTPPort组成的HTTP传输监听地址的名称
+	httpListenerName = "http"
+)
+
+// 监听地址支持的网络类型
+const (
+	networkTCP  = "tcp"
+	networkTCP4 = "tcp4"
+	networkTCP6 = "tcp6"
+	networkUnix = "unix"
+)
+
+// serverListener 服务器的一个监听地址
+// 每个监听地址可以单独设置TLS和认证策略, 连接建立后按所属监听地址处理
+type serverListener struct {
+	config   interfaces.ListenerConfig
+	listener net.Listener // 启动失败时为nil
+	status   string       // 状态描述, 由statusMu保护
+}
+
+// name 获取监听地址的名称, 为nil时为主监听地址
+func (l *serverListener) name() string {
+	if l == nil {
+		return mainListenerName
+	}
+	return l.config.Name
+}
+
+// listenerConfigs 获取所有监听地址的配置, 第一个为主监听地址
+// 配置了HTTPPort时第二个为HTTP传输的监听地址, TLS与主监听地址相同
+func (s *Server) listenerConfigs() []interfaces.ListenerConfig {
+	config := s.currentConfig()
+	configs := []interfaces.ListenerConfig{{
+		Name:    mainListenerName,
+		Network: networkTCP,
+		Address: net.JoinHostPort(config.Host, strconv.Itoa(config.Port)),
+		TLS:     config.TLS.Enabled,
+	}}
+	if config.HTTPPort > 0 {
+		configs = append(configs, interfaces.ListenerConfig{
+			Name:    httpListenerName,
+			Network: networkTCP,
+			Address: net.JoinHostPort(config.Host, strconv.Itoa(config.HTTPPort)),
+			TLS:     config.TLS.Enabled,
+			HTTP:    true,
+		})
+	}
+	return append(configs, config.Listeners...)
+}
+
+// requiredListeners 启动失败时服务器无法启动的监听地址数量, 即主监听地址和HTTPPort的监听地址
+func (s *Server) requiredListeners() int {
+	if s.currentConfig().HTTPPort > 0 {
+		return 2
+	}
+	return 1
+}
+
+// startListeners 启动所有监听地址, 没有监听地址启用TLS时不加载证书
+// 主监听地址或HTTPPort的监听地址启动失败时关闭已启动的监听并返回错误; 额外的监听地址启动失败只记录在状态中
+func (s *Server) startListeners() error {
+	configs := s.listenerConfigs()
+
+	var tlsConfig *tls.Config
+	for _, config := range configs {
+		if !config.TLS {
+			continue
+		}
+		var err error
+		if tlsConfig, err = s.loadTLSConfig(); err != nil {
+			return errors.NewError("NETWORK_TLS", "加载TLS证书失败", err)
+		}
+		break
+	}
+
+	listeners := make([]*serverListener, 0, len(configs))
+	for i, config := range configs {
+		if config.Name == "" {
+			config.Name = fmt.Sprintf("listener-%d", i)
+		}
+		if config.Network == "" {
+			config.Network = networkTCP
+		}
+		l := &serverListener{config: config}
+
+		ln, err := listen(config, tlsConfig, s.logger)
+		if err != nil {
+			if i < s.requiredListeners() {
+				for _, started := range listeners {
+					started.listener.Close()
+				}
+				return errors.NewError("NETWORK_START", "启动服务器失败", err)
+			}
+			l.status = fmt.Sprintf("启动失败: %v", err)
+			s.logger.Error("启动监听地址失败", interfaces.Fields{
+				"listener": config.Name,
+				"network":  config.Network,
+				"address":  config.Address,
+				"error":    err,
+			})
+			listeners = append(listeners, l)
+			continue
+		}
+
+		l.listener = ln
+		l.status = "运行中"
+		if config.Auth == interfaces.ListenerAuthNone && !config.LocalOnly && config.Network != networkUnix {
+			s.logger.Warn("监听地址不要求认证且接受远程连接", interfaces.Fields{
+				"listener": config.Name,
+				"address":  ln.Addr().String(),
+			})
+		}
+		if config.Auth == interfaces.ListenerAuthSecret && s.currentConfig().AuthSecret == "" {
+			s.logger.Warn("监听地址只接受认证密钥, 但未设置认证密钥, 所有连接都无法通过认证", interfaces.Fields{
+				"listener": config.Name,
+			})
+		}
+		s.logger.Info("监听地址已启动", interfaces.Fields{
+			"listener":   config.Name,
+			"network":    config.Network,
+			"address":    ln.Addr().String(),
+			"tls":        config.TLS,
+			"auth":       authPolicyName(config.Auth),
+			"local_only": config.LocalOnly,
+			"http":       config.HTTP,
+		})
+		listeners = append(listeners, l)
+	}
+
+	s.statusMu.Lock()
+	s.listeners = listeners
+	s.statusMu.Unlock()
+	return nil
+}
+
+// listen 按监听地址配置创建监听, 只接受本机连接时在TLS握手前关闭非本机连接
+func listen(config interfaces.ListenerConfig, tlsConfig *tls.Config, logger interfaces.Logger) (net.Listener, error) {
+	switch config.Network {
+	case networkTCP, networkTCP4, networkTCP6:
+	case networkUnix:
+		if config.Address == "" {
+			return nil, fmt.Errorf("Unix套接字路径不能为空")
+		}
+		if err := removeStaleSocket(config.Address); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("不支持的网络类型: %s", config.Network)
+	}
+
+	ln, err := net.Listen(config.Network, config.Address)
+	if err != nil {
+		return nil, err
+	}
+	if config.Network == networkUnix {
+		// 只允许当前用户的本机工具连接
+		os.Chmod(config.Address, 0600)
+	}
+	if config.LocalOnly {
+		ln = &localListener{Listener: ln, name: config.Name, logger: logger}
+	}
+	if config.TLS {
+		ln = tls.NewListener(ln, tlsConfig)
+	}
+	return ln, nil
+}
+
+// removeStaleSocket 删除上次异常退出残留的Unix套接字文件
+// 套接字仍有进程监听或路径是普通文件时返回错误, 不删除
+func removeStaleSocket(path string) error {
+	info, err := os.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("路径已存在且不是套接字: %s", path)
+	}
+	if conn, err := net.DialTimeout(networkUnix, path, time.Second); err == nil {
+		conn.Close()
+		return fmt.Errorf("套接字已被其他进程使用: %s", path)
+	}
+	return os.Remove(path)
+}
+
+// closeListeners 关闭所有监听地址, 已建立的连接不受影响
+func (s *Server) closeListeners() {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+	for _, l := range s.listeners {
+		if l.listener != nil {
+			l.listener.Close()
+			l.status = "已停止"
+		}
+	}
+}
+
+// acceptClients 接受监听地址上的新连接
+func (s *Server) acceptClients(l *serverListener) {
+	for s.running.Load() {
+		conn, err := l.listener.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				s.logger.Warn("网络操作", interfaces.Fields{
+					"action":   "accept_temporary_error",
+					"listener": l.config.Name,
+					"error":    err,
+				})
+				continue
+			}
+			if s.running.Load() {
+				s.logger.Error("网络操作失败", interfaces.Fields{
+					"operation": "accept",
+					"listener":  l.config.Name,
+					"error":     err,
+				})
+				s.statusMu.Lock()
+				l.status = fmt.Sprintf("异常退出: %v", err)
+				s.statusMu.Unlock()
+			}
+			return
+		}
+
+		go s.serveClient(conn, l)
+	}
+}
+
+// localListener 只接受本机连接的监听, TCP和HTTP传输共用
+type localListener struct {
+	net.Listener
+	name   string
+	logger interfaces.Logger
+}
+
+// Accept 接受下一个本机连接, 关闭非本机连接
+func (l *localListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil || isLocalConn(conn) {
+			return conn, err
+		}
+		l.logger.Warn("拒绝非本机连接", interfaces.Fields{
+			"listener": l.name,
+			"addr":     conn.RemoteAddr(),
+		})
+		conn.Close()
+	}
+}
+
+// isLocalConn 检查连接是否来自本机
+func isLocalConn(conn net.Conn) bool {
+	if isUnixConn(conn) {
+		return true
+	}
+	ip := net.ParseIP(remoteIP(conn))
+	return ip != nil && ip.IsLoopback()
+}
+
+// isUnixConn 检查是否为Unix套接字连接
+func isUnixConn(conn net.Conn) bool {
+	_, ok := conn.LocalAddr().(*net.UnixAddr)
+	return ok
+}
+
+// clientAuthRequired 检查连接所属的监听地址是否要求认证
+func (s *Server) clientAuthRequired(client *Client) bool {
+	if client.listener == nil {
+		return s.authRequired()
+	}
+	switch client.listener.config.Auth {
+	case interfaces.ListenerAuthNone:
+		return false
+	case interfaces.ListenerAuthSecret:
+		return true
+	default:
+		return s.authRequired()
+	}
+}
+
+// tokenAllowed 检查连接所属的监听地址是否接受访问令牌
+func (s *Server) tokenAllowed(client *Client) bool {
+	return client.listener == nil || client.listener.config.Auth != interfaces.ListenerAuthSecret
+}
+
+// mainAddr 获取主监听地址, 未启动时为nil
+func (s *Server) mainAddr() net.Addr {
+	s.statusMu.RLock()
+	defer s.statusMu.RUnlock()
+	if len(s.listeners) == 0 || s.listeners[0].listener == nil {
+		return nil
+	}
+	return s.listeners[0].listener.Addr()
+}
+
+// GetListeners 获取所有监听地址的状态
+func (s *Server) GetListeners() []interfaces.ListenerStatus {
+	s.statusMu.RLock()
+	defer s.statusMu.RUnlock()
+
+	statuses := make([]interfaces.ListenerStatus, 0, len(s.listeners))
+	for _, l := range s.listeners {
+		status := interfaces.ListenerStatus{
+			Name:    l.config.Name,
+			Network: l.config.Network,
+			Address: l.config.Address,
+			TLS:     l.config.TLS,
+			Auth:    l.config.Auth,
+			HTTP:    l.config.HTTP,
+			Running: l.listener != nil && s.running.Load() && l.status == "运行中",
+			Status:  l.status,
+		}
+		if l.listener != nil {
+			status.Address = l.listener.Addr().String()
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses
+}
+
+// listenersSummary 生成所有监听地址状态的摘要
+func (s *Server) listenersSummary() string {
+	var parts []string
+	for _, l := range s.GetListeners() {
+		desc := fmt.Sprintf("%s %s://%s", l.Name, l.Network, l.Address)
+		if l.HTTP {
+			desc += " HTTP"
+		}
+		if l.TLS {
+			desc += " TLS"
+		}
+		parts = append(parts, fmt.Sprintf("%s: %s", desc, l.Status))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// authPolicyName 获取认证策略的显示名称
+func authPolicyName(auth interfaces.ListenerAuth) string {
+	if auth == interfaces.ListenerAuthDefault {
+		return "default"
+	}
+	return string(auth)
+}
@@ -0,0 +1,183 @@
+package network
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/internal/testutil"
+)
+
+// addrConn 指定对端地址的连接
+type addrConn struct {
+	net.Conn
+	remote net.Addr
+}
+
+func (c *addrConn) RemoteAddr() net.Addr { return c.remote }
+func (c *addrConn) LocalAddr() net.Addr {
+	return &net.TCPAddr{IP: net.IPv4(192, 168, 1, 1), Port: 25000}
+}
+
+// fakeListener 按顺序返回指定连接的监听
+type fakeListener struct {
+	conns chan net.Conn
+}
+
+func (l *fakeListener) Accept() (net.Conn, error) {
+	conn, ok := <-l.conns
+	if !ok {
+		return nil, net.ErrClosed
+	}
+	return conn, nil
+}
+func (l *fakeListener) Close() error   { return nil }
+func (l *fakeListener) Addr() net.Addr { return &net.TCPAddr{} }
+
+// TestLocalListener 只接受本机连接的监听地址关闭远程连接, 只返回本机连接
+func TestLocalListener(t *testing.T) {
+	remotes := []net.Addr{
+		&net.TCPAddr{IP: net.ParseIP("192.168.1.2"), Port: 5000},
+		&net.TCPAddr{IP: net.ParseIP("::ffff:10.0.0.1"), Port: 5000},
+		&net.TCPAddr{IP: net.ParseIP("::1"), Port: 5000},
+		&net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 5000},
+	}
+	fake := &fakeListener{conns: make(chan net.Conn, len(remotes))}
+	peers := make([]net.Conn, len(remotes))
+	for i, remote := range remotes {
+		server, client := net.Pipe()
+		defer client.Close()
+		peers[i] = client
+		fake.conns <- &addrConn{Conn: server, remote: remote}
+	}
+	close(fake.conns)
+
+	ln := &localListener{Listener: fake, name: "admin", logger: testutil.NewNopLogger()}
+	for _, want := range remotes[2:] {
+		conn, err := ln.Accept()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if conn.RemoteAddr() != want {
+			t.Errorf("期望接受 %v, 实际 %v", want, conn.RemoteAddr())
+		}
+	}
+	if _, err := ln.Accept(); err == nil {
+		t.Error("期望没有更多连接")
+	}
+
+	// 远程连接已被关闭
+	for _, peer := range peers[:2] {
+		if _, err := peer.Write([]byte("x")); err == nil {
+			t.Error("远程连接应被关闭")
+		}
+	}
+}
+
+// TestUnixListener Unix套接字只允许当前用户访问, 重启时删除残留的套接字, 但不删除普通文件和仍在使用的套接字
+func TestUnixListener(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix套接字文件权限只在类Unix系统上有效")
+	}
+	dir, err := os.MkdirTemp("", "st")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "admin.sock")
+	config := interfaces.ListenerConfig{Name: "admin", Network: networkUnix, Address: path}
+	log := testutil.NewNopLogger()
+
+	// 异常退出残留的套接字文件
+	stale, err := net.Listen(networkUnix, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := listen(config, nil, log)
+	if err != nil {
+		t.Fatalf("应删除残留的套接字: %v", err)
+	}
+	defer ln.Close()
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := info.Mode().Perm(); perm != 0600 {
+		t.Errorf("套接字权限 %o, 期望 600", perm)
+	}
+
+	if _, err := listen(config, nil, log); err == nil {
+		t.Error("套接字仍在使用时不应删除")
+	}
+
+	file := filepath.Join(dir, "file.sock")
+	if err := os.WriteFile(file, []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	config.Address = file
+	if _, err := listen(config, nil, log); err == nil {
+		t.Error("不应删除普通文件")
+	}
+	if _, err := os.Stat(file); err != nil {
+		t.Errorf("普通文件应保留: %v", err)
+	}
+}
+
+// TestUnixListenerClients Unix套接字连接视为本机连接, 不计入单个IP的连接数, 按监听地址的认证策略处理
+func TestUnixListenerClients(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Unix套接字只在类Unix系统上测试")
+	}
+	dir, err := os.MkdirTemp("", "st")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "admin.sock")
+
+	s := NewServer(&interfaces.Config{
+		Host:                "127.0.0.1",
+		AuthSecret:          "secret",
+		MaxConnectionsPerIP: 1,
+		Listeners: []interfaces.ListenerConfig{
+			{Name: "admin", Network: networkUnix, Address: path, Auth: interfaces.ListenerAuthNone, LocalOnly: true},
+		},
+	}, testSyncService{}, testutil.NewNopLogger())
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	for i := 0; i < 2; i++ {
+		conn, err := net.Dial(networkUnix, path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+	}
+	var clients []*Client
+	waitFor(t, func() bool {
+		s.clientsMux.RLock()
+		defer s.clientsMux.RUnlock()
+		clients = clients[:0]
+		for _, c := range s.clients {
+			clients = append(clients, c)
+		}
+		return len(clients) == 2
+	})
+
+	for _, client := range clients {
+		if client.ip != "" || client.listener.name() != "admin" {
+			t.Errorf("客户端 %s: ip %q, 监听地址 %s", client.ID, client.ip, client.listener.name())
+		}
+		if s.clientAuthRequired(client) {
+			t.Errorf("客户端 %s: 不要求认证的监听地址上的连接不需要认证", client.ID)
+		}
+	}
+}
@@ -0,0 +1,191 @@
+package network
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/network/message"
+)
+
+// defaultWatchInterval 检查同步目录文件变化的间隔
+const defaultWatchInterval = 5 * time.Second
+
+// clientManifest 生成客户端可见的服务器配置和文件清单
+// 只包含已启用且访问令牌可见的同步文件夹, 配置只发送客户端需要的字段
+func (s *Server) clientManifest(ctx context.Context, client *Client) (*interfaces.Config, map[string]map[string]string, error) {
+	token, err := s.clientToken(client)
+	if err != nil {
+		return nil, nil, err
+	}
+	config := s.currentConfig()
+	folders := filterFolders(token, enabledFolders(config.SyncFolders))
+
+	// 获取所有同步文件夹的MD5列表
+	md5Map := make(map[string]map[string]string)
+	for _, folder := range folders {
+		files, err := s.syncService.GetLocalFilesWithMD5(ctx, folder.Path)
+		if err != nil && ctx.Err() != nil {
+			return nil, nil, ctx.Err()
+		}
+		if err != nil {
+			s.logger.Error("获取服务端文件MD5失败", interfaces.Fields{
+				"folder": folder.Path,
+				"error":  err,
+			})
+			continue
+		}
+		md5Map[folder.Path] = files
+	}
+
+	return message.ClientConfig(config, folders), md5Map, nil
+}
+
+// handleManifestRequest 返回服务器当前的文件清单, 客户端收到变化通知后用于重新计算同步计划
+func (s *Server) handleManifestRequest(ctx context.Context, client *Client, msg *interfaces.Message) {
+	config, md5Map, err := s.clientManifest(ctx, client)
+	if ctx.Err() != nil {
+		return
+	}
+	if err != nil {
+		client.replyError(msg, message.MsgManifestResponse, err)
+		return
+	}
+
+	client.reply(msg, message.MsgManifestResponse, interfaces.ManifestResponse{
+		Success: true,
+		Message: "获取文件清单成功",
+		Config:  config,
+		MD5Map:  md5Map,
+		Version: s.manifestVersion.Load(),
+	})
+}
+
+// NotifyManifestChanged 通知已连接的客户端服务器文件清单已变化
+// 只通知握手时协商了变化通知功能的客户端
+func (s *Server) NotifyManifestChanged(reason string) {
+	notice := interfaces.ManifestChanged{
+		Version: s.manifestVersion.Add(1),
+		Reason:  reason,
+	}
+
+	s.clientsMux.RLock()
+	defer s.clientsMux.RUnlock()
+
+	notified := 0
+	for _, client := range s.clients {
+		if !client.handshaked || !message.HasCapability(client.Capabilities, message.CapManifestNotify) {
+			continue
+		}
+		go client.msgSender.SendMessageWithID(client.conn, 0, message.MsgManifestChanged, "", notice)
+		notified++
+	}
+
+	s.logger.Info("文件清单已变化", interfaces.Fields{
+		"version": notice.Version,
+		"reason":  reason,
+		"clients": notified,
+	})
+}
+
+// watchManifest 定期检查同步文件夹, 文件变化时通知客户端
+// 文件仍在写入时清单会持续变化, 连续两次检查结果一致后才通知, 避免客户端拿到写了一半的文件
+// 没有协商变化通知功能的客户端时不检查, 有客户端后的第一次检查结果作为比较的基准
+func (s *Server) watchManifest(stop <-chan struct{}) {
+	var notified, last string
+	for {
+		select {
+		case <-stop:
+			return
+		case <-time.After(s.watchInterval()):
+		}
+
+		if !s.hasManifestWatchers() {
+			notified, last = "", ""
+			continue
+		}
+
+		current := s.snapshotManifest()
+		if notified == "" {
+			notified, last = current, current
+			continue
+		}
+		if current == last && current != notified {
+			notified = current
+			s.NotifyManifestChanged("同步目录文件已变化")
+		}
+		last = current
+	}
+}
+
+// watchInterval 获取检查同步目录文件变化的间隔, 运行中保存配置后下一次检查生效
+func (s *Server) watchInterval() time.Duration {
+	if interval := s.currentConfig().WatchInterval; interval > 0 {
+		return time.Duration(interval) * time.Second
+	}
+	return defaultWatchInterval
+}
+
+// hasManifestWatchers 检查是否有握手时协商了变化通知功能的客户端
+func (s *Server) hasManifestWatchers() bool {
+	s.clientsMux.RLock()
+	defer s.clientsMux.RUnlock()
+	for _, client := range s.clients {
+		if client.handshaked && message.HasCapability(client.Capabilities, message.CapManifestNotify) {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshotManifest 计算同步文件夹下所有文件的路径、大小和修改时间的摘要
+// 不存在的同步文件夹和无法读取的文件跳过, 与客户端获取的文件清单一致
+func (s *Server) snapshotManifest() string {
+	config := s.currentConfig()
+	h := sha256.New()
+	for _, folder := range enabledFolders(config.SyncFolders) {
+		root := filepath.Join(config.SyncDir, folder.Path)
+		fmt.Fprintf(h, "%s\x00", folder.Path)
+
+		// filepath.Walk按文件名顺序遍历, 相同内容得到相同摘要
+		filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				if !os.IsNotExist(err) {
+					s.logger.Debug("检查文件变化失败", interfaces.Fields{
+						"path":  path,
+						"error": err,
+					})
+				}
+				return nil
+			}
+			if info.IsDir() {
+				return nil
+			}
+			rel, _ := filepath.Rel(root, path)
+			fmt.Fprintf(h, "%s\x00%d\x00%d\x00", rel, info.Size(), info.ModTime().UnixNano())
+			return nil
+		})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// clientView 序列化配置中影响客户端文件清单的部分: 同步目录、发送给客户端的配置和各访问令牌可见的文件夹
+// 带宽、连接限制和令牌吊销不影响文件清单, 吊销的令牌的客户端会直接断开
+func clientView(config *interfaces.Config) string {
+	tokens := make(map[string][]string, len(config.AccessTokens))
+	for _, token := range config.AccessTokens {
+		tokens[token.Name] = token.Folders
+	}
+	data, _ := json.Marshal(struct {
+		SyncDir string
+		Config  *interfaces.Config
+		Tokens  map[string][]string
+	}{config.SyncDir, message.ClientConfig(config, enabledFolders(config.SyncFolders)), tokens})
+	return string(data)
+}
@@ -0,0 +1,127 @@
+package network
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/internal/testutil"
+	"synctools/codes/pkg/network/message"
+)
+
+// TestApplyConfigFolders 运行中保存的配置替换服务器使用的配置, 新增的同步文件夹出现在清单中并可以访问
+func TestApplyConfigFolders(t *testing.T) {
+	dir := t.TempDir()
+	s := NewServer(&interfaces.Config{
+		SyncDir:     dir,
+		SyncFolders: []interfaces.SyncFolder{{Path: "mods", IsEnabled: true}},
+	}, testSyncService{}, testutil.NewNopLogger())
+	client := &Client{ID: "test"}
+
+	if _, err := s.sandboxDelete(client, "delete_request", "config/a.cfg"); err == nil {
+		t.Fatal("应用新配置前期望拒绝访问未配置的同步文件夹")
+	}
+
+	s.ApplyConfig(&interfaces.Config{
+		SyncDir: dir,
+		SyncFolders: []interfaces.SyncFolder{
+			{Path: "mods", IsEnabled: true},
+			{Path: "config", IsEnabled: true, AllowDelete: true},
+		},
+	})
+
+	config, md5Map, err := s.clientManifest(context.Background(), client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.SyncFolders) != 2 || len(md5Map) != 2 {
+		t.Errorf("清单未使用新配置: %v", config.SyncFolders)
+	}
+	if _, err := s.sandboxDelete(client, "delete_request", "config/a.cfg"); err != nil {
+		t.Errorf("应用新配置后期望允许访问新增的同步文件夹, 实际 %v", err)
+	}
+}
+
+// TestApplyConfigNotify 只有客户端可见的配置变化时才通知客户端, 带宽限制和令牌吊销不通知
+func TestApplyConfigNotify(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(config *interfaces.Config)
+		notify bool
+	}{
+		{"unchanged", func(config *interfaces.Config) {}, false},
+		{"bandwidth", func(config *interfaces.Config) { config.UploadLimit = 1024 }, false},
+		{"connection limits", func(config *interfaces.Config) { config.MaxConnections = 10 }, false},
+		{"revoke token", func(config *interfaces.Config) { config.AccessTokens[0].Revoked = true }, false},
+		{"add folder", func(config *interfaces.Config) {
+			config.SyncFolders = append(config.SyncFolders, interfaces.SyncFolder{Path: "config", IsEnabled: true})
+		}, true},
+		{"ignore list", func(config *interfaces.Config) { config.IgnoreList = []string{"*.log"} }, true},
+		{"token folders", func(config *interfaces.Config) { config.AccessTokens[0].Folders = []string{"mods", "config"} }, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &interfaces.Config{
+				SyncDir:      t.TempDir(),
+				SyncFolders:  []interfaces.SyncFolder{{Path: "mods", IsEnabled: true}},
+				AccessTokens: []interfaces.AccessToken{{Name: "reader", Secret: "r", Folders: []string{"mods"}}},
+			}
+			s := NewServer(config, testSyncService{}, testutil.NewNopLogger())
+			s.ApplyConfig(config)
+			s.running.Store(true)
+
+			// 与界面保存配置一样, 吊销令牌时直接修改当前配置后保存
+			tt.change(config)
+			s.ApplyConfig(config)
+
+			if notified := s.manifestVersion.Load() > 0; notified != tt.notify {
+				t.Errorf("期望通知 %v, 实际 %v", tt.notify, notified)
+			}
+		})
+	}
+}
+
+// TestSnapshotManifest 不存在的同步文件夹跳过, 文件变化时摘要变化
+func TestSnapshotManifest(t *testing.T) {
+	dir := t.TempDir()
+	s := NewServer(&interfaces.Config{
+		SyncDir:     dir,
+		SyncFolders: []interfaces.SyncFolder{{Path: "mods", IsEnabled: true}},
+	}, testSyncService{}, testutil.NewNopLogger())
+
+	missing := s.snapshotManifest()
+	if err := os.Mkdir(filepath.Join(dir, "mods"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if empty := s.snapshotManifest(); empty != missing {
+		t.Error("不存在的同步文件夹应与空文件夹相同")
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "mods", "a.jar"), []byte("a"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if changed := s.snapshotManifest(); changed == missing {
+		t.Error("新增文件后摘要应变化")
+	}
+}
+
+// TestHasManifestWatchers 只有握手时协商了变化通知功能的客户端才需要检查文件变化
+func TestHasManifestWatchers(t *testing.T) {
+	s := NewServer(&interfaces.Config{}, testSyncService{}, testutil.NewNopLogger())
+	if s.hasManifestWatchers() {
+		t.Error("没有客户端时不应检查文件变化")
+	}
+
+	s.clients["old"] = &Client{ID: "old", handshaked: true, Capabilities: []string{message.CapChunkedTransfer}}
+	s.clients["pending"] = &Client{ID: "pending", Capabilities: []string{message.CapManifestNotify}}
+	if s.hasManifestWatchers() {
+		t.Error("没有协商变化通知功能的客户端时不应检查文件变化")
+	}
+
+	s.clients["new"] = &Client{ID: "new", handshaked: true, Capabilities: []string{message.CapManifestNotify}}
+	if !s.hasManifestWatchers() {
+		t.Error("有协商变化通知功能的客户端时应检查文件变化")
+	}
+}
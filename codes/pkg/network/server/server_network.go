@@ -1,40 +1,110 @@
 package network
 
 import (
-	"crypto/md5"
-	"encoding/hex"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net"
+	"net/http"
 	"os"
 	"path/filepath"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"synctools/codes/internal/interfaces"
 	"synctools/codes/pkg/errors"
 	"synctools/codes/pkg/network/message"
+	"synctools/codes/pkg/network/security"
 )
 
 // Server 网络服务器实现
 type Server struct {
-	config      *interfaces.Config
+	config      *interfaces.Config // 运行中保存配置时替换, 由configMu保护
+	configMu    sync.RWMutex
+	appliedView string // 上次应用的配置中影响客户端文件清单的部分, 由configMu保护
 	syncService interfaces.ServerSyncService
-	listener    net.Listener
+	listeners   []*serverListener // 所有监听地址, 第一个为主监听地址, 由statusMu保护
 	clients     map[string]*Client
 	clientsMux  sync.RWMutex
 	logger      interfaces.Logger
-	running     bool
+	running     atomic.Bool
+	draining    atomic.Bool // 是否正在关闭, 关闭期间不再接受新请求
 	status      string
+	statusMu    sync.RWMutex
+	certDir     string // 自动生成证书的保存目录
+	fingerprint string // 当前使用的证书指纹
+
+	tokens   map[string]interfaces.AccessToken // 访问令牌, 按名称索引
+	tokensMu sync.RWMutex
+
+	uploadLimiter     *message.RateLimiter // 所有客户端共享的上传限速
+	clientUploadLimit int                  // 单个客户端的上传速率上限(KB/s)
+
+	limits  connLimits     // 连接和请求数量限制
+	ipConns map[string]int // 每个IP的连接数
+	connSeq atomic.Uint64  // 连接序号, 用于生成唯一的客户端ID
+
+	authTimeout time.Duration // 连接后完成认证和初始化握手的时限
+
+	httpPeers    map[string]*httpPeer // 进行中的HTTP请求, 按IP合并, 由clientsMux保护
+	httpRequests int                  // 进行中的HTTP请求数, 由clientsMux保护
+
+	manifestVersion atomic.Uint64 // 文件清单版本, 每次变化加一
+	watchStop       chan struct{} // 停止文件变化检查
+
+	httpServers []*http.Server       // HTTP传输的监听地址上的服务, 由statusMu保护
+	md5Cache    message.MD5Cache     // 发送文件和HTTP下载的ETag使用的文件MD5缓存
+	replay      security.ReplayGuard // 已使用的HTTP请求签名
 }
 
 // Client 客户端连接
 type Client struct {
-	ID        string
-	UUID      string
-	conn      net.Conn
-	server    *Server
-	msgSender *message.MessageSender
+	ID              string
+	UUID            string
+	ProtocolVersion int      // 客户端协议版本
+	Capabilities    []string // 握手协商出的共同功能
+	conn            net.Conn
+	server          *Server
+	msgSender       *message.MessageSender
+	handshaked      bool                 // 是否已完成握手
+	authenticated   bool                 // 是否已通过认证
+	nonce           string               // 发给客户端的认证随机数
+	token           string               // 认证使用的访问令牌名称, 为空表示拥有全部权限
+	lastRecv        atomic.Int64         // 最后收到客户端数据的时间(UnixNano)
+	uploadLimiter   *message.RateLimiter // 该客户端的上传限速
+	authAttempted   bool                 // 是否已提交过认证应答
+	ip              string               // 客户端IP, Unix套接字连接为空
+	listener        *serverListener      // 连接所属的监听地址, 为nil时按主监听地址处理
+	requests        *requestLimiter      // 处理中和排队中的请求
+
+	ctx       context.Context               // 连接的上下文, 连接关闭时取消
+	cancel    context.CancelFunc            // 取消连接上所有进行中的请求
+	cancels   map[uint32]context.CancelFunc // 进行中和排队中的请求, 按请求ID索引
+	cancelsMu sync.Mutex
+}
+
+// outboundQueueSize 每个客户端连接的发送队列长度
+const outboundQueueSize = 64
+
+// reply 发送响应消息, 携带与请求相同的ID以便客户端对应到等待的请求
+func (c *Client) reply(request *interfaces.Message, msgType string, payload interface{}) error {
+	return c.msgSender.SendMessageWithID(c.conn, request.ID, msgType, request.UUID, payload)
+}
+
+// replyError 发送错误响应, 客户端按错误代码区分失败原因
+// 错误的原始原因只记录在服务器日志中, 不发送给客户端
+func (c *Client) replyError(request *interfaces.Message, msgType string, err error) error {
+	if message.HasErrorDetail(err) {
+		c.server.logger.Warn("请求处理失败", interfaces.Fields{
+			"client": c.ID,
+			"id":     request.ID,
+			"type":   request.Type,
+			"error":  err,
+		})
+	}
+	return c.reply(request, msgType, message.NewErrorResponse(err))
 }
 
 // SyncRequest 同步请求结构体
@@ -54,106 +124,127 @@ type SyncResponse struct {
 // NewServer 创建新的网络服务器
 func NewServer(config *interfaces.Config, syncService interfaces.ServerSyncService, logger interfaces.Logger) *Server {
 	return &Server{
-		config:      config,
-		syncService: syncService,
-		clients:     make(map[string]*Client),
-		logger:      logger,
-		status:      "初始化",
+		config:        config,
+		syncService:   syncService,
+		clients:       make(map[string]*Client),
+		logger:        logger,
+		status:        "初始化",
+		tokens:        make(map[string]interfaces.AccessToken),
+		uploadLimiter: message.NewRateLimiter(0),
+		limits:        limitsFromConfig(config),
+		ipConns:       make(map[string]int),
+		httpPeers:     make(map[string]*httpPeer),
+		authTimeout:   defaultAuthTimeout,
 	}
 }
 
+// currentConfig 获取服务器当前使用的配置
+func (s *Server) currentConfig() *interfaces.Config {
+	s.configMu.RLock()
+	defer s.configMu.RUnlock()
+	return s.config
+}
+
 // Start 启动服务器
 func (s *Server) Start() error {
-	if s.running {
+	if s.running.Load() {
 		return errors.ErrNetworkServerStart
 	}
 
-	addr := fmt.Sprintf("%s:%d", s.config.Host, s.config.Port)
-	listener, err := net.Listen("tcp", addr)
-	if err != nil {
-		s.status = fmt.Sprintf("启动失败: %v", err)
-		return errors.NewError("NETWORK_START", "启动服务器失败", err)
+	s.ApplyConfig(s.currentConfig())
+
+	s.fingerprint = ""
+	if err := s.startListeners(); err != nil {
+		s.setStatus(fmt.Sprintf("启动失败: %v", err))
+		return err
 	}
 
-	s.listener = listener
-	s.running = true
-	s.status = "运行中"
+	s.draining.Store(false)
+	s.running.Store(true)
+	s.setStatus("运行中")
 
 	s.logger.Info("服务状态变更", interfaces.Fields{
-		"status":  "started",
-		"type":    "network",
-		"address": s.listener.Addr().String(),
+		"status":    "started",
+		"type":      "network",
+		"address":   s.mainAddr().String(),
+		"tls":       s.currentConfig().TLS.Enabled,
+		"listeners": s.listenersSummary(),
 	})
 
-	go s.acceptClients()
+	s.watchStop = make(chan struct{})
+	go s.watchManifest(s.watchStop)
+	s.startDiscovery(s.watchStop)
+
+	// HTTP传输的监听地址与TCP监听地址共用同步文件夹、访问令牌、证书和认证策略
+	s.statusMu.Lock()
+	s.httpServers = nil
+	for _, l := range s.listeners {
+		switch {
+		case l.listener == nil:
+		case l.config.HTTP:
+			s.serveHTTP(l)
+		default:
+			go s.acceptClients(l)
+		}
+	}
+	s.statusMu.Unlock()
 	return nil
 }
 
-// Stop 停止服务器
+// Stop 立即停止服务器, 进行中的传输会被中断
 func (s *Server) Stop() error {
-	if !s.running {
-		return nil
-	}
-	s.running = false
-
-	if s.listener != nil {
-		s.listener.Close()
-	}
-
-	s.clientsMux.Lock()
-	defer s.clientsMux.Unlock()
-
-	for _, client := range s.clients {
-		client.conn.Close()
-		delete(s.clients, client.ID)
-	}
-	s.status = "已停止"
+	return s.Shutdown(0)
+}
 
-	s.logger.Info("服务状态变更", interfaces.Fields{
-		"status": "stopped",
-		"type":   "network",
-	})
-	return nil
+// HandleClient 处理客户端连接, 按主监听地址的TLS和认证设置处理
+func (s *Server) HandleClient(conn net.Conn) {
+	s.serveClient(conn, nil)
 }
 
-// acceptClients 接受新的客户端连接
-func (s *Server) acceptClients() {
-	for s.running {
-		conn, err := s.listener.Accept()
-		if err != nil {
-			if ne, ok := err.(net.Error); ok && ne.Temporary() {
-				s.logger.Warn("网络操作", interfaces.Fields{
-					"action": "accept_temporary_error",
-					"error":  err,
-				})
-				continue
-			}
-			if s.running {
-				s.logger.Error("网络操作失败", interfaces.Fields{
-					"operation": "accept",
-					"error":     err,
-				})
-			}
-			return
-		}
-		go s.HandleClient(conn)
+// serveClient 处理监听地址上接受的客户端连接
+func (s *Server) serveClient(conn net.Conn, listener *serverListener) {
+	// TLS连接先完成握手, 握手失败的连接不进入客户端列表
+	if err := s.handshakeTLS(conn); err != nil {
+		s.logger.Warn("TLS握手失败", interfaces.Fields{
+			"addr":  conn.RemoteAddr(),
+			"error": err,
+		})
+		conn.Close()
+		return
 	}
-}
 
-// HandleClient 处理客户端连接
-func (s *Server) HandleClient(conn net.Conn) {
-	// 创建客户端实例
+	// 创建客户端实例, 连接关闭时取消所有进行中的请求
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
 	client := &Client{
-		ID:        fmt.Sprintf("client-%s", conn.RemoteAddr()),
-		conn:      conn,
-		server:    s,
-		msgSender: message.NewMessageSender(s.logger),
+		ID:            fmt.Sprintf("client-%s-%d", listener.name(), s.connSeq.Add(1)),
+		conn:          conn,
+		ip:            remoteIP(conn),
+		listener:      listener,
+		server:        s,
+		msgSender:     message.NewMessageSender(s.logger),
+		uploadLimiter: s.newClientLimiter(),
+		ctx:           ctx,
+		cancel:        cancel,
+		cancels:       make(map[uint32]context.CancelFunc),
+	}
+	client.touch()
+	// 同一文件的下载共用MD5缓存, 不必每次读取整个文件
+	client.msgSender.SetMD5Cache(&s.md5Cache)
+
+	// 超出连接数限制时告知客户端稍后重试
+	if ok, reason := s.admitClient(client); !ok {
+		s.rejectBusy(client, reason)
+		return
 	}
 
-	// 添加到客户端列表
-	s.clientsMux.Lock()
-	s.clients[client.ID] = client
-	s.clientsMux.Unlock()
+	// 请求之间不设读取超时, 连接存活由心跳判断
+	client.msgSender.SetReadTimeout(0)
+
+	// 并发请求的响应通过发送队列写入, 避免不同请求的帧交错损坏
+	client.msgSender.StartWriter(conn, outboundQueueSize)
+	// 文件数据先受单个客户端限速, 再受总带宽限速
+	client.msgSender.LimitWrite(conn, client.uploadLimiter, s.uploadLimiter)
 
 	s.logger.Info("客户端已连接", interfaces.Fields{
 		"id":   client.ID,
@@ -162,19 +253,39 @@ func (s *Server) HandleClient(conn net.Conn) {
 
 	defer func() {
 		conn.Close()
-		s.clientsMux.Lock()
-		delete(s.clients, client.ID)
-		s.clientsMux.Unlock()
+		stats := client.msgSender.Stats(conn)
+		client.msgSender.Release(conn)
+		s.removeClient(client)
 		s.logger.Info("客户端已断开", interfaces.Fields{
-			"id": client.ID,
+			"id":         client.ID,
+			"wire_bytes": stats.WireBytes,
+			"raw_bytes":  stats.RawBytes,
+			"ratio":      fmt.Sprintf("%.2f", stats.Ratio()),
 		})
 	}()
 
+	// 心跳检测, 连接关闭时停止
+	done := make(chan struct{})
+	defer close(done)
+	go s.monitorClient(client, done)
+	// 心跳只判断连接存活, 握手超时单独检查
+	authTimer := time.AfterFunc(s.authTimeout, func() { s.expireHandshake(client) })
+	defer authTimer.Stop()
+
+	// 旧版客户端使用换行分隔的JSON, 无法解析帧, 直接告知其升级
+	if legacy, err := client.msgSender.IsLegacyConn(conn); err != nil {
+		return
+	} else if legacy {
+		s.rejectLegacyClient(client)
+		return
+	}
+
 	// 处理客户端消息
 	for {
 		msg, err := client.msgSender.ReceiveMessage(conn)
 		if err != nil {
-			if err != io.EOF {
+			// 服务器关闭时连接由本端关闭, 不记录错误
+			if err != io.EOF && !s.draining.Load() {
 				s.logger.Error("读取消息失败", interfaces.Fields{
 					"client": client.ID,
 					"error":  err,
@@ -182,6 +293,7 @@ func (s *Server) HandleClient(conn net.Conn) {
 			}
 			return
 		}
+		client.touch()
 
 		// 记录接收到的消息，使用格式化的payload
 		s.logger.Debug("接收到客户端消息", interfaces.Fields{
@@ -191,75 +303,77 @@ func (s *Server) HandleClient(conn net.Conn) {
 			"payload": client.msgSender.FormatPayload(msg.Payload),
 		})
 
-		switch msg.Type {
-		case "init":
-			var initRequest struct {
-				UUID   string                       `json:"uuid"`
-				MD5Map map[string]map[string]string `json:"md5_map"`
+		// 握手完成前只接受认证和初始化消息
+		if !client.handshaked && !isHandshakeMessage(msg.Type) {
+			if !s.checkAuthenticated(client, msg.Type) {
+				return
 			}
-			if err := json.Unmarshal(msg.Payload, &initRequest); err != nil {
-				s.logger.Error("解析初始化请求失败", interfaces.Fields{
-					"error": err,
-					"uuid":  msg.UUID,
-				})
+			s.rejectClient(client, msg, &interfaces.HandshakeReject{
+				Reason:     message.RejectHandshake,
+				MinVersion: message.MinProtocolVersion,
+				MaxVersion: message.ProtocolVersion,
+			}, "请先完成初始化握手")
+			return
+		}
+
+		// 按访问令牌检查权限, 令牌失效时断开连接
+		if closeConn, err := s.authorize(client, msg); err != nil {
+			s.denyRequest(client, msg, err)
+			if closeConn {
 				return
 			}
+			continue
+		}
 
-			client.UUID = initRequest.UUID
+		switch msg.Type {
+		case message.MsgPing:
+			client.reply(msg, message.MsgPong, nil)
 
-			// 获取所有同步文件夹的MD5列表
-			serverMD5Map := make(map[string]map[string]string)
-			for _, folder := range s.config.SyncFolders {
-				files, err := s.syncService.GetLocalFilesWithMD5(folder.Path)
-				if err != nil {
-					s.logger.Error("获取服务端文件MD5失败", interfaces.Fields{
-						"folder": folder.Path,
-						"error":  err,
-					})
-					continue
-				}
-				serverMD5Map[folder.Path] = files
+		case message.MsgPong:
+			// 收到任何数据时已更新存活时间
+
+		case "auth_challenge":
+			if !s.handleAuthChallenge(client, msg) {
+				return
 			}
 
-			response := struct {
-				Success bool                         `json:"success"`
-				Message string                       `json:"message"`
-				Config  *interfaces.Config           `json:"config"`
-				MD5Map  map[string]map[string]string `json:"md5_map"`
-			}{
-				Success: true,
-				Message: "初始化成功",
-				Config:  s.config,
-				MD5Map:  serverMD5Map,
+		case "auth_response":
+			if !s.handleAuthResponse(client, msg) {
+				return
 			}
 
-			if err := client.msgSender.SendMessage(conn, "init_response", msg.UUID, response); err != nil {
-				s.logger.Error("发送初始化响应失败", interfaces.Fields{
-					"error": err,
-					"uuid":  msg.UUID,
-				})
+		case "init":
+			// 未认证的连接直接关闭, 不返回任何初始化响应
+			if !s.checkAuthenticated(client, msg.Type) {
+				return
+			}
+			if !s.handleInit(client, msg) {
 				return
 			}
 
 		case "sync_request":
 			var syncRequest interfaces.SyncRequest
 			if err := json.Unmarshal(msg.Payload, &syncRequest); err != nil {
-				client.msgSender.SendMessage(conn, "sync_response", msg.UUID, map[string]interface{}{
-					"success": false,
-					"message": fmt.Sprintf("解析同步请求失败: %v", err),
-				})
+				client.replyError(msg, "sync_response", errors.NewError(errors.CodeNetworkInvalidData, "解析同步请求失败", err))
+				continue
+			}
+
+			// 同步请求的路径同样只能位于同步文件夹中
+			if _, err := s.sandboxRequest(client, msg.Type, syncRequest.Path, s.currentConfig().SyncFolders); err != nil {
+				client.replyError(msg, "sync_response", err)
 				continue
 			}
 
 			if err := s.syncService.HandleSyncRequest(&syncRequest); err != nil {
-				client.msgSender.SendMessage(conn, "sync_response", msg.UUID, map[string]interface{}{
-					"success": false,
-					"message": err.Error(),
+				s.logger.Error("处理同步请求失败", interfaces.Fields{
+					"error": err,
+					"uuid":  msg.UUID,
 				})
+				client.replyError(msg, "sync_response", localError(err, errors.CodeServiceSync, "处理同步请求失败"))
 				continue
 			}
 
-			client.msgSender.SendMessage(conn, "sync_response", msg.UUID, map[string]interface{}{
+			client.reply(msg, "sync_response", map[string]interface{}{
 				"success": true,
 				"message": "同步成功",
 			})
@@ -273,6 +387,10 @@ func (s *Server) HandleClient(conn net.Conn) {
 				})
 				continue
 			}
+			if _, err := s.sandboxRequest(client, msg.Type, syncRequest.Path, s.currentConfig().SyncFolders); err != nil {
+				client.replyError(msg, "data", err)
+				continue
+			}
 
 			// 处理其他同步请求
 			if err := s.syncService.HandleSyncRequest(&syncRequest); err != nil {
@@ -280,132 +398,119 @@ func (s *Server) HandleClient(conn net.Conn) {
 					"error": err,
 					"uuid":  msg.UUID,
 				})
-				client.msgSender.SendMessage(conn, "data", msg.UUID, map[string]interface{}{
-					"success": false,
-					"message": err.Error(),
-				})
+				client.replyError(msg, "data", localError(err, errors.CodeServiceSync, "处理同步请求失败"))
 				continue
 			}
 
-			client.msgSender.SendMessage(conn, "data", msg.UUID, map[string]interface{}{
+			client.reply(msg, "data", map[string]interface{}{
 				"success": true,
 				"message": "同步成功",
 			})
 
+		case message.MsgCancelRequest:
+			s.handleCancelRequest(client, msg)
+
 		case "file_request":
-			go func() {
-				var syncRequest interfaces.SyncRequest
-				if err := json.Unmarshal(msg.Payload, &syncRequest); err != nil {
-					s.logger.Error("解析同步请求失败", interfaces.Fields{
+			s.runRequest(client, msg, func(ctx context.Context) {
+				var fileRequest interfaces.FileTransferRequest
+				if err := json.Unmarshal(msg.Payload, &fileRequest); err != nil {
+					s.logger.Error("解析文件请求失败", interfaces.Fields{
 						"error": err,
 						"uuid":  msg.UUID,
 					})
-					client.msgSender.SendMessage(conn, "data", msg.UUID, map[string]interface{}{
-						"success": false,
-						"message": fmt.Sprintf("解析同步请求失败: %v", err),
-					})
+					client.replyError(msg, "data", errors.NewError(errors.CodeNetworkInvalidData, "解析文件请求失败", err))
 					return
 				}
 
-				// 处理文件下载请求
-				filePath := filepath.Join(s.config.SyncDir, syncRequest.Path)
+				// 处理文件下载请求, 只提供同步文件夹中的文件
+				sp, err := s.sandboxRequest(client, msg.Type, fileRequest.FilePath, s.currentConfig().SyncFolders)
+				if err != nil {
+					client.replyError(msg, "data", err)
+					return
+				}
+				filePath := sp.local
 				s.logger.Debug("处理文件下载请求", interfaces.Fields{
 					"file":         filePath,
-					"request_path": syncRequest.Path,
-					"server_path":  filePath,
+					"request_path": fileRequest.FilePath,
+					"chunk_size":   fileRequest.ChunkSize,
 				})
 
 				// 检查文件是否存在
 				fileInfo, err := os.Stat(filePath)
 				if err != nil {
-					s.logger.Error("文件不存在", interfaces.Fields{
-						"file":  filePath,
-						"error": err,
-					})
-					client.msgSender.SendMessage(conn, "data", msg.UUID, map[string]interface{}{
-						"success": false,
-						"message": fmt.Sprintf("文件不存在: %v", err),
-					})
-					return
-				}
-
-				// 读取文件内容并计算MD5
-				fileContent, err := os.ReadFile(filePath)
-				if err != nil {
-					s.logger.Error("读取文件失败", interfaces.Fields{
+					s.logger.Error("获取文件信息失败", interfaces.Fields{
 						"file":  filePath,
 						"error": err,
 					})
-					client.msgSender.SendMessage(conn, "data", msg.UUID, map[string]interface{}{
-						"success": false,
-						"message": fmt.Sprintf("读取文件失败: %v", err),
-					})
+					client.replyError(msg, "data", localError(err, errors.CodeStorageLoad, "获取文件信息失败"))
 					return
 				}
 
-				hash := md5.New()
-				hash.Write(fileContent)
-				md5sum := hex.EncodeToString(hash.Sum(nil))
-
-				// 统一使用斜杠作为路径分隔符
-				normalizedPath := filepath.ToSlash(syncRequest.Path)
-
-				// 发送文件信息
-				client.msgSender.SendMessage(conn, "file", msg.UUID, map[string]interface{}{
-					"name": filepath.Base(normalizedPath),
-					"size": fileInfo.Size(),
-					"md5":  md5sum,
-					"path": normalizedPath,
-				})
-
-				// 发送文件内容
-				chunk := struct {
-					Data []byte `json:"data"`
-				}{
-					Data: fileContent,
-				}
-				if err := client.msgSender.SendMessage(conn, "file_data", msg.UUID, chunk); err != nil {
+				// 分块流式发送文件
+				if err := client.msgSender.SendFileChunked(ctx, conn, msg.ID, msg.UUID, filePath, &fileRequest, nil); err != nil {
+					// 客户端已取消或连接已关闭, 不再回复
+					if ctx.Err() != nil {
+						s.logger.Debug("文件发送已取消", interfaces.Fields{
+							"file": filePath,
+						})
+						return
+					}
 					s.logger.Error("发送文件数据失败", interfaces.Fields{
 						"file":  filePath,
 						"error": err,
 					})
-					client.msgSender.SendMessage(conn, "data", msg.UUID, map[string]interface{}{
-						"success": false,
-						"message": fmt.Sprintf("发送文件数据失败: %v", err),
-					})
+					client.replyError(msg, "data", localError(err, errors.CodeInternal, "发送文件数据失败"))
 					return
 				}
 
 				s.logger.Debug("文件发送成功", interfaces.Fields{
 					"file": filePath,
-					"md5":  md5sum,
 					"size": client.msgSender.FormatFileSize(fileInfo.Size()),
 				})
-			}()
+			})
+
+		case message.MsgManifestRequest:
+			s.runRequest(client, msg, func(ctx context.Context) {
+				s.handleManifestRequest(ctx, client, msg)
+			})
 
 		case "list_request":
-			go func() {
+			s.runRequest(client, msg, func(ctx context.Context) {
 				var syncRequest interfaces.SyncRequest
 				if err := json.Unmarshal(msg.Payload, &syncRequest); err != nil {
 					s.logger.Error("解析同步请求失败", interfaces.Fields{
 						"error": err,
 						"uuid":  msg.UUID,
 					})
+					client.replyError(msg, "data", errors.NewError(errors.CodeNetworkInvalidData, "解析同步请求失败", err))
 					return
 				}
 
-				// 获取同步目录
-				syncDir := filepath.Join(s.config.SyncDir, syncRequest.Path)
+				// 获取同步目录, 只列出同步文件夹中的文件
+				sp, err := s.sandboxRequest(client, msg.Type, syncRequest.Path, s.currentConfig().SyncFolders)
+				if err != nil {
+					client.replyError(msg, "data", err)
+					return
+				}
+				syncDir := sp.local
 				var files []string
 				var dirs []string
 
-				err := filepath.Walk(syncDir, func(path string, info os.FileInfo, err error) error {
+				err = filepath.Walk(syncDir, func(path string, info os.FileInfo, err error) error {
 					if err != nil {
 						if os.IsNotExist(err) {
 							return nil
 						}
 						return err
 					}
+					if err := ctx.Err(); err != nil {
+						return err
+					}
+
+					// 不列出指向同步文件夹之外的符号链接
+					if info.Mode()&os.ModeSymlink != 0 && message.WithinDir(sp.root, path) != nil {
+						return nil
+					}
 
 					// 获取相对路径
 					relPath, err := filepath.Rel(syncDir, path)
@@ -434,14 +539,14 @@ func (s *Server) HandleClient(conn net.Conn) {
 					return nil
 				})
 
+				if ctx.Err() != nil {
+					return
+				}
 				if err != nil {
 					s.logger.Error("获取文件列表失败", interfaces.Fields{
 						"error": err,
 					})
-					client.msgSender.SendMessage(conn, "data", msg.UUID, map[string]interface{}{
-						"success": false,
-						"message": fmt.Sprintf("获取文件列表失败: %v", err),
-					})
+					client.replyError(msg, "data", localError(err, errors.CodeStorageLoad, "获取文件列表失败"))
 					return
 				}
 
@@ -453,26 +558,32 @@ func (s *Server) HandleClient(conn net.Conn) {
 					"dirs":       dirs,
 				})
 
-				client.msgSender.SendMessage(conn, "data", msg.UUID, map[string]interface{}{
+				client.reply(msg, "data", map[string]interface{}{
 					"success": true,
 					"files":   files,
 					"dirs":    dirs,
 				})
-			}()
+			})
 
 		case "delete_request":
-			go func() {
+			s.runRequest(client, msg, func(ctx context.Context) {
 				var syncRequest interfaces.SyncRequest
 				if err := json.Unmarshal(msg.Payload, &syncRequest); err != nil {
 					s.logger.Error("解析同步请求失败", interfaces.Fields{
 						"error": err,
 						"uuid":  msg.UUID,
 					})
+					client.replyError(msg, "data", errors.NewError(errors.CodeNetworkInvalidData, "解析同步请求失败", err))
 					return
 				}
 
-				// 处理文件删除请求
-				filePath := filepath.Join(s.config.SyncDir, syncRequest.Path)
+				// 处理文件删除请求, 只删除允许删除的同步文件夹中的文件
+				sp, err := s.sandboxDelete(client, msg.Type, syncRequest.Path)
+				if err != nil {
+					client.replyError(msg, "data", err)
+					return
+				}
+				filePath := sp.local
 				s.logger.Debug("处理文件删除请求", interfaces.Fields{
 					"file": filePath,
 				})
@@ -483,10 +594,7 @@ func (s *Server) HandleClient(conn net.Conn) {
 							"file":  filePath,
 							"error": err,
 						})
-						client.msgSender.SendMessage(conn, "data", msg.UUID, map[string]interface{}{
-							"success": false,
-							"message": fmt.Sprintf("删除文件失败: %v", err),
-						})
+						client.replyError(msg, "data", localError(err, errors.CodeStorageDelete, "删除文件失败"))
 						return
 					}
 				}
@@ -495,11 +603,11 @@ func (s *Server) HandleClient(conn net.Conn) {
 					"file": filePath,
 				})
 
-				client.msgSender.SendMessage(conn, "data", msg.UUID, map[string]interface{}{
+				client.reply(msg, "data", map[string]interface{}{
 					"success": true,
 					"message": "文件删除成功",
 				})
-			}()
+			})
 
 		default:
 			s.logger.Error("未知的消息类型", interfaces.Fields{
@@ -509,12 +617,19 @@ func (s *Server) HandleClient(conn net.Conn) {
 	}
 }
 
-// GetStatus 获取服务器状态
+// GetStatus 获取服务器状态, 启动过的服务器附带每个监听地址的状态
 func (s *Server) GetStatus() string {
-	return s.status
+	s.statusMu.RLock()
+	status := s.status
+	s.statusMu.RUnlock()
+
+	if summary := s.listenersSummary(); summary != "" {
+		status += " (" + summary + ")"
+	}
+	return status
 }
 
 // IsRunning 检查服务器是否运行中
 func (s *Server) IsRunning() bool {
-	return s.running
+	return s.running.Load()
 }
@@ -0,0 +1,145 @@
+package network
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/errors"
+	"synctools/codes/pkg/network/message"
+)
+
+// 安全事件类型
+const (
+	securityPathRejected   = "path_rejected"   // 请求路径不在同步文件夹中
+	securityDeleteRejected = "delete_rejected" // 同步文件夹不允许删除文件
+)
+
+// sandboxPath 客户端请求路径的解析结果
+type sandboxPath struct {
+	local  string                 // 服务器上的本地路径
+	root   string                 // 所属同步文件夹的本地路径
+	folder *interfaces.SyncFolder // 所属的同步文件夹
+}
+
+// sandboxRequest 将客户端请求的路径解析为同步文件夹中的本地路径, 拒绝时记录安全事件
+// folders为客户端可以访问的同步文件夹, 返回给客户端的错误不包含服务器上的本地路径
+func (s *Server) sandboxRequest(client *Client, msgType, requestPath string, folders []interfaces.SyncFolder) (*sandboxPath, error) {
+	sp, err := resolveSyncPath(s.currentConfig().SyncDir, folders, requestPath)
+	if err != nil {
+		s.logSecurityEvent(client, securityPathRejected, msgType, requestPath, err)
+		return nil, errors.NewError(err.Code, err.Message, nil)
+	}
+	return sp, nil
+}
+
+// sandboxDelete 解析删除请求的路径, 同步文件夹不允许删除时拒绝并记录安全事件
+func (s *Server) sandboxDelete(client *Client, msgType, requestPath string) (*sandboxPath, error) {
+	sp, err := s.sandboxRequest(client, msgType, requestPath, s.currentConfig().SyncFolders)
+	if err != nil {
+		return nil, err
+	}
+	if !sp.folder.AllowDelete {
+		err := errors.NewError(errors.CodeForbidden, fmt.Sprintf("同步文件夹不允许删除文件: %s", sp.folder.Path), nil)
+		s.logSecurityEvent(client, securityDeleteRejected, msgType, requestPath, err)
+		return nil, err
+	}
+	return sp, nil
+}
+
+// localError 将服务器本地文件操作的错误转换为返回给客户端的错误
+// 本地错误中包含服务器上的路径, 只返回错误代码和固定的说明, 详细错误由调用方记录在服务器日志中
+func localError(err error, code, msg string) error {
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		return errors.NewError(errors.CodeStorageNotFound, "文件不存在", nil)
+	case errors.Is(err, os.ErrPermission):
+		return errors.NewError(errors.CodeForbidden, "没有权限访问文件", nil)
+	}
+	return errors.NewError(code, msg, nil)
+}
+
+// logSecurityEvent 记录被拒绝的请求
+func (s *Server) logSecurityEvent(client *Client, event, msgType, requestPath string, err error) {
+	s.logger.Warn("安全事件", interfaces.Fields{
+		"event":  event,
+		"client": client.ID,
+		"ip":     client.ip,
+		"uuid":   client.UUID,
+		"type":   msgType,
+		"path":   requestPath,
+		"reason": err.Error(),
+	})
+}
+
+// resolveSyncPath 将请求路径解析为同步文件夹中的本地路径
+// 只接受位于同步文件夹中的相对路径, 拒绝绝对路径、包含..的路径和通过符号链接跳出同步文件夹的路径
+// 请求路径可以使用/或\分隔
+func resolveSyncPath(syncDir string, folders []interfaces.SyncFolder, requestPath string) (*sandboxPath, *errors.Error) {
+	rel, ok := cleanRequestPath(strings.ReplaceAll(requestPath, "\\", "/"))
+	if !ok {
+		return nil, errors.NewError(errors.CodeForbidden, fmt.Sprintf("无效的请求路径: %s", requestPath), nil)
+	}
+
+	folder := matchSyncFolder(folders, rel)
+	if folder == nil {
+		return nil, errors.NewError(errors.CodeForbidden, fmt.Sprintf("请求路径不在同步文件夹中: %s", requestPath), nil)
+	}
+
+	root := filepath.Join(syncDir, filepath.FromSlash(path.Clean(filepath.ToSlash(folder.Path))))
+	local := filepath.Join(syncDir, filepath.FromSlash(rel))
+	if err := message.WithinDir(root, local); err != nil {
+		return nil, errors.NewError(errors.CodeForbidden, fmt.Sprintf("请求路径跳出同步文件夹: %s", requestPath), err)
+	}
+	return &sandboxPath{local: local, root: root, folder: folder}, nil
+}
+
+// cleanRequestPath 规范化请求的文件路径, 拒绝绝对路径和跳出同步目录的路径
+func cleanRequestPath(requestPath string) (string, bool) {
+	if requestPath == "" || strings.ContainsAny(requestPath, "\\:\x00") {
+		return "", false
+	}
+	for _, part := range strings.Split(requestPath, "/") {
+		if part == ".." {
+			return "", false
+		}
+	}
+
+	requestPath = path.Clean(requestPath)
+	if path.IsAbs(requestPath) || requestPath == "." {
+		return "", false
+	}
+	return requestPath, true
+}
+
+// matchSyncFolder 查找路径所属的同步文件夹, 文件夹嵌套时取最深的一个
+// 所属的同步文件夹未启用时返回nil, 未启用的子文件夹不能通过上层文件夹访问
+func matchSyncFolder(folders []interfaces.SyncFolder, requestPath string) *interfaces.SyncFolder {
+	var match *interfaces.SyncFolder
+	for i := range folders {
+		if !pathWithin(requestPath, folders[i].Path) {
+			continue
+		}
+		if match == nil || len(path.Clean(filepath.ToSlash(folders[i].Path))) > len(path.Clean(filepath.ToSlash(match.Path))) {
+			match = &folders[i]
+		}
+	}
+	if match != nil && !match.IsEnabled {
+		return nil
+	}
+	return match
+}
+
+// enabledFolders 过滤出已启用的同步文件夹
+func enabledFolders(folders []interfaces.SyncFolder) []interfaces.SyncFolder {
+	enabled := make([]interfaces.SyncFolder, 0, len(folders))
+	for _, folder := range folders {
+		if folder.IsEnabled {
+			enabled = append(enabled, folder)
+		}
+	}
+	return enabled
+}
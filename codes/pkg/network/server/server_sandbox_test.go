@@ -0,0 +1,103 @@
+package network
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/internal/testutil"
+	"synctools/codes/pkg/errors"
+)
+
+// testSyncService 每个同步文件夹返回一个固定文件的服务端同步服务
+type testSyncService struct {
+	interfaces.ServerSyncService
+}
+
+func (testSyncService) GetLocalFilesWithMD5(ctx context.Context, dir string) (map[string]string, error) {
+	return map[string]string{"a.txt": "0cc175b9c0f1b6a831c399e269772661"}, nil
+}
+
+// TestDisabledSyncFolder 未启用的同步文件夹不能访问, 也不出现在清单中
+func TestDisabledSyncFolder(t *testing.T) {
+	folders := []interfaces.SyncFolder{
+		{Path: "mods", IsEnabled: true},
+		{Path: "mods/private", IsEnabled: false},
+		{Path: "config", IsEnabled: false},
+	}
+
+	tests := []struct {
+		path string
+		ok   bool
+	}{
+		{"mods/a.jar", true},
+		{"mods/private/a.jar", false},
+		{"mods/private", false},
+		{"config/a.cfg", false},
+		{"config", false},
+	}
+	for _, tt := range tests {
+		_, err := resolveSyncPath(t.TempDir(), folders, tt.path)
+		if tt.ok && err != nil {
+			t.Errorf("%s: 期望允许访问, 实际 %v", tt.path, err)
+		}
+		if !tt.ok && !errors.Is(err, errors.ErrForbidden) {
+			t.Errorf("%s: 期望拒绝访问, 实际 %v", tt.path, err)
+		}
+	}
+
+	s := NewServer(&interfaces.Config{SyncDir: t.TempDir(), SyncFolders: folders}, testSyncService{}, testutil.NewNopLogger())
+	config, md5Map, err := s.clientManifest(context.Background(), &Client{ID: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(config.SyncFolders) != 1 || config.SyncFolders[0].Path != "mods" {
+		t.Errorf("清单中的同步文件夹错误: %v", config.SyncFolders)
+	}
+	if _, ok := md5Map["config"]; ok || len(md5Map) != 1 {
+		t.Errorf("清单中的文件列表错误: %v", md5Map)
+	}
+}
+
+// TestBaselineConfigServed 旧版本保存的配置中同步文件夹全部为未启用, 升级后仍然提供这些同步文件夹
+func TestBaselineConfigServed(t *testing.T) {
+	data, err := os.ReadFile(filepath.Join("testdata", "baseline_config.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &interfaces.Config{}
+	if err := json.Unmarshal(data, config); err != nil {
+		t.Fatal(err)
+	}
+	config.SyncDir = t.TempDir()
+
+	s := NewServer(config, testSyncService{}, testutil.NewNopLogger())
+	for _, requestPath := range []string{"mods/a.jar", "config/a.cfg"} {
+		if _, err := resolveSyncPath(config.SyncDir, config.SyncFolders, requestPath); err != nil {
+			t.Errorf("%s: 期望允许访问, 实际 %v", requestPath, err)
+		}
+	}
+	manifest, md5Map, err := s.clientManifest(context.Background(), &Client{ID: "test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.SyncFolders) != 2 || len(md5Map) != 2 {
+		t.Errorf("清单中的同步文件夹错误: %v", manifest.SyncFolders)
+	}
+}
+
+// TestSyncFolderEnabled 新配置按 is_enabled 字段启用, 没有该字段的同步文件夹视为启用
+func TestSyncFolderEnabled(t *testing.T) {
+	var config interfaces.Config
+	data := `{"sync_folders": [{"path": "mods", "is_enabled": true}, {"path": "config", "is_enabled": false}, {"path": "scripts"}]}`
+	if err := json.Unmarshal([]byte(data), &config); err != nil {
+		t.Fatal(err)
+	}
+	folders := config.SyncFolders
+	if !folders[0].IsEnabled || folders[1].IsEnabled || !folders[2].IsEnabled {
+		t.Errorf("同步文件夹启用状态错误: %+v", folders)
+	}
+}
@@ -0,0 +1,102 @@
+package network
+
+import (
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/network/message"
+)
+
+// shutdownPollInterval 等待进行中请求完成时的检查间隔
+const shutdownPollInterval = 100 * time.Millisecond
+
+// Shutdown 优雅关闭服务器
+// 停止接受新连接并通知已连接的客户端, 在timeout内等待进行中的传输完成后再关闭所有连接
+// 关闭期间收到的新请求返回繁忙响应, timeout为0时立即关闭
+func (s *Server) Shutdown(timeout time.Duration) error {
+	if !s.running.CompareAndSwap(true, false) {
+		return nil
+	}
+	s.draining.Store(true)
+	s.setStatus("正在关闭")
+
+	s.closeListeners()
+	close(s.watchStop)
+
+	s.logger.Info("服务状态变更", interfaces.Fields{
+		"status":  "stopping",
+		"type":    "network",
+		"timeout": timeout.String(),
+	})
+
+	deadline := time.Now().Add(timeout)
+	httpDone := s.shutdownHTTP(deadline)
+	if timeout > 0 {
+		s.notifyShutdown(timeout)
+		if remaining := s.waitRequests(deadline); remaining > 0 {
+			s.logger.Warn("等待传输完成超时, 强制关闭", interfaces.Fields{
+				"requests": remaining,
+			})
+		}
+	}
+	<-httpDone
+
+	s.clientsMux.Lock()
+	for _, client := range s.clients {
+		client.conn.Close()
+		delete(s.clients, client.ID)
+	}
+	s.clientsMux.Unlock()
+	s.setStatus("已停止")
+
+	s.logger.Info("服务状态变更", interfaces.Fields{
+		"status": "stopped",
+		"type":   "network",
+	})
+	return nil
+}
+
+// notifyShutdown 通知所有客户端服务器正在关闭
+// 每个客户端单独发送, 不会因个别客户端写入缓慢而延误关闭
+func (s *Server) notifyShutdown(timeout time.Duration) {
+	notice := message.NewShutdownNotice(timeout)
+
+	s.clientsMux.RLock()
+	defer s.clientsMux.RUnlock()
+	for _, client := range s.clients {
+		go client.msgSender.SendMessageWithID(client.conn, 0, message.MsgShutdown, "", notice)
+	}
+}
+
+// waitRequests 等待所有客户端的请求处理完成, 返回截止时间到达时仍未完成的请求数
+func (s *Server) waitRequests(deadline time.Time) int {
+	ticker := time.NewTicker(shutdownPollInterval)
+	defer ticker.Stop()
+
+	for {
+		remaining := s.activeRequests()
+		if remaining == 0 || !time.Now().Before(deadline) {
+			return remaining
+		}
+		<-ticker.C
+	}
+}
+
+// activeRequests 统计所有客户端处理中和排队中的请求数
+func (s *Server) activeRequests() int {
+	s.clientsMux.RLock()
+	defer s.clientsMux.RUnlock()
+
+	total := 0
+	for _, client := range s.clients {
+		total += int(client.requests.pending.Load())
+	}
+	return total
+}
+
+// setStatus 设置服务器状态
+func (s *Server) setStatus(status string) {
+	s.statusMu.Lock()
+	defer s.statusMu.Unlock()
+	s.status = status
+}
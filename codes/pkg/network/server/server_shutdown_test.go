@@ -0,0 +1,109 @@
+package network
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/internal/testutil"
+	"synctools/codes/pkg/errors"
+	"synctools/codes/pkg/network/message"
+)
+
+// TestShutdownDrain 关闭时通知客户端并等待进行中的请求完成, 关闭期间的新请求收到繁忙响应
+func TestShutdownDrain(t *testing.T) {
+	tests := []struct {
+		name     string
+		work     time.Duration // 进行中的请求的处理时间
+		timeout  time.Duration
+		finished bool // 关闭返回时请求是否已完成
+	}{
+		{"drained", 300 * time.Millisecond, 5 * time.Second, true},
+		{"timeout", 5 * time.Second, 300 * time.Millisecond, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewServer(&interfaces.Config{Host: "127.0.0.1"}, testSyncService{}, testutil.NewNopLogger())
+			if err := s.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer s.Stop()
+
+			conn, err := net.Dial("tcp", s.mainAddr().String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			client := waitClient(t, s)
+
+			var finished atomic.Bool
+			s.runRequest(client, &interfaces.Message{ID: 1, Type: "file_request"}, func(ctx context.Context) {
+				select {
+				case <-time.After(tt.work):
+					finished.Store(true)
+				case <-ctx.Done():
+				}
+			})
+
+			shutdown := make(chan error, 1)
+			go func() { shutdown <- s.Shutdown(tt.timeout) }()
+
+			receiver := message.NewMessageSender(testutil.NewNopLogger())
+			msg, err := receiver.ReceiveMessage(conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if notice := message.ParseBusy(msg); msg.Type != message.MsgShutdown || !errors.Is(notice, errors.ErrServiceStop) {
+				t.Fatalf("期望关闭通知, 实际 %s: %v", msg.Type, notice)
+			}
+
+			// 关闭期间的新请求不再处理
+			s.runRequest(client, &interfaces.Message{ID: 2, Type: "file_request"}, func(context.Context) {
+				t.Error("关闭期间不应处理新请求")
+			})
+			msg, err = receiver.ReceiveMessage(conn)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if busy := message.ParseBusy(msg); msg.ID != 2 || !errors.Is(busy, errors.ErrServiceBusy) {
+				t.Errorf("期望繁忙响应, 实际 id %d: %v", msg.ID, busy)
+			}
+
+			select {
+			case err := <-shutdown:
+				if err != nil {
+					t.Fatal(err)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("关闭未在超时后返回")
+			}
+			if finished.Load() != tt.finished {
+				t.Errorf("关闭返回时请求完成状态 %v, 期望 %v", finished.Load(), tt.finished)
+			}
+			s.clientsMux.RLock()
+			remaining := len(s.clients)
+			s.clientsMux.RUnlock()
+			if remaining != 0 {
+				t.Errorf("关闭后仍有 %d 个连接", remaining)
+			}
+		})
+	}
+}
+
+// waitClient 等待服务器登记唯一的客户端连接
+func waitClient(t *testing.T, s *Server) *Client {
+	t.Helper()
+	var client *Client
+	waitFor(t, func() bool {
+		s.clientsMux.RLock()
+		defer s.clientsMux.RUnlock()
+		for _, c := range s.clients {
+			client = c
+		}
+		return client != nil
+	})
+	return client
+}
@@ -0,0 +1,66 @@
+package network
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"path/filepath"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/network/security"
+)
+
+// tlsHandshakeTimeout TLS握手超时时间
+const tlsHandshakeTimeout = 10 * time.Second
+
+// SetCertDir 设置自动生成证书的保存目录
+func (s *Server) SetCertDir(dir string) {
+	s.certDir = dir
+}
+
+// loadTLSConfig 加载TLS配置, 未指定证书时使用证书目录中的自签名证书
+func (s *Server) loadTLSConfig() (*tls.Config, error) {
+	config := s.currentConfig()
+	certFile := config.TLS.CertFile
+	keyFile := config.TLS.KeyFile
+	if certFile == "" || keyFile == "" {
+		if s.certDir == "" {
+			return nil, fmt.Errorf("未指定证书文件和证书目录")
+		}
+		certFile = filepath.Join(s.certDir, security.DefaultCertFile)
+		keyFile = filepath.Join(s.certDir, security.DefaultKeyFile)
+	}
+
+	cert, fingerprint, err := security.LoadOrCreateCertificate(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	s.fingerprint = fingerprint
+	s.logger.Info("已加载TLS证书", interfaces.Fields{
+		"cert":        certFile,
+		"fingerprint": fingerprint,
+	})
+	return security.ServerTLSConfig(cert), nil
+}
+
+// Fingerprint 获取服务器证书指纹, 未启用TLS时为空
+func (s *Server) Fingerprint() string {
+	return s.fingerprint
+}
+
+// handshakeTLS 在处理消息前完成TLS握手, 非TLS连接直接返回
+func (s *Server) handshakeTLS(conn net.Conn) error {
+	tlsConn, ok := conn.(*tls.Conn)
+	if !ok {
+		return nil
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(tlsHandshakeTimeout)); err != nil {
+		return err
+	}
+	defer conn.SetDeadline(time.Time{})
+
+	return tlsConn.Handshake()
+}
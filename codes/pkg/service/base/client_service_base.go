@@ -16,6 +16,9 @@ package base
 
 import (
 	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"os"
@@ -23,32 +26,52 @@ import (
 	"strings"
 
 	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/errors"
 	"synctools/codes/pkg/network/client"
+	"synctools/codes/pkg/network/message"
+)
+
+const (
+	// maxPackEntries 压缩包中条目数量的上限
+	maxPackEntries = 100000
+	// maxPackRatio 解压后总大小与压缩包大小之比的上限, 也是单个条目压缩率的上限
+	// 正常文件的压缩率远低于该值, 只有重复数据构造的压缩炸弹才会超出
+	maxPackRatio = 100
+	// packRatioMinSize 解压后小于该大小的条目不检查压缩率, 这些条目仍计入总大小
+	packRatioMinSize = 1 << 20
 )
 
 // ClientSyncBase 客户端同步基础服务
 type ClientSyncBase struct {
 	*BaseSyncService
-	networkClient *client.NetworkClient
+	networkClient client.Transport
 }
 
 // NewClientSyncBase 创建客户端同步基础服务
-func NewClientSyncBase(base *BaseSyncService, networkClient *client.NetworkClient) *ClientSyncBase {
+func NewClientSyncBase(base *BaseSyncService, networkClient client.Transport) *ClientSyncBase {
 	return &ClientSyncBase{
 		BaseSyncService: base,
 		networkClient:   networkClient,
 	}
 }
 
+// SetTransport 切换下载文件使用的传输, 在连接服务器时按地址选择
+func (s *ClientSyncBase) SetTransport(transport client.Transport) {
+	s.networkClient = transport
+}
+
 // DownloadFile 从服务器下载文件
-func (s *ClientSyncBase) DownloadFile(req *interfaces.SyncRequest, destPath string, sourcePath string, mode interfaces.SyncMode) error {
-	// 发送下载请求
-	if err := s.networkClient.SendData("file_request", req); err != nil {
-		return fmt.Errorf("发送下载请求失败: %v", err)
+// 上下文取消时中止下载和解压, 已下载的临时数据保留以便续传, 目标文件保持原样或已完整更新
+// 服务器提供的路径和重定向配置决定写入位置, 写入位置不在同步目录sourcePath中时拒绝下载
+func (s *ClientSyncBase) DownloadFile(ctx context.Context, req *interfaces.SyncRequest, destPath string, sourcePath string, mode interfaces.SyncMode) error {
+	// 下载请求, 由服务端分块流式返回文件内容
+	fileRequest := &interfaces.FileTransferRequest{
+		FilePath:  req.Path,
+		ChunkSize: message.DefaultChunkSize,
 	}
 
-	// 接收文件
-	progress := make(chan interfaces.Progress, 1)
+	// 接收文件, 每个分块都会报告一次进度
+	progress := make(chan interfaces.Progress, 16)
 	defer close(progress)
 
 	go func() {
@@ -63,16 +86,17 @@ func (s *ClientSyncBase) DownloadFile(req *interfaces.SyncRequest, destPath stri
 			"path": sourcePath,
 		})
 
-		// 创建临时目录
-		tempDir, err := os.MkdirTemp("", "synctools_pack_*")
+		// 使用固定的临时目录, 下载中断后重启客户端仍可续传
+		tempDir, err := packTempDir(s.GetCurrentConfig().UUID)
 		if err != nil {
+			return errors.NewError(errors.CodeInvalidConfig, "客户端UUID无效", err)
+		}
+		if err := os.MkdirAll(tempDir, 0755); err != nil {
 			return fmt.Errorf("创建临时目录失败: %v", err)
 		}
-		defer os.RemoveAll(tempDir)
 
-		// 构建临时文件路径
-		fileName := filepath.Base(req.Path)
-		tempFile := filepath.Join(tempDir, fileName)
+		// 构建临时文件路径, 不同文件夹下同名的压缩包使用不同的临时文件
+		tempFile := filepath.Join(tempDir, packTempName(req.Path))
 
 		s.Logger.Debug("准备下载文件", interfaces.Fields{
 			"temp_dir":  tempDir,
@@ -81,12 +105,16 @@ func (s *ClientSyncBase) DownloadFile(req *interfaces.SyncRequest, destPath stri
 		})
 
 		// 先将压缩包下载到临时目录
-		if err := s.networkClient.ReceiveFile(tempFile, progress); err != nil {
-			return fmt.Errorf("接收压缩包失败: %v", err)
+		if err := s.networkClient.RequestFile(ctx, fileRequest, tempFile, progress); err != nil {
+			return fmt.Errorf("接收压缩包失败: %w", err)
 		}
+		defer os.Remove(tempFile)
 
 		// 获取目标目录（移除.zip后缀）
 		targetDir := filepath.Dir(destPath)
+		if err := message.WithinDir(sourcePath, targetDir); err != nil {
+			return s.rejectWritePath(req.Path, err)
+		}
 
 		s.Logger.Debug("解压文件信息", interfaces.Fields{
 			"temp_dir":   tempDir,
@@ -97,8 +125,8 @@ func (s *ClientSyncBase) DownloadFile(req *interfaces.SyncRequest, destPath stri
 		})
 
 		// 解压文件
-		if err := s.unpackFile(tempFile, targetDir); err != nil {
-			return fmt.Errorf("解压文件失败: %v", err)
+		if err := s.unpackFile(ctx, tempFile, targetDir); err != nil {
+			return fmt.Errorf("解压文件失败: %w", err)
 		}
 
 		s.Logger.Info("解压完成", interfaces.Fields{
@@ -118,10 +146,13 @@ func (s *ClientSyncBase) DownloadFile(req *interfaces.SyncRequest, destPath stri
 	} else {
 		targetDir = filepath.Dir(redirectedPath + "/")
 	}
+	if err := message.WithinDir(sourcePath, targetDir); err != nil {
+		return s.rejectWritePath(req.Path, err)
+	}
 
 	// 接收文件
-	if err := s.networkClient.ReceiveFile(targetDir, progress); err != nil {
-		return fmt.Errorf("接收文件失败: %v", err)
+	if err := s.networkClient.RequestFile(ctx, fileRequest, targetDir, progress); err != nil {
+		return fmt.Errorf("接收文件失败: %w", err)
 	}
 
 	return nil
@@ -141,7 +172,10 @@ func (s *ClientSyncBase) IsSingleFile(path string) bool {
 
 // 其他辅助方法...
 
-func (s *ClientSyncBase) unpackFile(packFile, destPath string) error {
+// unpackFile 解压压缩包到目标目录
+// 解压前检查所有条目, 任一条目不安全时不解压任何文件
+// 每个文件先解压到临时文件再替换, 上下文取消时停止解压, 已解压的文件是完整的新版本, 其余文件保持原样
+func (s *ClientSyncBase) unpackFile(ctx context.Context, packFile, destPath string) error {
 	s.Logger.Info("开始解压文件", interfaces.Fields{
 		"pack": packFile,
 		"dest": destPath,
@@ -159,11 +193,22 @@ func (s *ClientSyncBase) unpackFile(packFile, destPath string) error {
 	}
 	defer reader.Close()
 
+	info, err := os.Stat(packFile)
+	if err != nil {
+		return fmt.Errorf("获取压缩包信息失败: %v", err)
+	}
+	entries, err := s.checkPackEntries(reader.File, info.Size(), destPath)
+	if err != nil {
+		return err
+	}
+
 	// 遍历压缩包中的文件
-	for _, file := range reader.File {
-		// 构建目标文件路径
-		targetPath := filepath.Join(destPath, file.Name)
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
+		file, targetPath := entry.file, entry.target
 		if file.FileInfo().IsDir() {
 			// 创建目录
 			if err := os.MkdirAll(targetPath, file.Mode()); err != nil {
@@ -177,34 +222,122 @@ func (s *ClientSyncBase) unpackFile(packFile, destPath string) error {
 			return fmt.Errorf("创建父目录失败: %v", err)
 		}
 
-		// 创建目标文件
-		target, err := os.OpenFile(targetPath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, file.Mode())
-		if err != nil {
-			return fmt.Errorf("创建目标文件失败: %v", err)
+		if err := extractFile(ctx, file, targetPath); err != nil {
+			return err
 		}
 
-		// 打开压缩文件
-		source, err := file.Open()
-		if err != nil {
-			target.Close()
-			return fmt.Errorf("打开压缩文件失败: %v", err)
+		s.Logger.Debug("解压文件完成", interfaces.Fields{
+			"file": targetPath,
+		})
+	}
+
+	return nil
+}
+
+// packEntry 压缩包中待解压的条目
+type packEntry struct {
+	file   *zip.File
+	target string // 解压的目标路径
+}
+
+// checkPackEntries 检查压缩包的所有条目, 返回每个条目的目标路径
+// 条目只能是普通文件和目录且位于目标目录中; 条目数量、单个条目的压缩率和解压后的总大小不能超过上限,
+// 总大小上限由压缩包大小推算. 实际解压的数据超过条目声明的大小时archive/zip返回错误, 因此可以按声明的大小检查
+func (s *ClientSyncBase) checkPackEntries(files []*zip.File, packSize int64, destPath string) ([]packEntry, error) {
+	if len(files) > maxPackEntries {
+		return nil, s.rejectPack(fmt.Sprintf("压缩包条目过多: %d, 上限 %d", len(files), maxPackEntries))
+	}
+
+	limit := uint64(packSize) * maxPackRatio
+	var total uint64
+	entries := make([]packEntry, 0, len(files))
+	for _, file := range files {
+		if file.UncompressedSize64 > limit-total {
+			return nil, s.rejectPack(fmt.Sprintf("压缩包解压后超过大小上限: 压缩包大小的%d倍", maxPackRatio))
+		}
+		total += file.UncompressedSize64
+		if file.UncompressedSize64 > packRatioMinSize && file.UncompressedSize64/maxPackRatio > file.CompressedSize64 {
+			return nil, s.rejectPack(fmt.Sprintf("压缩包条目的压缩率过高: %s", file.Name))
 		}
 
-		// 复制文件内容
-		if _, err := io.Copy(target, source); err != nil {
-			target.Close()
-			source.Close()
-			return fmt.Errorf("复制文件内容失败: %v", err)
+		if mode := file.Mode(); !mode.IsDir() && !mode.IsRegular() {
+			return nil, s.rejectPack(fmt.Sprintf("压缩包包含不支持的条目类型: %s (%v)", file.Name, mode.Type()))
+		}
+		target, err := message.SafeJoin(destPath, file.Name)
+		if err != nil {
+			return nil, s.rejectWritePath(file.Name, err)
 		}
+		entries = append(entries, packEntry{file: file, target: target})
+	}
+	return entries, nil
+}
+
+// packTempDir 打包同步下载压缩包的临时目录, 按客户端UUID区分
+// UUID来自可编辑的配置文件, 只能作为临时目录下的一级目录名
+func packTempDir(uuid string) (string, error) {
+	if uuid == "." || strings.ContainsAny(uuid, "/\\") {
+		return "", fmt.Errorf("无效的目录名: %s", uuid)
+	}
+	return message.SafeJoin(filepath.Join(os.TempDir(), "synctools_pack"), uuid)
+}
 
-		target.Close()
-		source.Close()
+// packTempName 打包同步下载压缩包的临时文件名, 由服务器上的完整路径生成
+// 路径来自服务器, 使用摘要作为文件名, 不会包含路径分隔符
+func packTempName(serverPath string) string {
+	sum := sha256.Sum256([]byte(filepath.ToSlash(serverPath)))
+	return hex.EncodeToString(sum[:]) + filepath.Ext(serverPath)
+}
 
-		s.Logger.Debug("解压文件完成", interfaces.Fields{
-			"file": targetPath,
-		})
+// rejectWritePath 拒绝写入同步目录之外的路径并记录安全事件
+func (s *ClientSyncBase) rejectWritePath(serverPath string, err error) error {
+	s.Logger.Warn("安全事件", interfaces.Fields{
+		"event":  "write_rejected",
+		"path":   serverPath,
+		"reason": err.Error(),
+	})
+	return errors.NewError(errors.CodeForbidden, fmt.Sprintf("拒绝写入同步目录之外的路径: %s", serverPath), err)
+}
+
+// rejectPack 拒绝解压超出限制的压缩包并记录安全事件
+func (s *ClientSyncBase) rejectPack(reason string) error {
+	s.Logger.Warn("安全事件", interfaces.Fields{
+		"event":  "pack_rejected",
+		"reason": reason,
+	})
+	return errors.NewError(errors.CodeForbidden, reason, nil)
+}
+
+// extractFile 解压单个文件, 先写入同目录的临时文件, 完整写入后再替换目标文件
+func extractFile(ctx context.Context, file *zip.File, targetPath string) error {
+	source, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("打开压缩文件失败: %v", err)
+	}
+	defer source.Close()
+
+	temp, err := os.CreateTemp(filepath.Dir(targetPath), filepath.Base(targetPath)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %v", err)
 	}
+	tempPath := temp.Name()
 
+	_, err = io.Copy(temp, message.ContextReader(ctx, source))
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tempPath)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("复制文件内容失败: %v", err)
+	}
+
+	os.Chmod(tempPath, file.Mode().Perm())
+	if err := message.ReplaceFile(tempPath, targetPath); err != nil {
+		os.Remove(tempPath)
+		return fmt.Errorf("替换目标文件失败: %v", err)
+	}
 	return nil
 }
 
@@ -231,7 +364,9 @@ func (s *ClientSyncBase) getRedirectedPath(originalPath, destPath string) string
 			relativePath := strings.TrimPrefix(originalPath, redirect.ServerPath)
 			// 确保relativePath不以分隔符开头
 			relativePath = strings.TrimPrefix(relativePath, "/")
-			targetDir := filepath.Join(filepath.Dir(filepath.Dir(destPath)), redirect.ClientPath)
+			// 目标路径以请求路径结尾, 去掉请求路径得到同步目录, 嵌套的文件同样重定向到客户端路径下
+			baseDir := strings.TrimSuffix(destPath, originalPath)
+			targetDir := filepath.Join(baseDir, redirect.ClientPath)
 			return filepath.ToSlash(filepath.Join(targetDir, relativePath))
 		}
 	}
@@ -0,0 +1,127 @@
+package base
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/internal/testutil"
+	"synctools/codes/pkg/errors"
+)
+
+// TestPackTempDir 打包同步的临时目录只能位于synctools_pack目录下
+func TestPackTempDir(t *testing.T) {
+	root := filepath.Join(os.TempDir(), "synctools_pack")
+
+	dir, err := packTempDir("0f8fad5b-d9cb-469f-a165-70867728950e")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if filepath.Dir(dir) != root {
+		t.Errorf("临时目录错误: %s", dir)
+	}
+
+	for _, uuid := range []string{"", ".", "..", "../../x", `..\..\x`, "a/b", "/tmp/x", "C:x"} {
+		if dir, err := packTempDir(uuid); err == nil {
+			t.Errorf("%q: 期望拒绝, 实际 %s", uuid, dir)
+		}
+	}
+}
+
+// TestPackTempName 不同文件夹下同名的压缩包使用不同的临时文件, 文件名不包含路径
+func TestPackTempName(t *testing.T) {
+	a := packTempName("mods/client/pack.zip")
+	b := packTempName("config/pack.zip")
+	if a == b {
+		t.Errorf("同名压缩包的临时文件相同: %s", a)
+	}
+	if a != packTempName("mods/client/pack.zip") {
+		t.Error("相同路径应使用相同的临时文件, 以便续传")
+	}
+	for _, name := range []string{a, b, packTempName("../../x.zip"), packTempName(`..\..\x.zip`)} {
+		if filepath.Base(name) != name || !strings.HasSuffix(name, ".zip") {
+			t.Errorf("临时文件名错误: %s", name)
+		}
+	}
+}
+
+// TestRedirectedPath 重定向的同步文件夹中嵌套的文件同样写入客户端路径下
+func TestRedirectedPath(t *testing.T) {
+	config := &interfaces.Config{
+		FolderRedirects: []interfaces.FolderRedirect{{ServerPath: "mods", ClientPath: "mods2"}},
+	}
+	s := NewClientSyncBase(NewBaseSyncService(config, nil, nil), nil)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"mods/a.jar", "/sync/mods2/a.jar"},
+		{"mods/sub/b.jar", "/sync/mods2/sub/b.jar"},
+		{"config/a.cfg", "/sync/config/a.cfg"},
+	}
+	for _, tt := range tests {
+		if got := s.getRedirectedPath(tt.path, "/sync/"+tt.path); got != tt.want {
+			t.Errorf("%s: 期望 %s, 实际 %s", tt.path, tt.want, got)
+		}
+	}
+}
+
+// TestCheckPackEntries 解压前拒绝压缩率过高或解压后总大小超过压缩包大小上限倍数的压缩包
+func TestCheckPackEntries(t *testing.T) {
+	s := NewClientSyncBase(NewBaseSyncService(&interfaces.Config{}, testutil.NewNopLogger(), nil), nil)
+	text := []byte(strings.Repeat("synctools pack entry ", 20))
+
+	tests := []struct {
+		name  string
+		files map[string][]byte
+		ok    bool
+	}{
+		{"normal", map[string][]byte{"mods/a.jar": text, "config/a.cfg": text}, true},
+		{"entry ratio", map[string][]byte{"mods/a.jar": make([]byte, 8<<20)}, false},
+		{"total size", packFiles(64, make([]byte, 512<<10)), false},
+		{"escape", map[string][]byte{"../a.jar": text}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			w := zip.NewWriter(&buf)
+			for name, data := range tt.files {
+				f, err := w.Create(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				f.Write(data)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+			reader, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			_, err = s.checkPackEntries(reader.File, int64(buf.Len()), t.TempDir())
+			if tt.ok && err != nil {
+				t.Errorf("期望允许解压, 实际 %v", err)
+			}
+			if !tt.ok && !errors.Is(err, errors.ErrForbidden) {
+				t.Errorf("期望拒绝解压, 实际 %v", err)
+			}
+		})
+	}
+}
+
+// packFiles 生成内容相同的多个压缩包条目
+func packFiles(n int, data []byte) map[string][]byte {
+	files := make(map[string][]byte, n)
+	for i := 0; i < n; i++ {
+		files[fmt.Sprintf("mods/%d.bin", i)] = data
+	}
+	return files
+}
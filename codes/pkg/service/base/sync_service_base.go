@@ -1,6 +1,7 @@
 package base
 
 import (
+	"context"
 	"crypto/md5"
 	"crypto/sha256"
 	"encoding/hex"
@@ -13,6 +14,7 @@ import (
 
 	"synctools/codes/internal/interfaces"
 	"synctools/codes/pkg/errors"
+	"synctools/codes/pkg/network/message"
 )
 
 // BaseSyncService 提供同步服务的基础实现
@@ -274,8 +276,8 @@ func (s *BaseSyncService) ReportProgress(progress *interfaces.Progress) {
 	}
 }
 
-// GetLocalFilesWithMD5 获取本地文件的MD5信息
-func (s *BaseSyncService) GetLocalFilesWithMD5(dir string) (map[string]string, error) {
+// GetLocalFilesWithMD5 获取本地文件的MD5信息, 上下文取消时停止计算并返回取消原因
+func (s *BaseSyncService) GetLocalFilesWithMD5(ctx context.Context, dir string) (map[string]string, error) {
 	// 检查路径是文件还是目录
 	fileInfo, err := os.Stat(dir)
 	if err != nil {
@@ -293,7 +295,7 @@ func (s *BaseSyncService) GetLocalFilesWithMD5(dir string) (map[string]string, e
 
 	// 如果是单个文件
 	if !fileInfo.IsDir() {
-		md5hash, err := s.calculateFileMD5(dir)
+		md5hash, err := s.calculateFileMD5(ctx, dir)
 		if err != nil {
 			if os.IsNotExist(err) {
 				// 如果文件不存在，返回空映射
@@ -316,7 +318,15 @@ func (s *BaseSyncService) GetLocalFilesWithMD5(dir string) (map[string]string, e
 			}
 			return err
 		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 		if !info.IsDir() {
+			// 跳过未完成下载的临时文件
+			if message.IsPartialFile(path) {
+				return nil
+			}
+
 			// 获取相对路径
 			relPath, err := filepath.Rel(dir, path)
 			if err != nil {
@@ -336,7 +346,7 @@ func (s *BaseSyncService) GetLocalFilesWithMD5(dir string) (map[string]string, e
 				}
 			}
 
-			md5hash, err := s.calculateFileMD5(path)
+			md5hash, err := s.calculateFileMD5(ctx, path)
 			if err != nil {
 				if os.IsNotExist(err) {
 					// 如果文件不存在，跳过该文件
@@ -361,7 +371,7 @@ func (s *BaseSyncService) GetLocalFilesWithMD5(dir string) (map[string]string, e
 	return files, nil
 }
 
-func (s *BaseSyncService) calculateFileMD5(path string) (string, error) {
+func (s *BaseSyncService) calculateFileMD5(ctx context.Context, path string) (string, error) {
 	file, err := os.Open(path)
 	if err != nil {
 		return "", err
@@ -369,7 +379,7 @@ func (s *BaseSyncService) calculateFileMD5(path string) (string, error) {
 	defer file.Close()
 
 	hash := md5.New()
-	if _, err := io.Copy(hash, file); err != nil {
+	if _, err := io.Copy(hash, message.ContextReader(ctx, file)); err != nil {
 		return "", err
 	}
 
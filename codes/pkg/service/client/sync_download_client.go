@@ -0,0 +1,288 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/errors"
+	"synctools/codes/pkg/network/message"
+)
+
+const (
+	// defaultDownloadWorkers 未配置时并行下载的文件数
+	defaultDownloadWorkers = 4
+	// maxDownloadWorkers 并行下载文件数的上限
+	maxDownloadWorkers = 16
+)
+
+// downloadPool 在同一个多路复用连接上并行下载文件的工作池
+type downloadPool struct {
+	service    *ClientSyncService
+	sourcePath string
+	total      int
+
+	mu         sync.Mutex
+	downloaded int // 下载成功的文件数
+	failed     int // 下载失败的文件数
+	aborted    error
+
+	reconnectMu sync.Mutex
+	generation  int // 连接代数, 每次重连成功后加一
+}
+
+// downloadFiles 并行下载所有需要同步的文件, 返回成功和失败的文件数
+// 连接中断时只由一个工作协程负责重连, 其他协程等待后继续
+// 重连失败或服务器文件清单变化时中止剩余的下载, 清单变化时返回errManifestChanged
+// 上下文取消时中止进行中和剩余的下载, 返回取消原因
+func (s *ClientSyncService) downloadFiles(ctx context.Context, sourcePath string) (int, int, error) {
+	pool := &downloadPool{
+		service:    s,
+		sourcePath: sourcePath,
+		total:      len(s.filesToSync),
+	}
+
+	workers := s.downloadWorkers()
+	s.Logger.Info("开始并行下载", interfaces.Fields{
+		"files":   pool.total,
+		"workers": workers,
+	})
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for syncPath := range jobs {
+				pool.download(ctx, syncPath)
+			}
+		}()
+	}
+
+	for _, syncPath := range s.filesToSync {
+		jobs <- syncPath
+	}
+	close(jobs)
+	wg.Wait()
+
+	return pool.downloaded, pool.failed, pool.aborted
+}
+
+// downloadWorkers 获取并行下载的文件数
+// 服务器不支持多路复用时文件传输只能串行进行, 使用单个工作协程
+func (s *ClientSyncService) downloadWorkers() int {
+	if !s.networkClient.HasCapability(message.CapMultiplex) {
+		return 1
+	}
+
+	workers := defaultDownloadWorkers
+	if config := s.GetCurrentConfig(); config != nil && config.DownloadWorkers > 0 {
+		workers = config.DownloadWorkers
+	}
+	if workers > maxDownloadWorkers {
+		workers = maxDownloadWorkers
+	}
+	return workers
+}
+
+// download 下载单个文件, 连接中断时重连后重试, 服务器返回可以重试的错误时等待后重试
+func (p *downloadPool) download(ctx context.Context, syncPath string) {
+	s := p.service
+	for retries := 0; ; retries++ {
+		// 服务器文件已变化, 不再按旧的计划下载
+		if s.manifestStale.Load() {
+			p.abort(errManifestChanged)
+		}
+		if err := ctx.Err(); err != nil {
+			p.abort(err)
+		}
+		if err := p.abortErr(); err != nil {
+			// 清单变化时剩余的文件会按新的计划重新下载, 取消时剩余的文件保持原样, 都不计为失败
+			if err != errManifestChanged && ctx.Err() == nil {
+				p.finish(syncPath, false)
+			}
+			return
+		}
+
+		generation := p.currentGeneration()
+		err := s.downloadFile(ctx, p.sourcePath, syncPath)
+		if err == nil {
+			p.finish(syncPath, true)
+			return
+		}
+		if ctx.Err() != nil {
+			p.abort(ctx.Err())
+			return
+		}
+
+		// 其他协程可能已经重连, 在旧连接上失败的下载同样需要重试
+		interrupted := s.connectionInterrupted() || p.currentGeneration() != generation
+		if interrupted && retries < maxFileRetries {
+			if err := p.recover(ctx, generation); err == nil || err == errManifestChanged {
+				continue
+			}
+			if ctx.Err() == nil {
+				p.finish(syncPath, false)
+			}
+			return
+		}
+
+		// 服务器繁忙等可以重试的错误, 按服务器建议的时间等待后重试
+		if errors.IsRetryable(err) && retries < maxFileRetries {
+			if waitErr := waitRetry(ctx, err, retries); waitErr != nil {
+				p.abort(waitErr)
+				return
+			}
+			continue
+		}
+
+		s.Logger.Error("下载文件失败", interfaces.Fields{
+			"file":  syncPath,
+			"error": err,
+		})
+		p.finish(syncPath, false)
+		return
+	}
+}
+
+// waitRetry 等待重试下载, 服务器未建议重试时间时按重连间隔等待
+// 上下文取消时返回取消原因
+func waitRetry(ctx context.Context, err error, retries int) error {
+	delay := errors.GetRetryAfter(err)
+	if delay <= 0 {
+		delay = reconnectDelay(retries + 1)
+	}
+	if delay > reconnectMaxDelay {
+		delay = reconnectMaxDelay
+	}
+
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// recover 连接中断后重新连接
+// 下载开始后已有其他协程完成重连时直接返回, 重连失败后所有协程停止下载
+func (p *downloadPool) recover(ctx context.Context, generation int) error {
+	p.reconnectMu.Lock()
+	defer p.reconnectMu.Unlock()
+
+	if err := p.abortErr(); err != nil {
+		return err
+	}
+	if p.generation != generation {
+		return nil
+	}
+
+	if err := p.service.reconnect(ctx); err != nil {
+		p.abort(err)
+		if err != errManifestChanged && ctx.Err() == nil {
+			p.service.Logger.Error("同步中断", interfaces.Fields{
+				"error": err,
+			})
+		}
+		return err
+	}
+	p.generation++
+	return nil
+}
+
+// currentGeneration 获取当前连接代数
+func (p *downloadPool) currentGeneration() int {
+	p.reconnectMu.Lock()
+	defer p.reconnectMu.Unlock()
+	return p.generation
+}
+
+// abort 中止剩余的下载, 只记录第一次中止的原因
+func (p *downloadPool) abort(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.aborted == nil {
+		p.aborted = err
+	}
+}
+
+// abortErr 获取中止同步的原因, 未中止时返回nil
+func (p *downloadPool) abortErr() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.aborted
+}
+
+// finish 记录文件下载结果并报告总体进度, 进度以文件数计
+func (p *downloadPool) finish(syncPath string, ok bool) {
+	p.mu.Lock()
+	if ok {
+		p.downloaded++
+	} else {
+		p.failed++
+	}
+	done := p.downloaded + p.failed
+	p.mu.Unlock()
+
+	p.service.ReportProgress(&interfaces.Progress{
+		Total:    int64(p.total),
+		Current:  int64(done),
+		FileName: syncPath,
+		Status:   fmt.Sprintf("已处理 %d/%d 个文件", done, p.total),
+	})
+}
+
+// downloadFile 下载单个需要同步的文件
+// syncPath为包含同步文件夹的服务器路径, 与服务器清单中的文件夹和文件路径对应
+func (s *ClientSyncService) downloadFile(ctx context.Context, sourcePath, syncPath string) error {
+	syncPath = filepath.ToSlash(syncPath)
+	mode := s.folderMode(syncPath)
+
+	// 构建本地路径, 重定向由下载时处理
+	fullPath := filepath.Join(sourcePath, filepath.FromSlash(syncPath))
+
+	req := &interfaces.SyncRequest{
+		Mode:      mode,
+		Direction: interfaces.DirectionPull,
+		Path:      syncPath,
+	}
+
+	s.Logger.Info("开始下载文件", interfaces.Fields{
+		"file": syncPath,
+		"mode": mode,
+	})
+
+	if err := s.syncBase.DownloadFile(ctx, req, fullPath, sourcePath, mode); err != nil {
+		return err
+	}
+
+	s.Logger.Debug("文件下载成功", interfaces.Fields{
+		"file": syncPath,
+	})
+	return nil
+}
+
+// folderMode 获取路径所属同步文件夹的同步模式, 文件夹嵌套时取最深的一个
+func (s *ClientSyncService) folderMode(syncPath string) interfaces.SyncMode {
+	// 统一使用斜杠作为分隔符进行比较
+	syncPath = path.Clean(filepath.ToSlash(syncPath))
+	var mode interfaces.SyncMode
+	matched := -1
+	for _, folderConfig := range s.Config.SyncFolders {
+		folder := path.Clean(filepath.ToSlash(folderConfig.Path))
+		if syncPath != folder && !strings.HasPrefix(syncPath, folder+"/") {
+			continue
+		}
+		if len(folder) > matched {
+			mode = folderConfig.SyncMode
+			matched = len(folder)
+		}
+	}
+	return mode
+}
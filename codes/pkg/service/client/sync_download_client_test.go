@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/internal/testutil"
+	server "synctools/codes/pkg/network/server"
+	"synctools/codes/pkg/service/base"
+	"synctools/codes/pkg/storage"
+)
+
+// testServerService 按服务器同步目录计算文件清单的服务端同步服务
+type testServerService struct {
+	interfaces.ServerSyncService
+	base    *base.BaseSyncService
+	syncDir string
+}
+
+func (s testServerService) GetLocalFilesWithMD5(ctx context.Context, dir string) (map[string]string, error) {
+	return s.base.GetLocalFilesWithMD5(ctx, filepath.Join(s.syncDir, dir))
+}
+
+// TestSyncNestedFiles 客户端通过路径受限的服务器下载同步文件夹中的嵌套文件
+func TestSyncNestedFiles(t *testing.T) {
+	serverDir := t.TempDir()
+	files := map[string]string{
+		"mods/a.jar":       "a",
+		"mods/sub/b.jar":   "b",
+		"options.txt":      "options",
+		"mods/sub/c/d.cfg": "d",
+	}
+	for name, data := range files {
+		p := filepath.Join(serverDir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	folders := []interfaces.SyncFolder{
+		{Path: "mods", SyncMode: interfaces.MirrorSync, IsEnabled: true},
+		{Path: "options.txt", SyncMode: interfaces.MirrorSync, IsEnabled: true},
+	}
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := ln.Addr().(*net.TCPAddr).Port
+	ln.Close()
+
+	serverConfig := &interfaces.Config{
+		Host:        "127.0.0.1",
+		Port:        port,
+		SyncDir:     serverDir,
+		SyncFolders: folders,
+	}
+	service := testServerService{
+		base:    base.NewBaseSyncService(serverConfig, testutil.NewNopLogger(), nil),
+		syncDir: serverDir,
+	}
+	s := server.NewServer(serverConfig, service, testutil.NewNopLogger())
+	if err := s.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Stop()
+
+	// 客户端按工作目录查找本地的同步文件夹
+	clientDir := t.TempDir()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(clientDir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	store, err := storage.NewFileStorage(clientDir, testutil.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewClientSyncService(&interfaces.Config{
+		UUID:        "0f8fad5b-d9cb-469f-a165-70867728950e",
+		Type:        interfaces.ConfigTypeClient,
+		SyncFolders: folders,
+	}, testutil.NewNopLogger(), store)
+	if err := c.Connect("127.0.0.1", strconv.Itoa(port)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SyncFiles(context.Background(), clientDir); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range files {
+		data, err := os.ReadFile(filepath.Join(clientDir, filepath.FromSlash(name)))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if string(data) != want {
+			t.Errorf("%s: 内容错误: %q", name, data)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package client
+
+import (
+	"context"
+
+	"synctools/codes/internal/interfaces"
+)
+
+// maxPlanRefreshes 一次同步中因服务器文件变化重新计算同步计划的最大次数
+const maxPlanRefreshes = 3
+
+// handleManifestChanged 服务器文件清单变化时标记同步计划已过期
+// 同步中的下载在当前文件结束后停止, 按新的清单重新计算计划, 不会混用新旧两个版本的文件
+func (s *ClientSyncService) handleManifestChanged(notice *interfaces.ManifestChanged) {
+	s.manifestStale.Store(true)
+	s.Logger.Info("同步计划已过期", interfaces.Fields{
+		"version": notice.Version,
+		"reason":  notice.Reason,
+	})
+	s.SetStatus("服务器文件已更新")
+}
+
+// refreshPlan 重新获取服务器文件清单并计算同步计划
+func (s *ClientSyncService) refreshPlan(ctx context.Context) error {
+	s.manifestStale.Store(false)
+
+	serverConfig, serverMD5Map, err := s.networkClient.RequestManifest(ctx)
+	if err != nil {
+		s.manifestStale.Store(true)
+		return err
+	}
+
+	filesToSync, filesToDelete, ignoredFiles, err := s.comparePlan(ctx, serverConfig, serverMD5Map)
+	if err != nil {
+		s.manifestStale.Store(true)
+		return err
+	}
+
+	s.filesToSync = filesToSync
+	s.filesToDelete = filesToDelete
+	s.ignoredFiles = ignoredFiles
+
+	s.Logger.Info("已重新计算同步计划", interfaces.Fields{
+		"need_sync":   len(filesToSync),
+		"need_delete": len(filesToDelete),
+	})
+	return nil
+}
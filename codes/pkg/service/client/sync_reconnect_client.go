@@ -0,0 +1,131 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"sort"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+)
+
+const (
+	// maxReconnectAttempts 连接中断后的最大重连次数
+	maxReconnectAttempts = 5
+	// maxFileRetries 单个文件因连接中断重试的最大次数
+	maxFileRetries = 3
+	// reconnectBaseDelay 首次重连前的等待时间
+	reconnectBaseDelay = time.Second
+	// reconnectMaxDelay 重连等待时间上限
+	reconnectMaxDelay = 30 * time.Second
+)
+
+// errManifestChanged 重连后服务器文件清单已变化
+var errManifestChanged = errors.New("服务器文件已变更, 请重新连接并同步")
+
+// connectionInterrupted 检查同步过程中连接是否意外中断
+// 用户主动断开时服务已停止, 不视为中断
+func (s *ClientSyncService) connectionInterrupted() bool {
+	return s.IsRunning() && !s.networkClient.IsConnected()
+}
+
+// reconnect 连接中断后按指数退避重新连接并完成握手
+// 服务器文件清单未变化时返回nil, 调用方可以继续同步剩余文件; 上下文取消时停止重连
+func (s *ClientSyncService) reconnect(ctx context.Context) error {
+	var lastErr error
+	for attempt := 1; attempt <= maxReconnectAttempts; attempt++ {
+		delay := reconnectDelay(attempt)
+		s.reportReconnect(fmt.Sprintf("连接中断, %s后重新连接 (第%d/%d次)",
+			delay.Round(100*time.Millisecond), attempt, maxReconnectAttempts))
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		if !s.IsRunning() {
+			return fmt.Errorf("同步已停止")
+		}
+
+		if err := s.networkClient.Connect(s.serverAddr, s.serverPort); err != nil {
+			lastErr = err
+			s.Logger.Warn("重新连接失败", interfaces.Fields{
+				"attempt": attempt,
+				"error":   err,
+			})
+			s.reportProxyError(err)
+			continue
+		}
+
+		// 重新握手并比对服务器文件清单
+		previous := s.manifestDigest
+		if _, _, _, err := s.PrepareMD5Compare(ctx); err != nil {
+			lastErr = err
+			s.networkClient.Disconnect()
+			s.Logger.Warn("重新握手失败", interfaces.Fields{
+				"attempt": attempt,
+				"error":   err,
+			})
+			continue
+		}
+		if s.manifestDigest != previous {
+			s.reportReconnect("服务器文件已变更, 重新计算同步计划")
+			return errManifestChanged
+		}
+
+		s.reportReconnect("已重新连接, 继续同步")
+		return nil
+	}
+	return fmt.Errorf("重新连接失败: %v", lastErr)
+}
+
+// reportReconnect 通过状态和进度回调报告重连进展
+func (s *ClientSyncService) reportReconnect(status string) {
+	s.Logger.Info("重新连接", interfaces.Fields{
+		"status": status,
+	})
+	s.SetStatus(status)
+	s.ReportProgress(&interfaces.Progress{Status: status})
+}
+
+// reconnectDelay 计算第n次重连前的等待时间
+// 等待时间按指数增长, 并在 [delay/2, delay) 内随机, 避免多个客户端同时重连
+func reconnectDelay(attempt int) time.Duration {
+	delay := reconnectMaxDelay
+	if attempt < 16 {
+		if d := reconnectBaseDelay << uint(attempt-1); d < reconnectMaxDelay {
+			delay = d
+		}
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)))
+}
+
+// manifestDigest 计算服务器文件清单的摘要, 用于判断重连前后清单是否一致
+func manifestDigest(md5Map map[string]map[string]string) string {
+	folders := make([]string, 0, len(md5Map))
+	for folder := range md5Map {
+		folders = append(folders, folder)
+	}
+	sort.Strings(folders)
+
+	h := sha256.New()
+	for _, folder := range folders {
+		files := md5Map[folder]
+		paths := make([]string, 0, len(files))
+		for path := range files {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		fmt.Fprintf(h, "%s\x00", folder)
+		for _, path := range paths {
+			fmt.Fprintf(h, "%s\x00%s\x00", path, files[path])
+		}
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -12,26 +12,42 @@
 package client
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"sync/atomic"
+	"time"
 
 	"synctools/codes/internal/interfaces"
 	"synctools/codes/pkg/network/client"
+	"synctools/codes/pkg/network/message"
 	"synctools/codes/pkg/service/base"
 )
 
 // ClientSyncService 客户端同步服务实现
 type ClientSyncService struct {
 	*base.BaseSyncService
-	networkClient *client.NetworkClient
+	networkClient client.Transport // 当前使用的传输
+	tcpClient     *client.NetworkClient
+	httpClient    *client.HTTPClient
+	staticClient  *client.StaticClient
 	syncBase      *base.ClientSyncBase
-	onConnLost    func() // 添加回调字段
+	onConnLost    func(err error) // 连接丢失回调
 
 	// MD5比较结果
 	filesToSync   []string                       // 需要同步的文件列表
 	filesToDelete map[string]map[string]struct{} // 需要删除的文件映射
 	ignoredFiles  int                            // 被忽略的文件数量
+
+	// 断线重连
+	serverAddr     string // 服务器地址
+	serverPort     string // 服务器端口
+	manifestDigest string // 服务器文件清单摘要
+
+	manifestStale atomic.Bool // 服务器文件清单在计算同步计划后已变化
 }
 
 // NewClientSyncService 创建客户端同步服务
@@ -41,20 +57,46 @@ func NewClientSyncService(config *interfaces.Config, logger interfaces.Logger, s
 		BaseSyncService: baseService,
 		filesToDelete:   make(map[string]map[string]struct{}),
 	}
-	srv.networkClient = client.NewNetworkClient(logger, srv)
+	srv.tcpClient = client.NewNetworkClient(logger, srv)
+	srv.httpClient = client.NewHTTPClient(logger, srv)
+	srv.staticClient = client.NewStaticClient(logger, srv)
+	srv.networkClient = srv.tcpClient
+	for _, transport := range srv.transports() {
+		transport.SetManifestChangedCallback(srv.handleManifestChanged)
+	}
 	srv.syncBase = base.NewClientSyncBase(baseService, srv.networkClient)
 	return srv
 }
 
+// transports 获取所有传输
+func (s *ClientSyncService) transports() []client.Transport {
+	return []client.Transport{s.tcpClient, s.httpClient, s.staticClient}
+}
+
 // Connect 连接服务器
+// 地址为 file:// 或以清单文件名结尾的 http(s):// 地址时从静态导出同步,
+// 带 http:// 或 https:// 前缀时使用HTTP传输, 否则使用TCP传输
 func (s *ClientSyncService) Connect(addr, port string) error {
+	s.serverAddr = addr
+	s.serverPort = port
+
+	if client.IsStaticURL(addr) {
+		s.networkClient = s.staticClient
+	} else if client.IsHTTPURL(addr) {
+		s.networkClient = s.httpClient
+	} else {
+		s.networkClient = s.tcpClient
+	}
+	s.syncBase.SetTransport(s.networkClient)
+
 	// 连接服务器
 	if err := s.networkClient.Connect(addr, port); err != nil {
-		return fmt.Errorf("连接服务器失败: %v", err)
+		s.reportProxyError(err)
+		return fmt.Errorf("连接服务器失败: %w", err)
 	}
 
 	// 执行MD5比较
-	filesToSync, filesToDelete, ignoredFiles, err := s.PrepareMD5Compare()
+	filesToSync, filesToDelete, ignoredFiles, err := s.PrepareMD5Compare(context.Background())
 	if err != nil {
 		s.networkClient.Disconnect()
 		return err
@@ -70,6 +112,27 @@ func (s *ClientSyncService) Connect(addr, port string) error {
 	return nil
 }
 
+// DiscoverServers 在局域网中查找服务器, timeout为0时使用默认收集时间
+func (s *ClientSyncService) DiscoverServers(timeout time.Duration) ([]*interfaces.ServerBeacon, error) {
+	return client.DiscoverServers(s.Logger, timeout)
+}
+
+// reportProxyError 连接因代理失败时在状态中提示检查代理设置
+func (s *ClientSyncService) reportProxyError(err error) {
+	var proxyErr *client.ProxyError
+	if !errors.As(err, &proxyErr) {
+		return
+	}
+
+	status := fmt.Sprintf("代理连接失败: %v, 请检查代理设置", proxyErr.Err)
+	s.Logger.Error("代理连接失败", interfaces.Fields{
+		"proxy": proxyErr.Proxy,
+		"error": proxyErr.Err,
+	})
+	s.SetStatus(status)
+	s.ReportProgress(&interfaces.Progress{Status: status})
+}
+
 // Disconnect 断开连接
 func (s *ClientSyncService) Disconnect() error {
 	// 断开网络连接
@@ -89,24 +152,36 @@ func (s *ClientSyncService) IsConnected() bool {
 }
 
 // SetConnectionLostCallback 设置连接丢失回调
-func (s *ClientSyncService) SetConnectionLostCallback(callback func()) {
+func (s *ClientSyncService) SetConnectionLostCallback(callback func(err error)) {
 	s.onConnLost = callback
-	// 将回调传递给 networkClient
-	s.networkClient.SetConnectionLostCallback(func() {
-		if s.onConnLost != nil {
-			s.onConnLost()
-		}
-	})
+	// 将回调传递给所有传输
+	for _, transport := range s.transports() {
+		transport.SetConnectionLostCallback(func(err error) {
+			if s.onConnLost != nil {
+				s.onConnLost(err)
+			}
+		})
+	}
 }
 
 // SyncFiles 同步文件
-func (s *ClientSyncService) SyncFiles(sourcePath string) error {
+// 上下文取消时中止进行中的下载并跳过删除, 每个本地文件保持原样或已完整更新
+func (s *ClientSyncService) SyncFiles(ctx context.Context, sourcePath string) error {
 	// 设置同步状态为开始
 	s.networkClient.SetSyncing(true)
 	defer s.networkClient.SetSyncing(false) // 确保同步结束时重置状态
 
 	s.SetStatus("同步中")
 
+	// 连接后服务器文件已变化, 先按新的清单重新计算同步计划
+	if s.manifestStale.Load() {
+		if err := s.refreshPlan(ctx); err != nil {
+			s.SetStatus(fmt.Sprintf("同步失败: %v", err))
+			s.Disconnect()
+			return err
+		}
+	}
+
 	// 如果没有需要同步的文件且没有需要删除的文件,直接返回
 	if len(s.filesToSync) == 0 && len(s.filesToDelete) == 0 {
 		s.SetStatus("无需同步")
@@ -114,81 +189,41 @@ func (s *ClientSyncService) SyncFiles(sourcePath string) error {
 		return nil
 	}
 
-	var totalDownloadCount, totalDeleteCount, totalFailedCount int
-
-	// 处理需要同步的文件
-	for _, syncPath := range s.filesToSync {
-		folder := filepath.Dir(syncPath)
-		serverPath := filepath.Base(syncPath)
-
-		// 获取当前文件夹的同步模式
-		var mode interfaces.SyncMode
-		// 统一使用斜杠作为分隔符进行比较
-		folderSlash := filepath.ToSlash(folder)
-		for _, folderConfig := range s.Config.SyncFolders {
-			if folderConfig.Path == folderSlash {
-				mode = folderConfig.SyncMode
-				break
-			}
-		}
-
-		// 构建本地路径
-		localFolderPath := filepath.Join(sourcePath, folder)
-
-		// 发送下载请求
-		var reqPath string
-		var fullPath string
-		if s.syncBase.IsSingleFile(folder) {
-			// 如果是单文件
-			reqPath = folder
-			fullPath = localFolderPath
-		} else {
-			// 如果是文件夹中的文件
-			reqPath = filepath.Join(folder, serverPath)
-			fullPath = filepath.Join(localFolderPath, serverPath)
-		}
-
-		req := &interfaces.SyncRequest{
-			Mode:      mode,
-			Direction: interfaces.DirectionPull,
-			Path:      reqPath,
+	var totalDeleteCount int
+	statsStart := s.networkClient.TransferStats()
+
+	// 并行下载需要同步的文件, 连接中断时重新连接并继续剩余的文件
+	// 删除在所有下载结束后进行, 避免镜像模式下删除仍在使用的文件
+	var totalDownloadCount, totalFailedCount int
+	var syncErr error
+	for refreshes := 0; ; refreshes++ {
+		downloaded, failed, err := s.downloadFiles(ctx, sourcePath)
+		totalDownloadCount += downloaded
+		totalFailedCount += failed
+		if err != errManifestChanged || refreshes >= maxPlanRefreshes {
+			syncErr = err
+			break
 		}
 
-		s.Logger.Info("开始下载文件", interfaces.Fields{
-			"folder": folder,
-			"file":   serverPath,
-			"mode":   mode,
-		})
-
-		if err := s.syncBase.DownloadFile(req, fullPath, sourcePath, mode); err != nil {
-			s.Logger.Error("下载文件失败", interfaces.Fields{
-				"folder": folder,
-				"file":   serverPath,
-				"error":  err,
-			})
-			totalFailedCount++
-			continue
+		// 服务器文件在同步过程中变化, 按新的清单重新比较, 已是最新的文件不会重复下载
+		s.SetStatus("服务器文件已更新, 重新计算同步计划")
+		if syncErr = s.refreshPlan(ctx); syncErr != nil {
+			break
 		}
+	}
 
-		totalDownloadCount++
-		s.Logger.Debug("文件下载成功", interfaces.Fields{
-			"folder": folder,
-			"file":   serverPath,
-		})
+	// 同步中断时服务器清单可能已变化, 取消时用户不再期望修改本地文件, 都不再删除
+	if syncErr == nil {
+		syncErr = ctx.Err()
+	}
+	if syncErr != nil {
+		s.filesToDelete = nil
 	}
 
 	// 同步完成后处理需要删除的文件
 	for folder, files := range s.filesToDelete {
 		// 获取文件夹的同步模式
-		var mode interfaces.SyncMode
-		// 统一使用斜杠作为分隔符进行比较
-		folderSlash := filepath.ToSlash(folder)
-		for _, folderConfig := range s.Config.SyncFolders {
-			if folderConfig.Path == folderSlash {
-				mode = folderConfig.SyncMode
-				break
-			}
-		}
+		mode := s.folderMode(folder)
 
 		// 只在mirror模式下执行删除
 		if mode == interfaces.MirrorSync && len(files) > 0 {
@@ -198,7 +233,18 @@ func (s *ClientSyncService) SyncFiles(sourcePath string) error {
 			})
 
 			for file := range files {
+				// 文件夹名来自服务器配置, 只删除同步目录中的文件
 				fullPath := filepath.Join(sourcePath, folder, file)
+				if err := message.WithinDir(sourcePath, fullPath); err != nil {
+					s.Logger.Warn("安全事件", interfaces.Fields{
+						"event":  "delete_rejected",
+						"folder": folder,
+						"file":   file,
+						"reason": err.Error(),
+					})
+					totalFailedCount++
+					continue
+				}
 				if err := os.Remove(fullPath); err != nil {
 					if !os.IsNotExist(err) {
 						// 只记录非文件不存在的错误
@@ -220,11 +266,15 @@ func (s *ClientSyncService) SyncFiles(sourcePath string) error {
 		}
 	}
 
+	stats := s.networkClient.TransferStats().Sub(statsStart)
 	s.Logger.Info("同步完成", interfaces.Fields{
 		"downloaded": totalDownloadCount,
 		"deleted":    totalDeleteCount,
 		"skipped":    s.ignoredFiles,
 		"failed":     totalFailedCount,
+		"wire_bytes": stats.WireBytes,
+		"raw_bytes":  stats.RawBytes,
+		"ratio":      fmt.Sprintf("%.2f", stats.Ratio()),
 	})
 
 	// 同步完成后断开连接
@@ -234,6 +284,14 @@ func (s *ClientSyncService) SyncFiles(sourcePath string) error {
 		})
 	}
 
+	if errors.Is(syncErr, context.Canceled) {
+		s.SetStatus("同步已取消")
+		return syncErr
+	}
+	if syncErr != nil {
+		s.SetStatus(fmt.Sprintf("同步中断: %v", syncErr))
+		return syncErr
+	}
 	return nil
 }
 
@@ -267,8 +325,8 @@ func (s *ClientSyncService) LoadServerConfig() (*interfaces.Config, error) {
 }
 
 // GetLocalFilesWithMD5 获取本地文件的MD5信息
-func (s *ClientSyncService) GetLocalFilesWithMD5(dir string) (map[string]string, error) {
-	return s.syncBase.GetLocalFilesWithMD5(dir)
+func (s *ClientSyncService) GetLocalFilesWithMD5(ctx context.Context, dir string) (map[string]string, error) {
+	return s.syncBase.GetLocalFilesWithMD5(ctx, dir)
 }
 
 // CompareMD5 比较本地和服务器文件的MD5，返回需要同步的文件信息
@@ -325,14 +383,17 @@ func (s *ClientSyncService) CompareMD5(
 }
 
 // PrepareMD5Compare 准备并执行MD5比较
-func (s *ClientSyncService) PrepareMD5Compare() ([]string, map[string]map[string]struct{}, int, error) {
+func (s *ClientSyncService) PrepareMD5Compare(ctx context.Context) ([]string, map[string]map[string]struct{}, int, error) {
 	// 获取当前配置
 	config := s.GetCurrentConfig()
 
 	// 获取所有同步文件夹的MD5列表
 	md5Map := make(map[string]map[string]string)
 	for _, folder := range config.SyncFolders {
-		localFiles, err := s.GetLocalFilesWithMD5(folder.Path)
+		localFiles, err := s.GetLocalFilesWithMD5(ctx, folder.Path)
+		if err != nil && ctx.Err() != nil {
+			return nil, nil, 0, ctx.Err()
+		}
 		if err != nil {
 			s.Logger.Error("获取本地文件MD5失败", interfaces.Fields{
 				"folder": folder.Path,
@@ -344,19 +405,27 @@ func (s *ClientSyncService) PrepareMD5Compare() ([]string, map[string]map[string
 	}
 
 	// 构建初始化消息
-	initData := struct {
-		UUID   string                       `json:"uuid"`
-		MD5Map map[string]map[string]string `json:"md5_map"`
-	}{
+	initData := &interfaces.InitRequest{
 		UUID:   config.UUID,
 		MD5Map: md5Map,
 	}
 
-	// 发送初始化消息并接收响应
-	serverConfig, serverMD5Map, err := s.networkClient.SendInitMessage(initData)
+	// 发送初始化消息并接收响应, 之后收到的变化通知都针对本次获取的清单
+	s.manifestStale.Store(false)
+	serverConfig, serverMD5Map, err := s.networkClient.SendInitMessage(ctx, initData)
 	if err != nil {
 		return nil, nil, 0, err
 	}
+	return s.comparePlan(ctx, serverConfig, serverMD5Map)
+}
+
+// comparePlan 保存服务器配置并与本地文件比较, 返回同步计划
+func (s *ClientSyncService) comparePlan(
+	ctx context.Context,
+	serverConfig *interfaces.Config,
+	serverMD5Map map[string]map[string]string,
+) ([]string, map[string]map[string]struct{}, int, error) {
+	s.manifestDigest = manifestDigest(serverMD5Map)
 
 	// 保存服务器配置
 	if err := s.SaveServerConfig(serverConfig); err != nil {
@@ -371,7 +440,10 @@ func (s *ClientSyncService) PrepareMD5Compare() ([]string, map[string]map[string
 	var totalIgnoredFiles int
 
 	for folder, serverFiles := range serverMD5Map {
-		localFiles, err := s.GetLocalFilesWithMD5(folder)
+		localFiles, err := s.GetLocalFilesWithMD5(ctx, folder)
+		if err != nil && ctx.Err() != nil {
+			return nil, nil, 0, ctx.Err()
+		}
 		if err != nil {
 			s.Logger.Error("获取本地文件MD5失败", interfaces.Fields{
 				"folder": folder,
@@ -390,8 +462,10 @@ func (s *ClientSyncService) PrepareMD5Compare() ([]string, map[string]map[string
 			continue
 		}
 
-		// 收集结果
-		totalFilesToSync = append(totalFilesToSync, filesToSync...)
+		// 收集结果, 清单中的文件路径相对于同步文件夹, 下载时需要包含同步文件夹
+		for _, file := range filesToSync {
+			totalFilesToSync = append(totalFilesToSync, s.folderFilePath(folder, file))
+		}
 		totalFilesToDelete[folder] = filesToDelete
 		totalIgnoredFiles += ignoredFiles
 
@@ -405,3 +479,12 @@ func (s *ClientSyncService) PrepareMD5Compare() ([]string, map[string]map[string
 
 	return totalFilesToSync, totalFilesToDelete, totalIgnoredFiles, nil
 }
+
+// folderFilePath 将清单中相对于同步文件夹的文件路径转换为包含同步文件夹的路径
+// 同步文件夹为单个文件时清单中只有文件名, 路径即为同步文件夹本身
+func (s *ClientSyncService) folderFilePath(folder, file string) string {
+	if s.syncBase.IsSingleFile(folder) {
+		return path.Clean(filepath.ToSlash(folder))
+	}
+	return path.Join(filepath.ToSlash(folder), filepath.ToSlash(file))
+}
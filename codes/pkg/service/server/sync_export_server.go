@@ -0,0 +1,284 @@
+package server
+
+import (
+	"archive/zip"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"time"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/pkg/network/message"
+	"synctools/codes/pkg/network/security"
+)
+
+// ExportStatic 将同步文件夹导出为可由任意静态网站托管的目录
+// 目录中包含签名的清单和按MD5命名的内容文件, 内容文件已存在时不重复写入, 可以反复导出到同一目录增量更新;
+// 旧的内容文件不会删除, 正在按旧清单同步的客户端仍可下载. 上传到静态网站时应最后上传清单
+// 静态导出不支持认证和访问令牌, 导出全部已启用的同步文件夹
+func (s *ServerSyncService) ExportStatic(outDir string) (*interfaces.ExportResult, error) {
+	config := s.GetCurrentConfig()
+	if config == nil {
+		return nil, fmt.Errorf("配置不能为空")
+	}
+	if outDir == "" {
+		return nil, fmt.Errorf("导出目录不能为空")
+	}
+
+	key, err := security.LoadOrCreateSigningKey(s.signingKeyFile())
+	if err != nil {
+		return nil, err
+	}
+
+	exported := exportConfig(config)
+	manifest := &interfaces.StaticManifest{
+		FormatVersion: message.StaticFormatVersion,
+		CreateTime:    time.Now(),
+		Config:        exported,
+		MD5Map:        make(map[string]map[string]string),
+		Files:         make(map[string]interfaces.StaticFile),
+	}
+	result := &interfaces.ExportResult{}
+
+	for _, folder := range exported.SyncFolders {
+		files, err := s.exportFolder(outDir, config.SyncDir, folder, manifest, result)
+		if err != nil {
+			return nil, err
+		}
+		manifest.MD5Map[folder.Path] = files
+	}
+
+	publicKey, err := writeSignedManifest(outDir, key, manifest)
+	if err != nil {
+		return nil, err
+	}
+	result.PublicKey = publicKey
+
+	s.Logger.Info("静态导出完成", interfaces.Fields{
+		"dir":        outDir,
+		"files":      result.Files,
+		"ignored":    result.Ignored,
+		"written":    result.Written,
+		"bytes":      result.Bytes,
+		"public_key": publicKey,
+	})
+	return result, nil
+}
+
+// exportFolder 导出单个同步文件夹, 返回与在线服务器清单格式相同的文件MD5列表
+// 文件路径相对于同步文件夹; 同步文件夹为单个文件时使用文件名; 跳过指向同步文件夹之外的符号链接
+func (s *ServerSyncService) exportFolder(
+	outDir, syncDir string,
+	folder interfaces.SyncFolder,
+	manifest *interfaces.StaticManifest,
+	result *interfaces.ExportResult,
+) (map[string]string, error) {
+	root := filepath.Join(syncDir, folder.Path)
+	files := make(map[string]string)
+
+	info, err := os.Stat(root)
+	if os.IsNotExist(err) {
+		s.Logger.Warn("同步文件夹不存在, 跳过导出", interfaces.Fields{
+			"folder": folder.Path,
+		})
+		return files, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("获取同步文件夹信息失败: %v", err)
+	}
+
+	exportFile := func(source, rel string) error {
+		// 清单中的路径相对于同步目录, 与客户端请求的路径一致
+		filePath := path.Clean(filepath.ToSlash(folder.Path))
+		if info.IsDir() {
+			filePath = path.Join(filePath, filepath.ToSlash(rel))
+		}
+		if s.IsIgnored(rel) || s.IsIgnored(filePath) {
+			result.Ignored++
+			return nil
+		}
+
+		// 打包同步的文件由客户端解压, 只能是ZIP压缩包
+		if folder.SyncMode == interfaces.PackSync {
+			if err := checkArchive(source); err != nil {
+				return err
+			}
+		}
+
+		file, written, err := exportBlob(outDir, source)
+		if err != nil {
+			return err
+		}
+		if written {
+			result.Written++
+			result.Bytes += file.Size
+		}
+		result.Files++
+		files[rel] = file.MD5
+		manifest.Files[filePath] = *file
+		return nil
+	}
+
+	if !info.IsDir() {
+		return files, exportFile(root, filepath.Base(root))
+	}
+
+	err = filepath.Walk(root, func(p string, fi os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if fi.IsDir() || message.IsPartialFile(p) {
+			return nil
+		}
+		// 与在线传输的沙箱相同, 不导出指向同步文件夹之外的符号链接, 也不跟随链接到目录
+		if fi.Mode()&os.ModeSymlink != 0 {
+			if err := message.WithinDir(root, p); err != nil {
+				s.Logger.Warn("跳过指向同步文件夹之外的符号链接", interfaces.Fields{
+					"folder": folder.Path,
+					"file":   p,
+					"error":  err,
+				})
+				return nil
+			}
+			if target, err := os.Stat(p); err != nil || !target.Mode().IsRegular() {
+				return nil
+			}
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		return exportFile(p, rel)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("导出同步文件夹失败: %s: %v", folder.Path, err)
+	}
+	return files, nil
+}
+
+// exportBlob 将文件写入按MD5命名的内容文件, 内容文件已存在时不重复写入
+func exportBlob(outDir, source string) (*interfaces.StaticFile, bool, error) {
+	md5sum, size, err := fileMD5(source)
+	if err != nil {
+		return nil, false, err
+	}
+	file := &interfaces.StaticFile{MD5: md5sum, Size: size}
+
+	blobPath := filepath.Join(outDir, filepath.FromSlash(message.StaticBlobPath(md5sum)))
+	if info, err := os.Stat(blobPath); err == nil && info.Size() == size {
+		return file, false, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(blobPath), 0755); err != nil {
+		return nil, false, fmt.Errorf("创建内容目录失败: %v", err)
+	}
+
+	src, err := os.Open(source)
+	if err != nil {
+		return nil, false, fmt.Errorf("打开文件失败: %v", err)
+	}
+	defer src.Close()
+
+	// 先写入临时文件, 校验内容后再改名, 中断的导出不会留下错误的内容文件
+	tmp, err := os.CreateTemp(filepath.Dir(blobPath), md5sum+".*.tmp")
+	if err != nil {
+		return nil, false, fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hash := md5.New()
+	_, copyErr := io.Copy(io.MultiWriter(tmp, hash), src)
+	closeErr := tmp.Close()
+	if copyErr != nil {
+		return nil, false, fmt.Errorf("写入内容文件失败: %v", copyErr)
+	}
+	if closeErr != nil {
+		return nil, false, fmt.Errorf("写入内容文件失败: %v", closeErr)
+	}
+	if hex.EncodeToString(hash.Sum(nil)) != md5sum {
+		return nil, false, fmt.Errorf("文件在导出过程中被修改: %s", source)
+	}
+	if err := os.Rename(tmp.Name(), blobPath); err != nil {
+		return nil, false, fmt.Errorf("保存内容文件失败: %v", err)
+	}
+	return file, true, nil
+}
+
+// writeSignedManifest 签名并写入清单, 返回签名公钥
+func writeSignedManifest(outDir string, key []byte, manifest *interfaces.StaticManifest) (string, error) {
+	payload, err := json.Marshal(manifest)
+	if err != nil {
+		return "", fmt.Errorf("序列化清单失败: %v", err)
+	}
+	publicKey, signature := security.SignManifest(key, payload)
+
+	// 不能缩进输出, 缩进会改变签名的清单内容
+	data, err := json.Marshal(&interfaces.SignedManifest{
+		Manifest:  payload,
+		PublicKey: publicKey,
+		Signature: signature,
+	})
+	if err != nil {
+		return "", fmt.Errorf("序列化清单失败: %v", err)
+	}
+
+	manifestPath := filepath.Join(outDir, message.StaticManifestFile)
+	tmpPath := manifestPath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return "", fmt.Errorf("写入清单失败: %v", err)
+	}
+	if err := os.Rename(tmpPath, manifestPath); err != nil {
+		os.Remove(tmpPath)
+		return "", fmt.Errorf("写入清单失败: %v", err)
+	}
+	return publicKey, nil
+}
+
+// exportConfig 生成清单中客户端可见的配置, 只包含已启用的同步文件夹
+func exportConfig(config *interfaces.Config) *interfaces.Config {
+	var folders []interfaces.SyncFolder
+	for _, folder := range config.SyncFolders {
+		if folder.IsEnabled {
+			folders = append(folders, folder)
+		}
+	}
+	return message.ClientConfig(config, folders)
+}
+
+// signingKeyFile 清单签名私钥的路径, 保存在配置存储目录下
+func (s *ServerSyncService) signingKeyFile() string {
+	dir := "."
+	if s.Storage != nil {
+		dir = s.Storage.BaseDir()
+	}
+	return filepath.Join(dir, "keys", security.DefaultSigningKeyFile)
+}
+
+// fileMD5 流式计算文件的MD5和大小
+func fileMD5(path string) (string, int64, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", 0, fmt.Errorf("打开文件失败: %v", err)
+	}
+	defer file.Close()
+
+	hash := md5.New()
+	size, err := io.Copy(hash, file)
+	if err != nil {
+		return "", 0, fmt.Errorf("计算文件MD5失败: %v", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), size, nil
+}
+
+// checkArchive 检查打包同步的文件是否为有效的ZIP压缩包
+func checkArchive(path string) error {
+	reader, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("打包同步的文件不是有效的ZIP压缩包: %s: %v", path, err)
+	}
+	return reader.Close()
+}
@@ -0,0 +1,84 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"synctools/codes/internal/interfaces"
+	"synctools/codes/internal/testutil"
+	"synctools/codes/pkg/network/message"
+	"synctools/codes/pkg/storage"
+)
+
+// TestExportSkipsOutsideSymlinks 静态导出跳过指向同步文件夹之外的符号链接, 同步文件夹内的链接正常导出
+func TestExportSkipsOutsideSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	syncDir := filepath.Join(dir, "sync")
+	mods := filepath.Join(syncDir, "mods")
+	if err := os.MkdirAll(mods, 0755); err != nil {
+		t.Fatal(err)
+	}
+	secret := filepath.Join(dir, "secret.txt")
+	for name, data := range map[string]string{filepath.Join(mods, "a.jar"): "a", secret: "secret"} {
+		if err := os.WriteFile(name, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"inside.jar":  filepath.Join(mods, "a.jar"),
+		"outside.txt": secret,
+		"outdir":      dir,
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(mods, name)); err != nil {
+			t.Skipf("无法创建符号链接: %v", err)
+		}
+	}
+
+	log := testutil.NewNopLogger()
+	store, err := storage.NewFileStorage(filepath.Join(dir, "config"), log)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServerSyncService(&interfaces.Config{
+		SyncDir:     syncDir,
+		SyncFolders: []interfaces.SyncFolder{{Path: "mods", SyncMode: interfaces.MirrorSync, IsEnabled: true}},
+	}, log, store)
+
+	if _, err := s.ExportStatic(filepath.Join(dir, "out")); err != nil {
+		t.Fatal(err)
+	}
+	manifest := readExportedManifest(t, filepath.Join(dir, "out"))
+	files := manifest.MD5Map["mods"]
+	if _, ok := files["a.jar"]; !ok {
+		t.Errorf("普通文件应被导出: %v", files)
+	}
+	if _, ok := files["inside.jar"]; !ok {
+		t.Errorf("同步文件夹内的符号链接应被导出: %v", files)
+	}
+	for _, name := range []string{"outside.txt", "outdir"} {
+		if _, ok := files[name]; ok {
+			t.Errorf("%s 指向同步文件夹之外, 不应被导出", name)
+		}
+	}
+}
+
+// readExportedManifest 读取静态导出目录中的清单
+func readExportedManifest(t *testing.T, outDir string) *interfaces.StaticManifest {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join(outDir, message.StaticManifestFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var signed interfaces.SignedManifest
+	if err := json.Unmarshal(data, &signed); err != nil {
+		t.Fatal(err)
+	}
+	var manifest interfaces.StaticManifest
+	if err := json.Unmarshal(signed.Manifest, &manifest); err != nil {
+		t.Fatal(err)
+	}
+	return &manifest
+}
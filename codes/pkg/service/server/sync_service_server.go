@@ -13,7 +13,10 @@
 package server
 
 import (
+	"context"
 	"fmt"
+	"path/filepath"
+	"time"
 
 	"synctools/codes/internal/interfaces"
 	"synctools/codes/pkg/errors"
@@ -51,7 +54,12 @@ func (s *ServerSyncService) StartServer() error {
 	}
 
 	if s.server == nil {
-		s.server = netserver.NewServer(s.GetCurrentConfig(), s, s.Logger)
+		srv := netserver.NewServer(s.GetCurrentConfig(), s, s.Logger)
+		// 自签名证书保存在配置存储目录下
+		if s.Storage != nil {
+			srv.SetCertDir(filepath.Join(s.Storage.BaseDir(), "tls"))
+		}
+		s.server = srv
 	}
 
 	if err := s.server.Start(); err != nil {
@@ -70,12 +78,20 @@ func (s *ServerSyncService) StartServer() error {
 
 // StopServer 停止服务器
 func (s *ServerSyncService) StopServer() error {
+	return s.ShutdownServer(0)
+}
+
+// ShutdownServer 优雅关闭服务器, 在timeout内等待进行中的传输完成, timeout为0时立即停止
+func (s *ServerSyncService) ShutdownServer(timeout time.Duration) error {
 	if !s.IsRunning() {
 		return nil
 	}
 
 	if s.server != nil {
-		if err := s.server.Stop(); err != nil {
+		if timeout > 0 {
+			s.SetStatus("服务器正在关闭")
+		}
+		if err := s.server.Shutdown(timeout); err != nil {
 			return err
 		}
 		s.server = nil
@@ -94,6 +110,51 @@ func (s *ServerSyncService) SetServer(server interfaces.NetworkServer) {
 	s.server = server
 }
 
+// configApplier 支持在运行中应用配置变更的网络服务器
+type configApplier interface {
+	ApplyConfig(config *interfaces.Config)
+}
+
+// SaveConfig 保存配置, 运行中的服务器立即应用访问令牌和带宽限制的变更
+func (s *ServerSyncService) SaveConfig(config *interfaces.Config) error {
+	if err := s.BaseSyncService.SaveConfig(config); err != nil {
+		return err
+	}
+
+	if srv, ok := s.server.(configApplier); ok {
+		srv.ApplyConfig(config)
+	}
+	return nil
+}
+
+// RevokeToken 吊销访问令牌, 使用该令牌的客户端立即断开, 无需重启服务器
+func (s *ServerSyncService) RevokeToken(name string) error {
+	config := s.GetCurrentConfig()
+	if config == nil {
+		return fmt.Errorf("配置不能为空")
+	}
+
+	found := false
+	for i := range config.AccessTokens {
+		if config.AccessTokens[i].Name == name {
+			config.AccessTokens[i].Revoked = true
+			found = true
+		}
+	}
+	if !found {
+		return fmt.Errorf("访问令牌不存在: %s", name)
+	}
+
+	if err := s.SaveConfig(config); err != nil {
+		return fmt.Errorf("保存配置失败: %v", err)
+	}
+
+	s.Logger.Info("访问令牌已吊销", interfaces.Fields{
+		"token": name,
+	})
+	return nil
+}
+
 // GetNetworkServer 获取网络服务器
 func (s *ServerSyncService) GetNetworkServer() interfaces.NetworkServer {
 	return s.server
@@ -109,6 +170,6 @@ func (s *ServerSyncService) HandleSyncRequest(request interface{}) error {
 }
 
 // GetLocalFilesWithMD5 获取本地文件的MD5信息
-func (s *ServerSyncService) GetLocalFilesWithMD5(dir string) (map[string]string, error) {
-	return s.BaseSyncService.GetLocalFilesWithMD5(dir)
+func (s *ServerSyncService) GetLocalFilesWithMD5(ctx context.Context, dir string) (map[string]string, error) {
+	return s.BaseSyncService.GetLocalFilesWithMD5(ctx, dir)
 }